@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package main
+
+// Windows folder ACLs and the read-only attribute don't answer this;
+// only -probe-writes does.
+const accessSupported = false
+
+func canWrite(dir string) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ageBucket struct {
+	Name   string
+	MinAge time.Duration
+}
+
+// ageBuckets are kept oldest first so the first match wins.
+type ageBuckets []ageBucket
+
+// parseAgeBuckets parses "old=180d,archive=2y": files untouched for at
+// least the given age go into that bucket. Ages must increase.
+func parseAgeBuckets(s string) (ageBuckets, error) {
+	var out ageBuckets
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		name, age, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = sanitizeComponent(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid -age-buckets %q: expected NAME=AGE entries", s)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid -age-buckets %q: duplicate bucket %q", s, name)
+		}
+		seen[name] = true
+		d, err := parseAge(age)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -age-buckets %q: %v", s, err)
+		}
+		if len(out) > 0 && d <= out[len(out)-1].MinAge {
+			return nil, fmt.Errorf("invalid -age-buckets %q: ages must increase", s)
+		}
+		out = append(out, ageBucket{Name: name, MinAge: d})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].MinAge > out[j].MinAge })
+	return out, nil
+}
+
+// parseAge accepts whole days, weeks and years (180d, 6w, 2y) on top of
+// Go durations (36h).
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad age %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad age %q (use e.g. 180d, 6w, 2y)", s)
+	}
+	return d, nil
+}
+
+// bucket returns the bucket for a file last modified at mtime, or "" when
+// it is younger than every threshold.
+func (bs ageBuckets) bucket(mtime, now time.Time) string {
+	age := now.Sub(mtime)
+	for _, b := range bs {
+		if age >= b.MinAge {
+			return b.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveKind reports whether a -src file is an archive this tool can read
+// entry by entry.
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar.bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return "tar.bz2"
+	}
+	return ""
+}
+
+type archiveStats struct {
+	Entries, Extracted, Skipped, Failed  int
+	Filtered, SizeFiltered, TimeFiltered int
+	MatchFiltered, MIMEFiltered          int
+	OutOfScope, Junk                     int
+	Links                                int // link and special entries, skipped
+	Conflicts                            map[string]int
+	Ages, Buckets                        map[string]int // -age-buckets and -size-buckets counts
+	LayoutFolders                        map[string]bool
+}
+
+// archiveUnsupported names the first flag set that archive entries can't
+// honour: they have no owner or metadata to probe, and are written while
+// being read, without the staging -shard hash and -duplicates-to need.
+func (o Options) archiveUnsupported() string {
+	switch {
+	case o.Shard != nil:
+		return "-shard"
+	case o.MaxPerDir != 0:
+		return "-max-per-dir"
+	case o.ByOwner:
+		return "-by-owner"
+	case o.DuplicatesTo != "":
+		return "-duplicates-to"
+	case len(o.NameFlags) > 0:
+		return "-name-template"
+	case len(o.MusicLayout) > 0:
+		return "-music-layout"
+	case len(o.PhotoLayout) > 0:
+		return "-photo-layout"
+	case o.VideoResolution:
+		return "-video-resolution"
+	case o.Layout != nil && o.Layout.uses["hash"]:
+		return "-layout {hash}"
+	case o.Layout != nil && o.Layout.uses["owner"]:
+		return "-layout {owner}"
+	}
+	return ""
+}
+
+// archiveEntry is one file inside an archive, opened on demand. Kind is
+// set for entries that are not extracted: symlink, hardlink or a special
+// file (see specialKind).
+type archiveEntry struct {
+	Name    string
+	Kind    string
+	Size    int64
+	ModTime time.Time
+	Open    func() (io.ReadCloser, error)
+}
+
+// entryInfo describes an archive entry to place, which only looks at the
+// name, size and time.
+type entryInfo struct{ e archiveEntry }
+
+func (i entryInfo) Name() string       { return path.Base(i.e.Name) }
+func (i entryInfo) Size() int64        { return i.e.Size }
+func (i entryInfo) Mode() os.FileMode  { return 0644 }
+func (i entryInfo) ModTime() time.Time { return i.e.ModTime }
+func (i entryInfo) IsDir() bool        { return false }
+func (i entryInfo) Sys() any           { return nil }
+
+// extractArchive organizes the entries of an archive straight into their
+// destinations; nothing is unpacked to a temporary folder first.
+func (o Options) extractArchive(archive string, placed map[string]string, dateFolders map[string]bool, now time.Time, mf *manifest) (archiveStats, error) {
+	st := archiveStats{
+		Conflicts:     make(map[string]int),
+		Ages:          make(map[string]int),
+		Buckets:       make(map[string]int),
+		LayoutFolders: make(map[string]bool),
+	}
+	visit := func(e archiveEntry) error {
+		err := o.extractEntry(archive, e, placed, dateFolders, now, &st, mf)
+		if errors.Is(err, errFilteredEntry) {
+			st.Filtered++
+			return nil
+		}
+		if errors.Is(err, errJunkEntry) {
+			st.Junk++
+			return nil
+		}
+		if errors.Is(err, errMIMEFilteredEntry) {
+			st.MIMEFiltered++
+			return nil
+		}
+		if errors.Is(err, errMatchFilteredEntry) {
+			st.MatchFiltered++
+			return nil
+		}
+		if errors.Is(err, errSizeFilteredEntry) {
+			st.SizeFiltered++
+			return nil
+		}
+		if errors.Is(err, errTimeFilteredEntry) {
+			st.TimeFiltered++
+			return nil
+		}
+		if errors.Is(err, errScopeEntry) {
+			st.OutOfScope++
+			return nil
+		}
+		st.Entries++
+		switch {
+		case err == nil:
+			st.Extracted++
+		case errors.Is(err, errLinkEntry):
+			st.Skipped++
+			st.Links++
+		case errors.Is(err, errSkipEntry):
+			st.Skipped++
+		case errors.Is(err, errConflict):
+			return err
+		default:
+			st.Failed++
+			fmt.Fprintln(os.Stderr, "WARN:", err)
+		}
+		return nil
+	}
+
+	var err error
+	if archiveKind(archive) == "zip" {
+		err = walkZip(archive, visit)
+	} else {
+		err = walkTar(archive, visit)
+	}
+	if errors.Is(err, errConflict) {
+		return st, err
+	}
+	if err != nil {
+		st.Failed++
+		fmt.Fprintf(os.Stderr, "WARN: reading %s: %v\n", archive, err)
+	}
+	return st, nil
+}
+
+var (
+	errSkipEntry          = errors.New("entry skipped")
+	errLinkEntry          = errors.New("link or device entry not extracted")
+	errFilteredEntry      = errors.New("entry filtered by -include/-exclude")
+	errMatchFilteredEntry = errors.New("entry filtered by -match/-not-match")
+	errJunkEntry          = errors.New("junk entry")
+	errMIMEFilteredEntry  = errors.New("entry filtered by -include-mime")
+	errSizeFilteredEntry  = errors.New("entry filtered by size")
+	errTimeFilteredEntry  = errors.New("entry filtered by -since/-before")
+	errScopeEntry         = errors.New("entry category out of scope")
+)
+
+func walkZip(archive string, visit func(archiveEntry) error) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		kind := ""
+		switch {
+		case mode&os.ModeSymlink != 0:
+			kind = "symlink"
+		case !mode.IsRegular():
+			if kind = specialKind(mode); kind == "" {
+				kind = "special"
+			}
+		}
+		if err := visit(archiveEntry{
+			Name:    f.Name,
+			Kind:    kind,
+			Size:    int64(f.UncompressedSize64),
+			ModTime: f.Modified,
+			Open:    f.Open,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(archive string, visit func(archiveEntry) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	switch archiveKind(archive) {
+	case "tar.gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(r)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var kind string
+		switch h.Typeflag {
+		case tar.TypeReg:
+		case tar.TypeSymlink:
+			kind = "symlink"
+		case tar.TypeLink:
+			kind = "hardlink"
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			kind = specialKind(h.FileInfo().Mode())
+		default:
+			// folders, and metadata headers the reader did not fold in
+			continue
+		}
+		if err := visit(archiveEntry{
+			Name:    h.Name,
+			Kind:    kind,
+			Size:    h.Size,
+			ModTime: h.ModTime,
+			Open:    func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath validates an entry name and turns it into a local relative
+// path, rejecting absolute names and any ".." that would climb out.
+func entryPath(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	rel := filepath.FromSlash(clean)
+	if path.IsAbs(clean) || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("unsafe entry name %q", name)
+	}
+	return rel, nil
+}
+
+func (o Options) extractEntry(archive string, e archiveEntry, placed map[string]string, dateFolders map[string]bool, now time.Time, st *archiveStats, mf *manifest) error {
+	label := archive + "!" + e.Name
+	rel, err := entryPath(e.Name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", archive, err)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if o.isJunk(elem) {
+			return errJunkEntry
+		}
+	}
+	if !o.selects(rel, false) {
+		return errFilteredEntry
+	}
+	if !o.matchSelects(rel) {
+		return errMatchFilteredEntry
+	}
+	if !o.sizeSelects(e.Size) {
+		return errSizeFilteredEntry
+	}
+	if !o.timeSelects(e.ModTime) {
+		return errTimeFilteredEntry
+	}
+	if e.Kind != "" {
+		fmt.Printf("SKIP: %s (%s entry not extracted)\n", label, e.Kind)
+		return errLinkEntry
+	}
+
+	m := o.Categorizer.categorize("", rel)
+	var rc io.ReadCloser
+	var head []byte
+	sniff := o.Sniff && !o.Categorizer.byMIME && m.Via == "" && (m.UnknownExt != "" || filepath.Ext(rel) == "")
+	if sniff || len(o.IncludeMIME) > 0 {
+		if rc, err = e.Open(); err != nil {
+			return fmt.Errorf("%s: %v", label, err)
+		}
+		defer rc.Close()
+		head = make([]byte, sniffLen)
+		n, _ := io.ReadFull(rc, head)
+		head = head[:n]
+		mime := sniffContent(head)
+		if len(o.IncludeMIME) > 0 && !o.IncludeMIME.matches(mime) {
+			return errMIMEFilteredEntry
+		}
+		if cat := categoryByMIME(mime); sniff && cat != "" {
+			m.Category, m.Via = cat, "sniffed as "+mime
+		}
+	}
+	if !o.Scope.includes(m.Category) {
+		return errScopeEntry
+	}
+
+	pl, err := o.place(label, rel, m, entryInfo{e}, e.ModTime, now)
+	if err != nil {
+		return fmt.Errorf("%s: %v", label, err)
+	}
+	if pl.TemplateDir != "" {
+		st.LayoutFolders[pl.TemplateDir] = true
+	}
+	if len(o.AgeBuckets) > 0 {
+		age := pl.Age
+		if age == "" {
+			age = "current"
+		}
+		st.Ages[age]++
+	}
+	if pl.SizeBucket != "" {
+		st.Buckets[pl.SizeBucket]++
+	}
+	if pl.DateDir != "" {
+		dateFolders[pl.DateDir] = true
+	}
+	root, destDir, destPath := pl.Root, pl.Dir, pl.Path
+	origName := ""
+	if o.SanitizeNames {
+		if slug := o.slugName(filepath.Base(rel)); slug != filepath.Base(rel) {
+			origName, destPath = filepath.Base(rel), filepath.Join(destDir, slug)
+		}
+	}
+	if norm, _ := o.normalizePath(root, destPath); norm != destPath {
+		destPath, destDir = norm, filepath.Dir(norm)
+	}
+	sanitizedFrom := ""
+	if safe := o.windowsSafePath(root, destPath); safe != destPath {
+		sanitizedFrom, destPath, destDir = destPath, safe, filepath.Dir(safe)
+	}
+	if fit, err := o.fitNames(root, destPath); err != nil {
+		return err
+	} else if fit != destPath {
+		if sanitizedFrom == "" {
+			sanitizedFrom = destPath
+		}
+		destPath, destDir = fit, filepath.Dir(fit)
+	}
+	res, err := o.resolveConflict(label, e.ModTime, destPath, placed)
+	if err != nil {
+		return err
+	}
+	if res.Outcome != "" {
+		st.Conflicts[res.Outcome]++
+		o.reportConflict(label, destPath, res)
+	}
+	if res.Path == "" {
+		return errSkipEntry
+	}
+	versionOf := ""
+	if res.Outcome == conflictRenamed {
+		versionOf = destPath
+	}
+	destPath = res.Path
+	placed[o.destKey(destPath)] = label
+	if o.KeepReplaced && res.replaces() {
+		kept, err := o.keepReplaced(root, m.Category, destPath)
+		if err != nil {
+			return err
+		}
+		if err := mf.record(kept); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+		}
+	}
+
+	if o.Verbose || o.DryRun {
+		note := ""
+		if m.Via != "" {
+			note = " [" + m.Via + "]"
+		}
+		fmt.Printf("EXTRACT: %s -> %s%s\n", label, destPath, note)
+	}
+	if err := ensureDir(destDir, o.DryRun, o.Verbose); err != nil {
+		return err
+	}
+	if o.DryRun {
+		if versionOf != "" {
+			o.trackVersion(versionOf, destPath)
+		}
+		return nil
+	}
+
+	if rc == nil {
+		if rc, err = e.Open(); err != nil {
+			return fmt.Errorf("%s: %v", label, err)
+		}
+		defer rc.Close()
+	}
+	if err := writeEntry(destPath, io.MultiReader(bytes.NewReader(head), rc), e); err != nil {
+		return fmt.Errorf("extract %s -> %s: %v", label, destPath, err)
+	}
+	noteDir(destDir)
+	if versionOf != "" {
+		o.trackVersion(versionOf, destPath)
+	}
+	if err := mf.record(manifestEntry{Action: "extract", Src: label, Dest: destPath, Size: e.Size, OriginalName: origName, SanitizedFrom: sanitizedFrom, Conflict: res.Outcome, VersionOf: versionOf}); err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+	}
+	return nil
+}
+
+func writeEntry(dest string, r io.Reader, e archiveEntry) error {
+	if err := writeAtomic(dest, nil, func(out io.Writer) error {
+		n, err := io.Copy(out, r)
+		if err != nil {
+			return fmt.Errorf("%w after %s written", err, formatBytes(n))
+		}
+		if n != e.Size {
+			return fmt.Errorf("got %d bytes, entry says %d", n, e.Size)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !e.ModTime.IsZero() {
+		_ = os.Chtimes(dest, e.ModTime, e.ModTime)
+	}
+	return nil
+}
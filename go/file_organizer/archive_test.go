@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeZip creates a zip of name -> content, all modified at mtime.
+func writeZip(t *testing.T, path string, files map[string]string, mtime time.Time) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveEntriesFollowPlacementFlags(t *testing.T) {
+	mtime := time.Date(2020, 5, 6, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		flags []string
+		want  []string
+	}{
+		{[]string{"-layout", "{category}/{year}-{month}x/{name}"}, []string{"documents/2020-05x/notes.txt", "images/2020-05x/photo.jpg"}},
+		{[]string{"-size-buckets", "tiny=4,big="}, []string{"documents/tiny/notes.txt", "images/big/photo.jpg"}},
+		{[]string{"-date-dirs", "-date-format", "2006"}, []string{"documents/2020/notes.txt", "images/2020/photo.jpg"}},
+		{[]string{"-keep-structure", "-layout", "{ext}"}, []string{"txt/notes.txt", "jpg/trip/photo.jpg"}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "in.zip")
+		writeZip(t, archive, map[string]string{"notes.txt": "abc", "trip/photo.jpg": "a bigger file"}, mtime)
+		dest := filepath.Join(dir, "out")
+		args := append([]string{"-src", archive, "-dest", dest}, tt.flags...)
+		out, err := organize(t, args...)
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", tt.flags, err, out)
+		}
+		for _, want := range tt.want {
+			if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(want))); err != nil {
+				t.Errorf("%v: %s not extracted:\n%s", tt.flags, want, out)
+			}
+		}
+	}
+}
+
+func TestArchiveRejectsUnsupportedFlags(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "in.zip")
+	writeZip(t, archive, map[string]string{"notes.txt": "abc"}, time.Now())
+	for _, flags := range [][]string{
+		{"-shard", "first-letter"},
+		{"-max-per-dir", "10"},
+		{"-by-owner"},
+		{"-duplicates-to", "dups"},
+		{"-name-template", "images={taken}"},
+		{"-photo-layout", "date"},
+		{"-music-layout", "artist"},
+		{"-layout", "{category}/{hash}"},
+		{"-layout", "{owner}/{name}"},
+	} {
+		if flags[0] == "-by-owner" && runtime.GOOS == "windows" {
+			continue // refused on Windows anyway
+		}
+		args := append([]string{"-src", archive, "-dest", filepath.Join(dir, "out")}, flags...)
+		_, err := organize(t, args...)
+		if err == nil || !strings.Contains(err.Error(), "not supported for archive sources") {
+			t.Errorf("%v: err = %v, want it refused", flags, err)
+		}
+	}
+}
+
+func TestArchiveLinkEntriesSkipped(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "in.tar")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, h := range []*tar.Header{
+		{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "docs/a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 2},
+		{Name: "docs/link.txt", Typeflag: tar.TypeSymlink, Linkname: "a.txt"},
+		{Name: "docs/hard.txt", Typeflag: tar.TypeLink, Linkname: "docs/a.txt"},
+		{Name: "pipe", Typeflag: tar.TypeFifo, Mode: 0644},
+	} {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			tw.Write([]byte("hi"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	zipped := filepath.Join(dir, "in.zip")
+	zf, err := os.Create(zipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	h := &zip.FileHeader{Name: "link.txt"}
+	h.SetMode(os.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("a.txt"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zf.Close()
+
+	for _, tt := range []struct {
+		archive string
+		want    []string
+	}{
+		{archive, []string{
+			"SKIP: " + archive + "!docs/link.txt (symlink entry not extracted)",
+			"SKIP: " + archive + "!docs/hard.txt (hardlink entry not extracted)",
+			"SKIP: " + archive + "!pipe (fifo entry not extracted)",
+			"Processed: 4\n", "Succeeded: 1\n", "Skipped: 3\n", "Failed: 0\n",
+			"Archive link and special entries not extracted, skipped: 3\n",
+		}},
+		{zipped, []string{
+			"SKIP: " + zipped + "!link.txt (symlink entry not extracted)",
+			"Processed: 1\n", "Skipped: 1\n",
+		}},
+	} {
+		dest := filepath.Join(dir, "out-"+filepath.Ext(tt.archive))
+		out, err := organize(t, "-src", tt.archive, "-dest", dest, "-dry-run")
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("output lacks %q:\n%s", want, out)
+			}
+		}
+	}
+}
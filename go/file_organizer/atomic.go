@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// tempMarker is part of the names copies are written under before they
+// are renamed into place: .<name>.organizer-tmp-XXXXXXXX.
+const tempMarker = ".organizer-tmp-"
+
+// preservePerms and preserveTimes are cleared by -no-preserve-perms and
+// -no-preserve-times, preserveXattrs by -preserve-xattrs=false and
+// preserveOwner by -no-preserve-owner.
+var preservePerms, preserveTimes, preserveXattrs, preserveOwner = true, true, true, true
+
+// ownerWarned keeps a refused chown (root squashing, FAT) to one warning.
+var ownerWarned bool
+
+// chown and geteuid are os.Lchown and os.Geteuid; tests swap them to see
+// owners kept without running as root.
+var (
+	chown   = os.Lchown
+	geteuid = os.Geteuid
+)
+
+// createTemp creates the temporary file for dest in dest's folder. Unlike
+// os.CreateTemp it uses the mode os.Create would, so renamed copies get
+// the usual permissions.
+func createTemp(dest string) (*os.File, error) {
+	for try := 0; ; try++ {
+		tmp, err := tempPath(dest)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(longPath(tmp), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 10 {
+			continue
+		}
+		if err != nil {
+			return nil, explainLength(tmp, err)
+		}
+		return f, nil
+	}
+}
+
+// tempPath picks a temporary name for dest in dest's folder.
+func tempPath(dest string) (string, error) {
+	dir, base := filepath.Split(dest)
+	// leave room for the marker and suffix within NAME_MAX
+	for n := 200; len(base) > n; n-- {
+		if utf8.RuneStart(base[n]) {
+			base = base[:n]
+		}
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "."+base+tempMarker+hex.EncodeToString(b)), nil
+}
+
+// writeAtomic writes dest through a temporary file that is synced and
+// renamed over dest, so dest is never seen half-written and an existing
+// file is replaced in one step. The temporary file is removed on error.
+// With a source, its owner, permissions, extended attributes and times
+// are applied before the rename.
+func writeAtomic(dest string, src *os.File, write func(io.Writer) error) error {
+	out, err := createTemp(dest)
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	err = write(out)
+	if err == nil && src != nil {
+		err = keepMetadata(out, src, dest)
+	}
+	if err == nil && syncData() {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && src != nil {
+		keepPathMetadata(tmp, src, dest)
+	}
+	if err == nil {
+		err = explainLength(dest, os.Rename(tmp, longPath(dest)))
+	}
+	if err != nil {
+		removePartial(tmp)
+	}
+	return err
+}
+
+// keepMetadata gives out, a copy of src that will become dest, the owner
+// and permissions of src; chown goes first as it clears setuid and setgid.
+func keepMetadata(out, src *os.File, dest string) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if preserveOwner {
+		applyOwner(out.Name(), info)
+	}
+	if preservePerms {
+		if err := applyPerms(out, info); err != nil {
+			return fmt.Errorf("%s: cannot set permissions: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+// keepPathMetadata applies what has to wait until the copy is closed:
+// extended attributes, and the times last so nothing bumps them.
+// Failures only warn; the copy itself is still good.
+func keepPathMetadata(path string, src *os.File, dest string) {
+	if preserveXattrs {
+		copyXattrs(src.Name(), path, dest)
+	}
+	if !preserveTimes {
+		return
+	}
+	info, err := src.Stat()
+	if err == nil {
+		err = applyTimes(path, info)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN:", dest+":", err)
+	}
+}
+
+// applyOwner gives a copy or placed link at path the source's owner when
+// running as root; other users can't chown, and their copies are theirs
+// already. A symlink itself is changed, not what it points to.
+func applyOwner(path string, src os.FileInfo) {
+	id, ok := fileOwnerIDs(src)
+	if !ok || geteuid() != 0 {
+		return
+	}
+	if err := chown(path, id.UID, id.GID); err != nil && !ownerWarned {
+		ownerWarned = true
+		fmt.Fprintln(os.Stderr, "WARN: cannot keep file owners, copies stay owned by root:", err)
+	}
+}
+
+// applyTimes gives path the modification time of the source and, where
+// the platform reports it, the access time; otherwise atime is the mtime.
+func applyTimes(path string, src os.FileInfo) error {
+	atime, ok := accessTime(src)
+	if !ok {
+		atime = src.ModTime()
+	}
+	if err := os.Chtimes(path, atime, src.ModTime()); err != nil {
+		return fmt.Errorf("cannot set times: %v", err)
+	}
+	return nil
+}
+
+// removePartial deletes an incomplete or rejected copy; failing to do so
+// is reported, since the file would look like a finished one.
+func removePartial(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "WARN: cannot remove partial copy:", err)
+	}
+}
+
+// copyError describes a copy that broke off, with how much got written.
+func copyError(src, dest string, n int64, err error) error {
+	return fmt.Errorf("%s -> %s: %w after %s written", src, dest, err, formatBytes(n))
+}
+
+// isLeftoverTemp reports whether name is a temporary copy or a staged
+// -shard file, which only outlive a run that crashed.
+func isLeftoverTemp(name string) bool {
+	if strings.HasPrefix(name, ".") && strings.Contains(name, tempMarker) {
+		return true
+	}
+	return strings.HasPrefix(name, ".file_organizer-") && strings.HasSuffix(name, ".tmp")
+}
+
+// cleanTemps removes the temporary files an interrupted run left in the
+// destination roots; a dry-run only lists them.
+func (o Options) cleanTemps() int {
+	roots := []string{o.Dest}
+	for _, root := range o.DestRoots {
+		roots = append(roots, root)
+	}
+	n := 0
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || seen[path] || !isLeftoverTemp(d.Name()) {
+				return nil
+			}
+			seen[path] = true
+			if o.DryRun {
+				fmt.Println("LEFTOVER TEMP (would remove):", path)
+				n++
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot remove leftover temporary file:", err)
+				return nil
+			}
+			if o.Verbose {
+				fmt.Println("REMOVED LEFTOVER TEMP:", path)
+			}
+			n++
+			return nil
+		})
+	}
+	return n
+}
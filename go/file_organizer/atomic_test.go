@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomicLeavesNothingOnError(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dest")
+	broken := errors.New("disk went away")
+	err := writeAtomic(dest, nil, func(w io.Writer) error {
+		if _, err := w.Write([]byte("half of it")); err != nil {
+			return err
+		}
+		return broken
+	})
+	if !errors.Is(err, broken) {
+		t.Fatalf("writeAtomic = %v, want the writer's error", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("%s left behind", e.Name())
+	}
+}
+
+func TestWriteAtomicKeepsOldFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dest")
+	if err := os.WriteFile(dest, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := writeAtomic(dest, nil, func(w io.Writer) error {
+		w.Write([]byte("new"))
+		return errors.New("cut off")
+	})
+	if err == nil {
+		t.Fatal("writeAtomic succeeded")
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "old" {
+		t.Errorf("dest = %q, want the old contents", b)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files in the folder, want only dest", len(entries))
+	}
+}
+
+func TestCopyFileCanceledLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(ctx, src, filepath.Join(out, "src")); err == nil {
+		t.Fatal("copyFile succeeded after cancel")
+	}
+	entries, _ := os.ReadDir(out)
+	for _, e := range entries {
+		t.Errorf("%s left behind", e.Name())
+	}
+}
+
+func TestIsLeftoverTemp(t *testing.T) {
+	for name, want := range map[string]bool{
+		".photo.jpg" + tempMarker + "0a1b2c3d": true,
+		".file_organizer-123.tmp":              true,
+		"photo.jpg":                            false,
+		".hidden":                              false,
+		"file_organizer-123.tmp":               false,
+	} {
+		if got := isLeftoverTemp(name); got != want {
+			t.Errorf("isLeftoverTemp(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
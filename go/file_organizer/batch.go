@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var batchOrders = map[string]bool{"oldest": true, "newest": true, "name": true, "largest": true, "smallest": true}
+
+// orderBatch sorts files in -batch-order so -max-files takes the same
+// batch in a dry-run and in the real run. Files that could not be stat'ed
+// go last.
+func orderBatch(files []fileEntry, order string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i].Info, files[j].Info
+		if a == nil || b == nil {
+			return a != nil
+		}
+		switch order {
+		case "newest":
+			return a.ModTime().After(b.ModTime())
+		case "name":
+			return files[i].Path < files[j].Path
+		case "largest":
+			return a.Size() > b.Size()
+		case "smallest":
+			return a.Size() < b.Size()
+		}
+		return a.ModTime().Before(b.ModTime())
+	})
+}
+
+// batchCursor is the -cursor file: files modified before Mtime were dealt
+// with by earlier -max-files runs and are not looked at again.
+type batchCursor struct {
+	path  string
+	Mtime time.Time `json:"mtime"`
+}
+
+func loadCursor(path string) (*batchCursor, error) {
+	c := &batchCursor{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// skip drops the files older than the cursor.
+func (c *batchCursor) skip(files []fileEntry) ([]fileEntry, int) {
+	if c == nil || c.Mtime.IsZero() {
+		return files, 0
+	}
+	kept := files[:0]
+	n := 0
+	for _, f := range files {
+		if f.Info != nil && f.Info.ModTime().Before(c.Mtime) {
+			n++
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, n
+}
+
+// save records t, replacing the file atomically. The cursor never moves
+// back, so a run that failed early does not undo earlier progress.
+func (c *batchCursor) save(t time.Time) error {
+	if c == nil || !t.After(c.Mtime) {
+		return nil
+	}
+	c.Mtime = t
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var destCaseModes = map[string]bool{"auto": true, "sensitive": true, "insensitive": true}
+
+// caseFolder remembers, per destination root, whether the filesystem
+// treats Report.PDF and report.pdf as the same name.
+type caseFolder struct {
+	mode   string // auto, sensitive or insensitive
+	dryRun bool
+
+	mu    sync.Mutex
+	roots map[string]bool
+}
+
+func newCaseFolder(mode string, dryRun bool) *caseFolder {
+	return &caseFolder{mode: mode, dryRun: dryRun, roots: make(map[string]bool)}
+}
+
+func (c *caseFolder) insensitive(root string) bool {
+	switch c.mode {
+	case "sensitive":
+		return false
+	case "insensitive":
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fold, ok := c.roots[root]
+	if !ok {
+		fold = c.probe(root)
+		c.roots[root] = fold
+	}
+	return fold
+}
+
+// probe checks an existing entry under its case-flipped name; only an
+// empty folder needs a temporary file. Without either it guesses from the
+// platform defaults (APFS, NTFS).
+func (c *caseFolder) probe(dir string) bool {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return platformFoldsCase()
+		}
+		dir = parent
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if flipped := flipCase(e.Name()); flipped != e.Name() {
+			return sameEntry(filepath.Join(dir, e.Name()), filepath.Join(dir, flipped))
+		}
+	}
+	if c.dryRun {
+		return platformFoldsCase()
+	}
+	f, err := os.CreateTemp(dir, "Organizer-Case-Probe-")
+	if err != nil {
+		return platformFoldsCase()
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+	return sameEntry(name, filepath.Join(dir, flipCase(filepath.Base(name))))
+}
+
+func sameEntry(a, b string) bool {
+	ai, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Lstat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+func flipCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+func platformFoldsCase() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// destKey is the form of a destination path used to detect collisions:
+// NFC unless -normalize-names none, lowercased when its root is
+// case-insensitive.
+func (o Options) destKey(path string) string {
+	if o.NormalizeNames != "none" {
+		path = composeNFC(path)
+	}
+	if o.Case == nil || !o.Case.insensitive(o.destRootOf(path)) {
+		return path
+	}
+	return strings.ToLower(path)
+}
+
+// destRootOf returns the -dest or -dest-for root holding path.
+func (o Options) destRootOf(path string) string {
+	best := ""
+	for _, root := range o.DestRoots {
+		if isWithin(path, root) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" && isWithin(path, o.Dest) {
+		best = o.Dest
+	}
+	if best == "" {
+		best = filepath.Dir(path)
+	}
+	return best
+}
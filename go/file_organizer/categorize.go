@@ -0,0 +1,558 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type patternRule struct {
+	Name     string
+	Pattern  string
+	Category string
+	Path     bool           // match against the path relative to -src instead of the base name
+	re       *regexp.Regexp // nil for glob rules
+}
+
+// category returns the rule's category for the file, expanding regex
+// capture groups ($1, ${name}) when the rule is a regex.
+func (r patternRule) category(name, rel string) (string, bool) {
+	subject := name
+	if r.Path {
+		subject = filepath.ToSlash(rel)
+	}
+
+	if r.re == nil {
+		ok, _ := path.Match(r.Pattern, subject)
+		return r.Category, ok
+	}
+
+	loc := r.re.FindStringSubmatchIndex(subject)
+	if loc == nil {
+		return "", false
+	}
+	if !strings.Contains(r.Category, "$") {
+		return r.Category, true
+	}
+	cat, err := cleanCategory(string(r.re.ExpandString(nil, r.Category, subject, loc)))
+	if err != nil {
+		return "", false
+	}
+	return cat, true
+}
+
+func (r patternRule) kind() string {
+	if r.re != nil {
+		return "regex"
+	}
+	return "glob"
+}
+
+type match struct {
+	Category   string
+	Via        string // what decided the category when it wasn't the extension table
+	UnknownExt string // set when the file fell through to the unknown category
+	SubExt     string // stands in for the extension when picking a subcategory
+	Kind       string // built-in category the file counts as when Category is not one (-by mime)
+	SniffErr   error
+}
+
+// kind is the built-in category a match stands for, which metadata layouts
+// key on.
+func (m match) kind() string {
+	if m.Kind != "" {
+		return m.Kind
+	}
+	return m.Category
+}
+
+var builtinCategories = []struct {
+	Category   string
+	Extensions []string
+}{
+	{"images", []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".bmp", ".tiff", ".tif", ".heic", ".heif",
+		".cr2", ".nef", ".arw", ".dng", ".orf", ".rw2", ".pef", ".srw"}},
+	{"videos", []string{".mp4", ".mov", ".mkv", ".avi", ".webm"}},
+	{"audio", []string{".mp3", ".wav", ".flac", ".aac", ".m4a", ".ogg", ".oga", ".opus", ".mka"}},
+	{"documents", []string{".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".txt", ".md"}},
+	{"archives", []string{".zip", ".tar", ".gz", ".tgz", ".rar", ".7z", ".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst"}},
+	{"code", []string{".go", ".py", ".js", ".ts", ".java", ".c", ".cpp", ".cs", ".html", ".css", ".json", ".yaml", ".yml", ".sh", ".user.js"}},
+	{"ebooks", []string{".epub", ".mobi", ".azw", ".azw3", ".fb2", ".djvu"}},
+	{"fonts", []string{".ttf", ".otf", ".woff", ".woff2", ".eot"}},
+	{"disk_images", []string{".iso", ".img", ".dmg", ".vdi", ".vmdk", ".vhd", ".vhdx", ".qcow2"}},
+	{"executables", []string{".exe", ".msi", ".apk", ".deb", ".rpm", ".appimage", ".pkg"}},
+	{"databases", []string{".sqlite", ".sqlite3", ".db"}},
+}
+
+var builtinFilenames = map[string]string{
+	"Makefile":       "code",
+	"GNUmakefile":    "code",
+	"makefile":       "code",
+	"Dockerfile":     "code",
+	"Containerfile":  "code",
+	"Jenkinsfile":    "code",
+	"Vagrantfile":    "code",
+	"Rakefile":       "code",
+	"Gemfile":        "code",
+	"Procfile":       "code",
+	"Justfile":       "code",
+	"CMakeLists.txt": "code",
+	"LICENSE":        "documents",
+	"LICENCE":        "documents",
+	"COPYING":        "documents",
+	"README":         "documents",
+	"CHANGELOG":      "documents",
+	"AUTHORS":        "documents",
+	"CONTRIBUTING":   "documents",
+	"NOTICE":         "documents",
+	"TODO":           "documents",
+}
+
+// builtinSubcategories lists the subfolders a category can be split into
+// when it is enabled via split (e.g. -split-code).
+var builtinSubcategories = map[string]map[string]string{
+	"code": {
+		".go":      "go",
+		".py":      "python",
+		".js":      "javascript",
+		".user.js": "javascript",
+		".ts":      "typescript",
+		".java":    "java",
+		".c":       "c",
+		".h":       "c",
+		".cpp":     "cpp",
+		".hpp":     "cpp",
+		".cs":      "csharp",
+		".html":    "web",
+		".css":     "web",
+		".sh":      "shell",
+		".rs":      "rust",
+		".rb":      "ruby",
+		".php":     "php",
+		".kt":      "kotlin",
+		".swift":   "swift",
+	},
+}
+
+// builtinScreenshots are anchored on the tool-generated prefix plus a date or
+// counter, so ordinary photos named "screenshot.png" or "IMG_0001" don't match.
+var builtinScreenshots = []struct{ Name, Pattern string }{
+	{"macOS", `^Screenshot \d{4}-\d{2}-\d{2} at \d{1,2}\.\d{2}\.\d{2}`},
+	{"macOS (legacy)", `^Screen Shot \d{4}-\d{2}-\d{2} at \d{1,2}\.\d{2}\.\d{2}`},
+	{"macOS (French)", `^Capture d['’]écran \d{4}-\d{2}-\d{2} à \d{1,2}\.\d{2}\.\d{2}`},
+	{"macOS (German)", `^Bildschirmfoto \d{4}-\d{2}-\d{2} um \d{1,2}\.\d{2}\.\d{2}`},
+	{"Windows", `^Screenshot \(\d+\)\.`},
+	{"Windows Snipping Tool", `^Screenshot \d{4}-\d{2}-\d{2} \d{6}\.`},
+	{"GNOME", `^Screenshot from \d{4}-\d{2}-\d{2} \d{2}-\d{2}-\d{2}`},
+	{"Android", `^Screenshot_\d{8}[-_]\d{6}`},
+	{"iOS/Android (legacy)", `^Screenshot_\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}`},
+}
+
+func builtinExtTable() map[string]string {
+	m := make(map[string]string)
+	for _, c := range builtinCategories {
+		for _, ext := range c.Extensions {
+			m[ext] = c.Category
+		}
+	}
+	return m
+}
+
+type categorizer struct {
+	builtin   map[string]string
+	ext       map[string]string
+	source    map[string]string // extension -> where its override came from
+	compounds []string          // multi-dot extensions, longest first
+	patterns  []patternRule
+	sniff     bool
+
+	names      map[string]string // exact base name -> category
+	lowerNames map[string]string // lowercased base name -> category
+	nameSource map[string]string
+	foldNames  bool // match names case-insensitively
+
+	dotfiles string // "category" or "strip"
+
+	unknown      string // fallback category, "other" by default
+	splitUnknown bool   // place unknown files under <unknown>/<ext>
+
+	subcategories map[string]map[string]string // category -> extension -> subfolder
+	split         map[string]bool              // categories whose subfolders are enabled
+
+	screenshots      []patternRule // checked for files that land in images
+	detectScreenshot bool
+	byOrigin         bool
+	byMIME           bool
+	mimeSubtypes     bool
+
+	sniffed map[string]string // path -> sniffed content type, see sniffFile
+
+	trace   []string // classification steps, recorded while tracing is set (explain)
+	tracing bool
+}
+
+func sourceNote(source string) string {
+	if source == "" {
+		return " (built-in)"
+	}
+	return " (from " + source + ")"
+}
+
+func (c *categorizer) tracef(format string, args ...any) {
+	if c.tracing {
+		c.trace = append(c.trace, fmt.Sprintf(format, args...))
+	}
+}
+
+func newCategorizer() *categorizer {
+	c := &categorizer{
+		builtin:    builtinExtTable(),
+		ext:        builtinExtTable(),
+		source:     make(map[string]string),
+		unknown:    "other",
+		split:      make(map[string]bool),
+		names:      make(map[string]string),
+		lowerNames: make(map[string]string),
+		nameSource: make(map[string]string),
+	}
+	c.subcategories = make(map[string]map[string]string)
+	for cat, table := range builtinSubcategories {
+		c.overrideSubcategories(cat, table)
+	}
+	for _, s := range builtinScreenshots {
+		r, err := newRegexRule(s.Name, s.Pattern, "screenshots", false)
+		if err != nil {
+			panic(err)
+		}
+		c.screenshots = append(c.screenshots, r)
+	}
+	for name, cat := range builtinFilenames {
+		c.names[name] = cat
+		c.lowerNames[strings.ToLower(name)] = cat
+	}
+	c.indexCompounds()
+	return c
+}
+
+func (c *categorizer) overrideNames(table map[string]string, source string) {
+	for name, cat := range table {
+		c.names[name] = cat
+		c.lowerNames[strings.ToLower(name)] = cat
+		c.nameSource[name] = source
+	}
+}
+
+func (c *categorizer) overrideSubcategories(category string, table map[string]string) {
+	if c.subcategories[category] == nil {
+		c.subcategories[category] = make(map[string]string)
+	}
+	for ext, sub := range table {
+		c.subcategories[category][ext] = sub
+	}
+}
+
+func (c *categorizer) categoryByName(name string) (string, bool) {
+	if cat, ok := c.names[name]; ok {
+		return cat, true
+	}
+	if c.foldNames {
+		if cat, ok := c.lowerNames[strings.ToLower(name)]; ok {
+			return cat, true
+		}
+	}
+	return "", false
+}
+
+func (c *categorizer) override(table map[string]string, source string) {
+	for ext, cat := range table {
+		c.ext[ext] = cat
+		c.source[ext] = source
+	}
+	c.indexCompounds()
+}
+
+// indexCompounds collects every extension with more than one dot
+// (".tar.gz", ".user.js") so they are tried before filepath.Ext.
+func (c *categorizer) indexCompounds() {
+	c.compounds = c.compounds[:0]
+	for ext := range c.ext {
+		if strings.Count(ext, ".") > 1 {
+			c.compounds = append(c.compounds, ext)
+		}
+	}
+	sort.Slice(c.compounds, func(i, j int) bool {
+		if len(c.compounds[i]) != len(c.compounds[j]) {
+			return len(c.compounds[i]) > len(c.compounds[j])
+		}
+		return c.compounds[i] < c.compounds[j]
+	})
+}
+
+// splitExt splits a file name into its stem and extension, keeping known
+// compound extensions intact: "project.v2.tar.gz" -> "project.v2", ".tar.gz".
+// The returned extension keeps the original case. A dotfile's leading dot is
+// part of the stem, so ".bashrc" has no extension.
+func (c *categorizer) splitExt(name string) (string, string) {
+	if isDotfile(name) {
+		stem, ext := c.splitExt(name[1:])
+		return "." + stem, ext
+	}
+	lower := strings.ToLower(name)
+	for _, comp := range c.compounds {
+		if len(lower) > len(comp) && strings.HasSuffix(lower, comp) {
+			i := len(name) - len(comp)
+			return name[:i], name[i:]
+		}
+	}
+	ext := filepath.Ext(name)
+	return name[:len(name)-len(ext)], ext
+}
+
+func isDotfile(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+func (c *categorizer) categoryByExt(ext string) string {
+	if cat, ok := c.ext[ext]; ok {
+		return cat
+	}
+	if ext == "" {
+		return "no_extension"
+	}
+	return c.unknown
+}
+
+// extFolder turns an extension into a safe folder name: ".XCF" -> "xcf".
+func extFolder(ext string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimLeft(ext, ".")) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// categorize picks the category for the file at path. Without a path
+// (archive entries, symlinks) only the name is looked at.
+func (c *categorizer) categorize(path, rel string) match {
+	name := filepath.Base(rel)
+	_, ext := c.splitExt(name)
+	ext = strings.ToLower(ext)
+	if strings.Count(ext, ".") > 1 {
+		c.tracef("compound extension %s", ext)
+	}
+
+	if c.byMIME {
+		return c.classifyMIME(path, rel, name, ext)
+	}
+	m := c.classify(path, rel, name, ext)
+	if m.SubExt != "" {
+		ext = m.SubExt
+	}
+	if c.split[m.Category] {
+		if sub, ok := c.subcategories[m.Category][ext]; ok {
+			c.tracef("subcategory table: %s -> %s/%s", ext, m.Category, sub)
+			m.Category = filepath.Join(m.Category, sub)
+		}
+	}
+	return m
+}
+
+func (c *categorizer) classify(path, rel, name, ext string) match {
+	for _, r := range c.patterns {
+		if cat, ok := r.category(name, rel); ok {
+			c.tracef("%s rule %s: matched -> %s", r.kind(), r.Name, cat)
+			return match{Category: cat, Via: "rule: " + r.Name}
+		}
+		c.tracef("%s rule %s: no match", r.kind(), r.Name)
+	}
+
+	if c.byOrigin && path != "" {
+		if host := downloadOrigin(path); host != "" {
+			c.tracef("download origin: %s", host)
+			return match{Category: filepath.Join("downloads", host), Via: "downloaded from " + host}
+		}
+		c.tracef("download origin: none recorded")
+	}
+
+	if cat, ok := c.categoryByName(name); ok {
+		c.tracef("filename table: %s -> %s", name, cat)
+		return match{Category: cat, Via: "filename table"}
+	}
+
+	if isDotfile(name) {
+		if c.dotfiles == "strip" {
+			if cat, ok := c.ext[ext]; ok {
+				c.tracef("dotfile stripped, extension table: %s -> %s", ext, cat)
+				return match{Category: cat, Via: "dotfile, by " + ext}
+			}
+		}
+		c.tracef("dotfile -> dotfiles")
+		return match{Category: "dotfiles", Via: "dotfile"}
+	}
+
+	if cat, ok := c.ext[ext]; ok {
+		c.tracef("extension table: %s -> %s%s", ext, cat, sourceNote(c.source[ext]))
+		if cat == "images" && c.detectScreenshot {
+			for _, r := range c.screenshots {
+				if cat, ok := r.category(name, rel); ok {
+					c.tracef("screenshot pattern %s: matched -> %s", r.Name, cat)
+					return match{Category: cat, Via: "screenshot: " + r.Name}
+				}
+			}
+			c.tracef("screenshot patterns: no match")
+		}
+		if (cat == "videos" || cat == "audio") && matroskaExts[ext] && path != "" {
+			if refined, via := containerCategory(path, cat); via != "" {
+				c.tracef("container probe: %s -> %s", via, refined)
+				return match{Category: refined, Via: via}
+			}
+		}
+		return match{Category: cat}
+	}
+	c.tracef("extension table: no entry for %q", ext)
+
+	if ext == "" && path != "" {
+		if interp := shebangInterpreter(path); interp != "" {
+			c.tracef("shebang: %s -> code", interp)
+			return match{Category: "code", Via: "shebang: " + interp, SubExt: shebangExts[interp]}
+		}
+	}
+
+	m := match{Category: c.categoryByExt(ext)}
+	if c.sniff && path != "" {
+		mime, err := c.sniffFile(path)
+		if err != nil {
+			c.tracef("sniff: %v", err)
+			m.SniffErr = err
+		} else if cat := categoryByMIME(mime); cat != "" {
+			c.tracef("sniff: %s -> %s", mime, cat)
+			m.Category = cat
+			m.Via = "sniffed as " + mime
+			return m
+		} else {
+			c.tracef("sniff: %s has no category", mime)
+		}
+	}
+	c.tracef("fallback -> %s", m.Category)
+
+	if ext != "" {
+		m.UnknownExt = ext
+		if dir := extFolder(ext); c.splitUnknown && dir != "" {
+			m.Category = filepath.Join(m.Category, dir)
+		}
+	}
+	return m
+}
+
+func newGlobRule(name, pattern, category string, usePath bool) (patternRule, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return patternRule{}, fmt.Errorf("empty pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return patternRule{}, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	cat, err := cleanCategory(category)
+	if err != nil {
+		return patternRule{}, err
+	}
+	if name == "" {
+		name = pattern
+	}
+	return patternRule{Name: name, Pattern: pattern, Category: cat, Path: usePath}, nil
+}
+
+var groupRef = regexp.MustCompile(`\$(\d+|\{\w+\}|\w+)`)
+
+func newRegexRule(name, pattern, category string, usePath bool) (patternRule, error) {
+	if pattern == "" {
+		return patternRule{}, fmt.Errorf("empty pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return patternRule{}, fmt.Errorf("invalid regex %q: %v", pattern, err)
+	}
+
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return patternRule{}, fmt.Errorf("empty category name")
+	}
+	for _, ref := range groupRef.FindAllStringSubmatch(category, -1) {
+		g := strings.Trim(ref[1], "{}")
+		if n, err := strconv.Atoi(g); err == nil {
+			if n > re.NumSubexp() {
+				return patternRule{}, fmt.Errorf("category %q refers to group $%d but regex %q has %d", category, n, pattern, re.NumSubexp())
+			}
+		} else if re.SubexpIndex(g) < 0 {
+			return patternRule{}, fmt.Errorf("category %q refers to unknown group %q in regex %q", category, g, pattern)
+		}
+	}
+	if !strings.Contains(category, "$") {
+		if category, err = cleanCategory(category); err != nil {
+			return patternRule{}, err
+		}
+	}
+
+	if name == "" {
+		name = pattern
+	}
+	return patternRule{Name: name, Pattern: pattern, Category: category, Path: usePath, re: re}, nil
+}
+
+// parseRuleFlag parses a -rule value of the form PATTERN=CATEGORY.
+// Patterns containing a slash are matched against the relative path.
+func parseRuleFlag(v string) (patternRule, error) {
+	i := strings.LastIndex(v, "=")
+	if i < 0 {
+		return patternRule{}, fmt.Errorf("-rule %q: expected PATTERN=CATEGORY", v)
+	}
+	pattern := strings.TrimSpace(v[:i])
+	r, err := newGlobRule("", pattern, v[i+1:], strings.Contains(pattern, "/"))
+	if err != nil {
+		return patternRule{}, fmt.Errorf("-rule %q: %v", v, err)
+	}
+	return r, nil
+}
+
+// parseMapFlags parses repeated -map .EXT=CATEGORY values. Giving the same
+// extension two different categories is an error rather than last-wins.
+func parseMapFlags(values []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("-map %q: expected .EXT=CATEGORY", v)
+		}
+		ext := strings.ToLower(strings.TrimSpace(v[:i]))
+		if !strings.HasPrefix(ext, ".") || ext == "." {
+			return nil, fmt.Errorf("-map %q: extension must start with a dot", v)
+		}
+		cat, err := cleanCategory(v[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("-map %q: %v", v, err)
+		}
+		if prev, ok := out[ext]; ok && prev != cat {
+			return nil, fmt.Errorf("-map %q conflicts with earlier -map %s=%s", v, ext, prev)
+		}
+		out[ext] = cat
+	}
+	return out, nil
+}
+
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
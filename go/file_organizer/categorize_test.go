@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRulePrecedence(t *testing.T) {
+	tests := []struct {
+		rules    []string
+		maps     []string
+		rel      string
+		want     string
+		wantRule string
+	}{
+		// the first matching rule wins, whichever is more specific
+		{[]string{"*invoice*.pdf=finance", "*.pdf=papers"}, nil, "march-invoice.pdf", "finance", "*invoice*.pdf"},
+		{[]string{"*.pdf=papers", "*invoice*.pdf=finance"}, nil, "march-invoice.pdf", "papers", "*.pdf"},
+		{[]string{"*invoice*.pdf=finance", "*.pdf=papers"}, nil, "report.pdf", "papers", "*.pdf"},
+		{[]string{"IMG_*.jpg=camera", "*.jpg=pictures"}, nil, "IMG_0001.jpg", "camera", "IMG_*.jpg"},
+		{[]string{"IMG_*.jpg=camera", "*.jpg=pictures"}, nil, "holiday.jpg", "pictures", "*.jpg"},
+		// a pattern with a slash matches the relative path, the others the name
+		{[]string{"scans/*.pdf=scans", "*.pdf=papers"}, nil, "scans/invoice.pdf", "scans", "scans/*.pdf"},
+		{[]string{"scans/*.pdf=scans", "*.pdf=papers"}, nil, "other/scans.pdf", "papers", "*.pdf"},
+		// rules come before the extension table and -map
+		{[]string{"*invoice*=finance"}, []string{".pdf=papers"}, "invoice.pdf", "finance", "*invoice*"},
+		{[]string{"*invoice*=finance"}, []string{".pdf=papers"}, "report.pdf", "papers", ""},
+		{[]string{"IMG_*.jpg=camera"}, nil, "notes.txt", "documents", ""},
+	}
+	for _, tt := range tests {
+		c := newCategorizer()
+		for _, v := range tt.rules {
+			r, err := parseRuleFlag(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.patterns = append(c.patterns, r)
+		}
+		overrides, err := parseMapFlags(tt.maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.override(overrides, "-map")
+
+		m := c.categorize("", tt.rel)
+		wantVia := ""
+		if tt.wantRule != "" {
+			wantVia = "rule: " + tt.wantRule
+		}
+		if m.Category != tt.want || m.Via != wantVia {
+			t.Errorf("rules %v, -map %v: %s -> %s (%q), want %s (%q)", tt.rules, tt.maps, tt.rel, m.Category, m.Via, tt.want, wantVia)
+		}
+	}
+}
+
+func TestCompoundExtensions(t *testing.T) {
+	c := newCategorizer()
+	c.override(map[string]string{".tar.lz4": "archives"}, "rules file")
+	tests := []struct {
+		name, stem, ext, category string
+	}{
+		{"project.v2.tar.gz", "project.v2", ".tar.gz", "archives"},
+		{"backup.tar.gz", "backup", ".tar.gz", "archives"},
+		{"notes.tar.bz2", "notes", ".tar.bz2", "archives"},
+		{"Site.v1.2.TAR.XZ", "Site.v1.2", ".TAR.XZ", "archives"},
+		{"dump.tar.lz4", "dump", ".tar.lz4", "archives"},
+		{"release.v2.gz", "release.v2", ".gz", "archives"},
+		{"report.v2.pdf", "report.v2", ".pdf", "documents"},
+		{"tar.gz", "tar", ".gz", "archives"},
+		{".tar.gz", ".tar", ".gz", "dotfiles"},
+	}
+	for _, tt := range tests {
+		stem, ext := c.splitExt(tt.name)
+		if stem != tt.stem || ext != tt.ext {
+			t.Errorf("splitExt(%q) = %q, %q; want %q, %q", tt.name, stem, ext, tt.stem, tt.ext)
+		}
+		if m := c.categorize("", tt.name); m.Category != tt.category {
+			t.Errorf("categorize(%q) = %s, want %s", tt.name, m.Category, tt.category)
+		}
+	}
+}
+
+func TestRenameKeepsCompoundExtension(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "project.v2.tar.gz")
+	for _, name := range []string{"project.v2.tar.gz", "project.v2_1.tar.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := newRenamer(defaultRenameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Categorizer: newCategorizer(), NormalizeNames: "nfc"}
+	got, err := r.next(o, dest, dest, time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "project.v2_2.tar.gz"); got != want {
+		t.Errorf("renamed to %s, want %s", got, want)
+	}
+}
+
+func TestBuiltinExtTable(t *testing.T) {
+	want := map[string][]string{
+		"images": {".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".bmp", ".tiff", ".tif", ".heic", ".heif",
+			".cr2", ".nef", ".arw", ".dng", ".orf", ".rw2", ".pef", ".srw"},
+		"videos":      {".mp4", ".mov", ".mkv", ".avi", ".webm"},
+		"audio":       {".mp3", ".wav", ".flac", ".aac", ".m4a", ".ogg", ".oga", ".opus", ".mka"},
+		"documents":   {".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".txt", ".md"},
+		"archives":    {".zip", ".tar", ".gz", ".tgz", ".rar", ".7z", ".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst"},
+		"code":        {".go", ".py", ".js", ".ts", ".java", ".c", ".cpp", ".cs", ".html", ".css", ".json", ".yaml", ".yml", ".sh", ".user.js"},
+		"ebooks":      {".epub", ".mobi", ".azw", ".azw3", ".fb2", ".djvu"},
+		"fonts":       {".ttf", ".otf", ".woff", ".woff2", ".eot"},
+		"disk_images": {".iso", ".img", ".dmg", ".vdi", ".vmdk", ".vhd", ".vhdx", ".qcow2"},
+		"executables": {".exe", ".msi", ".apk", ".deb", ".rpm", ".appimage", ".pkg"},
+		"databases":   {".sqlite", ".sqlite3", ".db"},
+	}
+	table := builtinExtTable()
+	c := newCategorizer()
+	n := 0
+	for cat, exts := range want {
+		for _, ext := range exts {
+			n++
+			if got := table[ext]; got != cat {
+				t.Errorf("table[%s] = %q, want %s", ext, got, cat)
+			}
+			if got := c.categoryByExt(ext); got != cat {
+				t.Errorf("categoryByExt(%s) = %s, want %s", ext, got, cat)
+			}
+		}
+	}
+	if len(table) != n {
+		t.Errorf("built-in table has %d extensions, the test knows %d", len(table), n)
+	}
+
+	for ext, cat := range map[string]string{".xyz": "other", ".docx2": "other", "": "no_extension"} {
+		if got := c.categoryByExt(ext); got != cat {
+			t.Errorf("categoryByExt(%q) = %s, want %s", ext, got, cat)
+		}
+	}
+}
+
+func TestBuiltinExtTableOverrides(t *testing.T) {
+	c := newCategorizer()
+	c.override(map[string]string{".pdf": "papers", ".xyz": "custom"}, "-map")
+	for ext, cat := range map[string]string{".pdf": "papers", ".xyz": "custom", ".doc": "documents"} {
+		if got := c.categoryByExt(ext); got != cat {
+			t.Errorf("categoryByExt(%s) = %s, want %s", ext, got, cat)
+		}
+	}
+	if c.builtin[".pdf"] != "documents" || builtinExtTable()[".pdf"] != "documents" {
+		t.Error("an override changed the built-in table")
+	}
+}
+
+// regexRules loads a rules file holding entries, a JSON array body.
+func regexRules(t testing.TB, entries string) (*ruleSet, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte("[\n"+entries+"\n]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return loadRules(path)
+}
+
+func TestRegexRules(t *testing.T) {
+	rules, err := regexRules(t, `
+		{"type": "regex", "pattern": "^(\\d{4})-\\d{2}-\\d{2}_backup", "category": "backups/$1"},
+		{"type": "regex", "name": "bills", "pattern": "^(?P<kind>invoice|receipt)_", "category": "documents/${kind}"},
+		{"type": "regex", "pattern": "^report-(\\w+)\\.", "category": "documents/$1"},
+		{"type": "regex", "pattern": "^scans/(\\w+)/", "match": "path", "category": "scans/$1"},
+		{"type": "regex", "pattern": "^(.*)_dir\\.txt$", "category": "documents/$1"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCategorizer()
+	c.patterns = rules.Patterns
+
+	tests := []struct {
+		rel, want, via string
+	}{
+		{"2024-01-02_backup.tar", "backups/2024", "rule: ^(\\d{4})-\\d{2}-\\d{2}_backup"},
+		{"old/2023-12-31_backup.zip", "backups/2023", "rule: ^(\\d{4})-\\d{2}-\\d{2}_backup"},
+		{"x_2024-01-02_backup.tar", "archives", ""}, // anchored on the name
+		{"invoice_march.pdf", "documents/invoice", "rule: bills"},
+		{"receipt_shop.jpg", "documents/receipt", "rule: bills"},
+		{"report-q3.xlsx", "documents/q3", "rule: ^report-(\\w+)\\."},
+		{"scans/2023/page.pdf", "scans/2023", "rule: ^scans/(\\w+)/"},
+		{"scans.pdf", "documents", ""},
+		{"other/scans/2023/page.pdf", "documents", ""}, // anchored on the path
+		// a capture cleanCategory refuses falls through instead of placing
+		{".._dir.txt", "dotfiles", "dotfile"},
+		{"notes_dir.txt", "documents/notes", "rule: ^(.*)_dir\\.txt$"},
+	}
+	for _, tt := range tests {
+		m := c.categorize("", filepath.FromSlash(tt.rel))
+		if m.Category != filepath.FromSlash(tt.want) || m.Via != tt.via {
+			t.Errorf("%s -> %s (%q), want %s (%q)", tt.rel, m.Category, m.Via, tt.want, tt.via)
+		}
+	}
+}
+
+func TestRegexRuleErrors(t *testing.T) {
+	tests := []struct {
+		entry, want string
+	}{
+		{`{"type": "regex", "pattern": "(unclosed", "category": "x"}`, `invalid regex "(unclosed"`},
+		{`{"type": "regex", "pattern": "a[", "category": "x"}`, `invalid regex "a["`},
+		{`{"type": "regex", "pattern": "^(a)", "category": "x/$2"}`, "refers to group $2"},
+		{`{"type": "regex", "pattern": "^a", "category": "x/$1"}`, "refers to group $1"},
+		{`{"type": "regex", "pattern": "^(?P<kind>a)", "category": "x/${nope}"}`, `unknown group "nope"`},
+		{`{"type": "regex", "pattern": "^a", "category": "../x"}`, `must not contain ".."`},
+		{`{"type": "regex", "pattern": "", "category": "x"}`, "empty pattern"},
+		{`{"type": "regex", "pattern": "^a", "category": " "}`, "empty category"},
+		{`{"type": "regex", "pattern": "^a", "match": "both", "category": "x"}`, `match "both"`},
+	}
+	for _, tt := range tests {
+		_, err := regexRules(t, tt.entry)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want one with %q", tt.entry, err, tt.want)
+		} else if !strings.Contains(err.Error(), "rules.json:2: entry 1") {
+			t.Errorf("%s: err = %v, want the file, line and entry", tt.entry, err)
+		}
+	}
+}
+
+// BenchmarkCategorizeRegex runs a few dozen regex rules, most of which
+// miss, over 100k generated names.
+func BenchmarkCategorizeRegex(b *testing.B) {
+	var entries []string
+	for i := 0; i < 40; i++ {
+		entries = append(entries, fmt.Sprintf(`{"type": "regex", "pattern": "^proj%02d_(\\w+)_\\d{4}-\\d{2}\\.log$", "category": "logs/$1"}`, i))
+	}
+	rules, err := regexRules(b, strings.Join(entries, ",\n"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := newCategorizer()
+	c.patterns = rules.Patterns
+
+	exts := []string{"jpg", "pdf", "log", "txt", "mp3"}
+	names := make([]string, 100000)
+	for i := range names {
+		names[i] = fmt.Sprintf("proj%02d_%s_2024-%02d.%s", i%50, []string{"web", "db", "api"}[i%3], i%12+1, exts[i%len(exts)])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range names {
+			c.categorize("", name)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(names)), "ns/name")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var conflictPolicies = map[string]bool{"skip": true, "overwrite": true, "rename": true, "newer": true, "error": true}
+
+// defaultMtimeTolerance absorbs coarse timestamps (FAT and exFAT keep 2s,
+// some network filesystems round to the second) when mtimes are compared.
+const defaultMtimeTolerance = 2 * time.Second
+
+// errConflict aborts the run under -on-conflict error.
+var errConflict = errors.New("destination conflict")
+
+// Conflict outcomes, as counted in the summary.
+const (
+	conflictSkipped     = "skipped"
+	conflictOverwritten = "overwritten"
+	conflictRenamed     = "renamed"
+	conflictNewer       = "replaced older"
+	conflictKept        = "kept newer"
+	conflictUpdated     = "updated"
+	conflictUpToDate    = "up to date"
+)
+
+// resolution is the outcome of resolveConflict for one file.
+type resolution struct {
+	Path    string // where to write, "" to leave the file alone
+	Outcome string // "" when there was no conflict
+	With    string // the file planned for the same destination earlier in this run
+	Asked   bool   // decided at an -interactive-conflicts prompt
+}
+
+// resolveConflict decides what happens when dest is already taken, either
+// on disk or by another file placed earlier in this run. Files planned in
+// this run are never overwritten: unless renaming, the later one is
+// skipped.
+func (o Options) resolveConflict(src string, srcTime time.Time, dest string, placed map[string]string) (resolution, error) {
+	prev, planned := placed[o.destKey(dest)]
+	info, err := os.Lstat(dest)
+	if !planned && err != nil {
+		return resolution{Path: dest}, nil
+	}
+
+	r := resolution{With: prev}
+	policy := o.OnConflict
+	if o.Prompter != nil && !planned {
+		if policy, err = o.Prompter.ask(dest, info, srcTime, o.MtimeTolerance); err != nil {
+			return r, err
+		}
+		r.Asked = true
+	}
+	switch {
+	case policy == "error":
+		row := conflictRowFor(src, dest)
+		row.PlannedBy, row.Policy, row.Outcome = prev, policy, "aborted"
+		o.Report.add(row)
+		if planned {
+			return r, fmt.Errorf("%w: %s and %s both go to %s (-on-conflict error)", errConflict, prev, src, dest)
+		}
+		return r, fmt.Errorf("%w: %s (-on-conflict error)", errConflict, dest)
+	case policy == "rename":
+		if r.Path, err = o.Renamer.next(o, dest, src, srcTime, placed); err != nil {
+			return r, err
+		}
+		// The taken name may be spelled differently (see normalizePath).
+		r.Path = filepath.Join(filepath.Dir(r.Path), o.normalizeName(filepath.Base(r.Path)))
+		if r.Path, err = o.fitNames(filepath.Dir(r.Path), r.Path); err != nil {
+			return r, err
+		}
+		r.Outcome = conflictRenamed
+	case planned:
+		r.Outcome = conflictSkipped
+	case policy == "overwrite":
+		r.Path, r.Outcome = dest, conflictOverwritten
+	case policy == "newer":
+		r.Outcome = conflictKept
+		if !srcTime.IsZero() && srcTime.After(info.ModTime().Add(o.MtimeTolerance)) {
+			r.Path, r.Outcome = dest, conflictNewer
+		}
+		if o.Update {
+			r.Outcome = map[string]string{conflictKept: conflictUpToDate, conflictNewer: conflictUpdated}[r.Outcome]
+		}
+	default:
+		r.Outcome = conflictSkipped
+	}
+	row := conflictRowFor(src, dest)
+	row.PlannedBy, row.Policy, row.Outcome, row.Final = prev, policy, r.Outcome, r.Path
+	o.Report.add(row)
+	return r, nil
+}
+
+// replaces reports whether the existing destination gets overwritten.
+func (r resolution) replaces() bool {
+	return r.Outcome == conflictOverwritten || r.Outcome == conflictNewer || r.Outcome == conflictUpdated
+}
+
+// reportConflict prints a resolved conflict. Clashes between files of the
+// same run are always shown; ones with existing files only in verbose and
+// dry-run output.
+func (o Options) reportConflict(src, dest string, r resolution) {
+	if r.Outcome == "" || (r.With == "" && !o.Verbose && !o.DryRun) {
+		return
+	}
+	how := r.Outcome
+	if r.Outcome == conflictRenamed {
+		how = "renamed to " + r.Path
+	}
+	if r.Asked {
+		how += " (asked)"
+	}
+	if r.With != "" {
+		fmt.Printf("CONFLICT: %s and %s -> %s, %s\n", r.With, src, dest, how)
+		return
+	}
+	fmt.Printf("CONFLICT: %s exists, %s\n", dest, how)
+}
+
+// identicalFile reports whether dest already holds the same bytes as src.
+// Nothing is hashed unless dest is a regular file of the same size.
+func identicalFile(src string, size int64, dest string) (bool, error) {
+	info, err := os.Lstat(dest)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return false, nil
+	}
+	a, err := hashFile(src, "sha256")
+	if err != nil {
+		return false, err
+	}
+	b, err := hashFile(dest, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return a == b, nil
+}
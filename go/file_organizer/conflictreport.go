@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conflictRow is one collision in the -conflict-report.
+type conflictRow struct {
+	Source        string `json:"source"`
+	Existing      string `json:"existing"`
+	PlannedBy     string `json:"planned_by,omitempty"` // set when the clash is with a file of this run
+	SourceSize    int64  `json:"source_size"`
+	ExistingSize  int64  `json:"existing_size"`
+	SourceMtime   string `json:"source_mtime,omitempty"`
+	ExistingMtime string `json:"existing_mtime,omitempty"`
+	Identical     bool   `json:"identical"`
+	Policy        string `json:"policy"`
+	Outcome       string `json:"outcome"`
+	Final         string `json:"final,omitempty"` // "" when the file was left alone
+}
+
+// conflictReport collects rows during the run and writes them at the end,
+// as JSON for a .json path and CSV otherwise.
+type conflictReport struct {
+	path string
+	mu   sync.Mutex
+	rows []conflictRow
+}
+
+func (r *conflictReport) add(row conflictRow) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, row)
+}
+
+// conflictRowFor fills the size and mtime columns from the two files as
+// they are now; a side that can't be stat'ed (archive entries, planned
+// files in dry-run) keeps zero values.
+func conflictRowFor(src, existing string) conflictRow {
+	row := conflictRow{Source: src, Existing: existing}
+	if info, err := os.Stat(src); err == nil {
+		row.SourceSize, row.SourceMtime = info.Size(), info.ModTime().Format(time.RFC3339)
+	}
+	if info, err := os.Stat(existing); err == nil {
+		row.ExistingSize, row.ExistingMtime = info.Size(), info.ModTime().Format(time.RFC3339)
+	}
+	return row
+}
+
+// write replaces the report file atomically (temp file and rename).
+func (r *conflictReport) write() error {
+	if r == nil {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if strings.EqualFold(filepath.Ext(r.path), ".json") {
+		rows := r.rows
+		if rows == nil {
+			rows = []conflictRow{}
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rows)
+	} else {
+		w := csv.NewWriter(f)
+		_ = w.Write([]string{"source", "existing", "planned_by", "source_size", "existing_size", "source_mtime", "existing_mtime", "identical", "policy", "outcome", "final"})
+		for _, row := range r.rows {
+			_ = w.Write([]string{row.Source, row.Existing, row.PlannedBy,
+				strconv.FormatInt(row.SourceSize, 10), strconv.FormatInt(row.ExistingSize, 10),
+				row.SourceMtime, row.ExistingMtime, strconv.FormatBool(row.Identical),
+				row.Policy, row.Outcome, row.Final})
+		}
+		w.Flush()
+		err = w.Error()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, r.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// deferredDeletes holds the sources removed by -deferred-delete once the
+// whole run has succeeded. Each entry is recorded in the manifest under its
+// final action when (and only when) the source is gone.
+type deferredDeletes struct {
+	entries []manifestEntry
+}
+
+func (d *deferredDeletes) add(e manifestEntry) {
+	d.entries = append(d.entries, e)
+}
+
+// finish deletes the sources if the run had no failures and wasn't
+// interrupted; otherwise every source is left in place next to its
+// verified copy.
+func (d *deferredDeletes) finish(complete bool, mf *manifest) (deleted, kept int) {
+	if !complete {
+		return 0, len(d.entries)
+	}
+	for _, e := range d.entries {
+		if err := verifySize(e.Src, e.Dest); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: keeping source:", err)
+			kept++
+			continue
+		}
+		if err := os.Remove(e.Src); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot delete source:", err)
+			kept++
+			continue
+		}
+		deleted++
+		if err := mf.record(e); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+		}
+	}
+	return deleted, kept
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// parseDestFor parses repeated -dest-for CATEGORY=DIR values into absolute
+// destination roots keyed by category.
+func parseDestFor(values []string, srcs []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("-dest-for %q: expected CATEGORY=DIR", v)
+		}
+		cat, err := cleanCategory(v[:i])
+		if err != nil {
+			return nil, fmt.Errorf("-dest-for %q: %v", v, err)
+		}
+		dir := strings.TrimSpace(v[i+1:])
+		if dir == "" {
+			return nil, fmt.Errorf("-dest-for %q: missing directory", v)
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("-dest-for %q: %v", v, err)
+		}
+		for _, src := range srcs {
+			if isWithin(abs, src) {
+				return nil, fmt.Errorf("-dest-for %q: %s is inside -src %s", v, abs, src)
+			}
+		}
+		if prev, ok := out[cat]; ok && prev != abs {
+			return nil, fmt.Errorf("-dest-for %q conflicts with earlier -dest-for %s=%s", v, cat, prev)
+		}
+		out[cat] = abs
+	}
+	return out, nil
+}
+
+// isWithin reports whether path is root or lies underneath it.
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// categoryDir returns the destination root used for a category and the
+// directory files of that category go to. A -dest-for override replaces
+// dest/<category>; subfolders of the category (other/xcf) stay beneath it.
+func (o Options) categoryDir(category string) (string, string) {
+	if root, ok := o.DestRoots[category]; ok {
+		return root, root
+	}
+	top, rest, _ := strings.Cut(category, string(filepath.Separator))
+	if root, ok := o.DestRoots[top]; ok {
+		return root, filepath.Join(root, rest)
+	}
+	return o.Dest, filepath.Join(o.Dest, category)
+}
+
+type rootUsage struct {
+	Files int
+	Bytes int64
+}
+
+type rootUsages map[string]*rootUsage
+
+func (u rootUsages) add(root string, size int64) {
+	r, ok := u[root]
+	if !ok {
+		r = &rootUsage{}
+		u[root] = r
+	}
+	r.Files++
+	r.Bytes += size
+}
+
+func printRootUsage(usage rootUsages) {
+	roots := make([]string, 0, len(usage))
+	for root := range usage {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	fmt.Println("By destination:")
+	for _, root := range roots {
+		u := usage[root]
+		fmt.Printf("  %s: %d files, %s\n", root, u.Files, formatBytes(u.Bytes))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
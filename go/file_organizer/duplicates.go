@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+type dupCandidate struct {
+	Path string
+	Sum  string // hashed lazily, only once a same-size file shows up
+}
+
+// dupIndex finds files whose content was already placed in this run or is
+// already in the destination category. Sizes are compared first so most
+// files are never hashed.
+type dupIndex struct {
+	bySize  map[int64][]*dupCandidate
+	scanned map[string]bool
+}
+
+func newDupIndex() *dupIndex {
+	return &dupIndex{bySize: make(map[int64][]*dupCandidate), scanned: make(map[string]bool)}
+}
+
+// scan indexes what a destination category directory already holds; each
+// directory is walked once per run.
+func (d *dupIndex) scan(dir string) {
+	if d.scanned[dir] {
+		return
+	}
+	d.scanned[dir] = true
+	_ = filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || !e.Type().IsRegular() {
+			return nil
+		}
+		if info, err := e.Info(); err == nil && info.Size() > 0 {
+			d.add(path, "", info.Size())
+		}
+		return nil
+	})
+}
+
+// find returns the path of an indexed file with the same content as path,
+// plus path's hash when it had to be computed. Empty files are never
+// treated as duplicates.
+func (d *dupIndex) find(path string, size int64) (string, string, error) {
+	cands := d.bySize[size]
+	if size == 0 || len(cands) == 0 {
+		return "", "", nil
+	}
+	sum, err := hashFile(path, "sha256")
+	if err != nil {
+		return "", "", err
+	}
+	for _, c := range cands {
+		if c.Path == path {
+			continue
+		}
+		if c.Sum == "" {
+			if c.Sum, err = hashFile(c.Path, "sha256"); err != nil {
+				continue
+			}
+		}
+		if c.Sum == sum {
+			return c.Path, sum, nil
+		}
+	}
+	return "", sum, nil
+}
+
+func (d *dupIndex) add(path, sum string, size int64) {
+	if size > 0 {
+		d.bySize[size] = append(d.bySize[size], &dupCandidate{Path: path, Sum: sum})
+	}
+}
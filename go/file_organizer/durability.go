@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var durabilityModes = map[string]bool{"full": true, "default": true, "none": true}
+
+// durability is -durability:
+//   - full syncs a folder after every file placed in or moved out of it;
+//   - default syncs each touched folder once, at the end of the run and
+//     before -deferred-delete removes sources, and always syncs the
+//     destination folder before a copied source is deleted;
+//   - none leaves it all, file data included, to the OS.
+var durability = "default"
+
+// pendingDirs are the folders whose entries changed since the last flush.
+var pendingDirs = make(map[string]bool)
+
+// syncData reports whether copies are fsynced before they are renamed.
+func syncData() bool {
+	return durability != "none"
+}
+
+// noteDir records that an entry of dir changed.
+func noteDir(dir string) {
+	switch durability {
+	case "full":
+		if err := syncDir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot sync folder:", err)
+		}
+	case "default":
+		pendingDirs[dir] = true
+	}
+}
+
+// flushDirs syncs the folders noted so far.
+func flushDirs() {
+	dirs := make([]string, 0, len(pendingDirs))
+	for dir := range pendingDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := syncDir(dir); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "WARN: cannot sync folder:", err)
+		}
+		delete(pendingDirs, dir)
+	}
+}
+
+// syncBeforeRemove makes the copy at dest durable before its source goes,
+// so a crash can't lose both.
+func syncBeforeRemove(dest string) error {
+	if durability == "none" {
+		return nil
+	}
+	dir := filepath.Dir(dest)
+	delete(pendingDirs, dir)
+	return syncDir(dir)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// BenchmarkMoveDurability organizes 200 small files per run with each
+// -durability mode, moving and copying; the README quotes its numbers.
+func BenchmarkMoveDurability(b *testing.B) {
+	const files = 200
+	for _, mode := range []string{"move", "copy"} {
+		for _, d := range []string{"full", "default", "none"} {
+			b.Run(mode+"/"+d, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					src, dest := b.TempDir(), b.TempDir()
+					for n := 0; n < files; n++ {
+						name := fmt.Sprintf("f%03d.%s", n, []string{"txt", "jpg", "mp3", "go"}[n%4])
+						if err := os.WriteFile(filepath.Join(src, name), []byte(strings.Repeat("x", 4096)), 0644); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.StartTimer()
+					if out, err := organize(b, "-src", src, "-dest", dest, "-mode", mode, "-durability", d); err != nil {
+						b.Fatalf("%v\n%s", err, out)
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Microseconds())/float64(b.N*files), "µs/file")
+			})
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxEXIFBlock caps how much of a file is loaded to find EXIF data. JPEG
+// APP1 segments are limited to 64 KiB anyway.
+const maxEXIFBlock = 256 << 10
+
+type exifInfo struct {
+	DateTaken time.Time
+	Make      string
+	Model     string
+
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+}
+
+var errNoEXIF = errors.New("no EXIF data")
+
+// readEXIF extracts the metadata we use from JPEG, TIFF-based raw files and
+// HEIC/HEIF without reading image data.
+func readEXIF(path string) (exifInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return exifInfo{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return exifInfo{}, errNoEXIF
+	}
+
+	var tiff []byte
+	switch {
+	case head[0] == 0xff && head[1] == 0xd8:
+		tiff, err = jpegEXIF(f)
+	case bytes.HasPrefix(head, []byte("II")) || bytes.HasPrefix(head, []byte("MM")):
+		tiff, err = readBlock(f, 0, maxEXIFBlock)
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		tiff, err = heifEXIF(f)
+	default:
+		return exifInfo{}, errNoEXIF
+	}
+	if err != nil {
+		return exifInfo{}, err
+	}
+	return parseTIFF(tiff)
+}
+
+func readBlock(r io.ReaderAt, off, n int64) ([]byte, error) {
+	if n < 0 || off < 0 {
+		return nil, errors.New("bad block range")
+	}
+	buf := make([]byte, n)
+	got, err := r.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:got], nil
+}
+
+// jpegEXIF walks the JPEG markers up to the first APP1 Exif segment and
+// stops there, or at the start of scan data.
+func jpegEXIF(f *os.File) ([]byte, error) {
+	pos := int64(2)
+	hdr := make([]byte, 4)
+	for {
+		if _, err := f.ReadAt(hdr, pos); err != nil {
+			return nil, errNoEXIF
+		}
+		if hdr[0] != 0xff {
+			return nil, errors.New("corrupt JPEG marker")
+		}
+		marker := hdr[1]
+		if marker == 0xda || marker == 0xd9 {
+			return nil, errNoEXIF
+		}
+		size := int64(binary.BigEndian.Uint16(hdr[2:]))
+		if size < 2 {
+			return nil, errors.New("corrupt JPEG segment")
+		}
+		if marker == 0xe1 {
+			seg, err := readBlock(f, pos+4, size-2)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+				return seg[6:], nil
+			}
+		}
+		pos += 2 + size
+	}
+}
+
+// heifEXIF finds the "Exif" item through the meta/iinf/iloc boxes.
+func heifEXIF(f *os.File) ([]byte, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, err := findBox(f, 0, end, "meta")
+	if err != nil {
+		return nil, errNoEXIF
+	}
+	if stop-start < 4 {
+		return nil, errNoEXIF
+	}
+	start += 4 // full box
+
+	meta, err := readBlock(f, start, min(stop-start, maxEXIFBlock))
+	if err != nil {
+		return nil, err
+	}
+
+	var id uint32
+	var found bool
+	if iinf := childBox(meta, "iinf"); iinf != nil {
+		id, found = heifExifItem(iinf)
+	}
+	if !found {
+		return nil, errNoEXIF
+	}
+	iloc := childBox(meta, "iloc")
+	if iloc == nil {
+		return nil, errNoEXIF
+	}
+	off, length, err := heifItemLocation(iloc, id)
+	if err != nil {
+		return nil, err
+	}
+	if length < 4 || length > maxEXIFBlock {
+		return nil, errors.New("bad Exif item size")
+	}
+	data, err := readBlock(f, off, length)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errors.New("bad Exif item header")
+	}
+	// The item starts with a 4-byte offset to the TIFF header.
+	skip := int64(binary.BigEndian.Uint32(data)) + 4
+	if skip > int64(len(data)) {
+		return nil, errors.New("bad Exif item header")
+	}
+	return data[skip:], nil
+}
+
+// childBox returns the content of the first child box called name.
+func childBox(b []byte, name string) []byte {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return nil
+		}
+		if string(b[4:8]) == name {
+			return b[8:size]
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+func heifExifItem(iinf []byte) (uint32, bool) {
+	if len(iinf) < 6 {
+		return 0, false
+	}
+	b := iinf[6:]
+	if iinf[0] != 0 {
+		if len(iinf) < 8 {
+			return 0, false
+		}
+		b = iinf[8:]
+	}
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return 0, false
+		}
+		infe := b[8:size]
+		b = b[size:]
+		if len(infe) < 4 || infe[0] < 2 {
+			continue
+		}
+		var id uint32
+		var typ []byte
+		if infe[0] == 2 && len(infe) >= 12 {
+			id = uint32(binary.BigEndian.Uint16(infe[4:]))
+			typ = infe[8:12]
+		} else if infe[0] >= 3 && len(infe) >= 14 {
+			id = binary.BigEndian.Uint32(infe[4:])
+			typ = infe[10:14]
+		}
+		if string(typ) == "Exif" {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func heifItemLocation(iloc []byte, want uint32) (int64, int64, error) {
+	errBad := errors.New("corrupt iloc box")
+	if len(iloc) < 8 {
+		return 0, 0, errBad
+	}
+	version := iloc[0]
+	offSize := int(iloc[4] >> 4)
+	lenSize := int(iloc[4] & 0x0f)
+	baseSize := int(iloc[5] >> 4)
+	idxSize := 0
+	if version == 1 || version == 2 {
+		idxSize = int(iloc[5] & 0x0f)
+	}
+	b := iloc[6:]
+
+	readN := func(n int) (uint64, bool) {
+		if n > len(b) {
+			return 0, false
+		}
+		var v uint64
+		for _, c := range b[:n] {
+			v = v<<8 | uint64(c)
+		}
+		b = b[n:]
+		return v, true
+	}
+
+	countSize := 2
+	if version == 2 {
+		countSize = 4
+	}
+	count, ok := readN(countSize)
+	if !ok {
+		return 0, 0, errBad
+	}
+	for i := uint64(0); i < count; i++ {
+		id, ok := readN(countSize)
+		if !ok {
+			return 0, 0, errBad
+		}
+		if version == 1 || version == 2 {
+			if _, ok := readN(2); !ok { // construction method
+				return 0, 0, errBad
+			}
+		}
+		if _, ok := readN(2); !ok { // data reference index
+			return 0, 0, errBad
+		}
+		base, ok := readN(baseSize)
+		if !ok {
+			return 0, 0, errBad
+		}
+		extents, ok := readN(2)
+		if !ok {
+			return 0, 0, errBad
+		}
+		for e := uint64(0); e < extents; e++ {
+			if _, ok := readN(idxSize); !ok {
+				return 0, 0, errBad
+			}
+			off, ok1 := readN(offSize)
+			length, ok2 := readN(lenSize)
+			if !ok1 || !ok2 {
+				return 0, 0, errBad
+			}
+			if uint32(id) == want && e == 0 {
+				return int64(base + off), int64(length), nil
+			}
+		}
+	}
+	return 0, 0, errNoEXIF
+}
+
+type tiffEntry struct {
+	Type  uint16
+	Count uint32
+	Value []byte
+}
+
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(b []byte) (exifInfo, error) {
+	var info exifInfo
+	if len(b) < 8 {
+		return info, errNoEXIF
+	}
+
+	t := tiffReader{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return info, errors.New("bad TIFF byte order")
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(b[4:]))
+	if err != nil {
+		return info, err
+	}
+
+	if e, ok := ifd0[0x010f]; ok {
+		info.Make = t.ascii(e)
+	}
+	if e, ok := ifd0[0x0110]; ok {
+		info.Model = t.ascii(e)
+	}
+
+	if e, ok := ifd0[0x8769]; ok {
+		exif, err := t.ifd(t.uint32(e))
+		if err != nil {
+			return info, err
+		}
+		for _, tag := range []uint16{0x9003, 0x9004} { // DateTimeOriginal, DateTimeDigitized
+			if e, ok := exif[tag]; ok {
+				if ts, err := parseEXIFTime(t.ascii(e)); err == nil {
+					info.DateTaken = ts
+					break
+				}
+			}
+		}
+	}
+	if e, ok := ifd0[0x8825]; ok {
+		if gps, err := t.ifd(t.uint32(e)); err == nil {
+			lat, ok1 := t.gpsCoord(gps[2], gps[1], "S")
+			lon, ok2 := t.gpsCoord(gps[4], gps[3], "W")
+			if ok1 && ok2 && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+				info.HasGPS, info.Latitude, info.Longitude = true, lat, lon
+			}
+		}
+	}
+	return info, nil
+}
+
+// gpsCoord converts a degrees/minutes/seconds rational triple and its
+// N/S or E/W reference into signed decimal degrees.
+func (t tiffReader) gpsCoord(value, ref tiffEntry, negative string) (float64, bool) {
+	if value.Type != 5 || len(value.Value) < 24 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num := t.order.Uint32(value.Value[i*8:])
+		den := t.order.Uint32(value.Value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	v := parts[0] + parts[1]/60 + parts[2]/3600
+	if strings.EqualFold(t.ascii(ref), negative) {
+		v = -v
+	}
+	return v, true
+}
+
+var tiffTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t tiffReader) ifd(off uint32) (map[uint16]tiffEntry, error) {
+	errBad := errors.New("corrupt EXIF directory")
+	if int64(off)+2 > int64(len(t.b)) {
+		return nil, errBad
+	}
+	n := int(t.order.Uint16(t.b[off:]))
+	if n > 1000 || int64(off)+2+int64(n)*12 > int64(len(t.b)) {
+		return nil, errBad
+	}
+
+	out := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		e := t.b[int(off)+2+i*12:]
+		tag := t.order.Uint16(e)
+		typ := t.order.Uint16(e[2:])
+		count := t.order.Uint32(e[4:])
+		size, ok := tiffTypeSize[typ]
+		if !ok || count > 1<<16 {
+			continue
+		}
+		total := size * count
+		var val []byte
+		if total <= 4 {
+			val = e[8 : 8+total]
+		} else {
+			at := t.order.Uint32(e[8:])
+			if int64(at)+int64(total) > int64(len(t.b)) {
+				continue
+			}
+			val = t.b[at : at+total]
+		}
+		out[tag] = tiffEntry{Type: typ, Count: count, Value: val}
+	}
+	return out, nil
+}
+
+func (t tiffReader) uint32(e tiffEntry) uint32 {
+	switch {
+	case e.Type == 3 && len(e.Value) >= 2:
+		return uint32(t.order.Uint16(e.Value))
+	case len(e.Value) >= 4:
+		return t.order.Uint32(e.Value)
+	}
+	return 0
+}
+
+func (t tiffReader) ascii(e tiffEntry) string {
+	s, _, _ := strings.Cut(string(e.Value), "\x00")
+	return strings.TrimSpace(s)
+}
+
+func parseEXIFTime(s string) (time.Time, error) {
+	if s == "" || strings.HasPrefix(s, "0000") {
+		return time.Time{}, fmt.Errorf("empty EXIF date")
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+}
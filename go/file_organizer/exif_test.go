@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadEXIFTruncatedHEIC(t *testing.T) {
+	// a meta box without the 4-byte full box header or any children
+	path := filepath.Join(t.TempDir(), "cut.heic")
+	fixture := "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00heicmif1\x00\x00\x00\x08meta"
+	if err := os.WriteFile(path, []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readEXIF(path); !errors.Is(err, errNoEXIF) {
+		t.Fatalf("readEXIF = %v, want errNoEXIF", err)
+	}
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	o := Options{PhotoLayout: []string{"date"}, PhotoDateFormat: "2006/2006-01", TimeSource: "mtime"}
+	dir, note := o.photoDir(path)
+	if dir != filepath.Join("2021", "2021-03") || !strings.Contains(note, "mtime") {
+		t.Fatalf("photoDir = %q, %q; want the mtime folder", dir, note)
+	}
+}
+
+func TestReadBlockRejectsNegativeLength(t *testing.T) {
+	if _, err := readBlock(strings.NewReader("abc"), 0, -4); err == nil {
+		t.Fatal("readBlock with a negative length succeeded")
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// explainSkipped is the exit status of explain when the file would be left
+// alone, so scripts can tell it apart from errors (1).
+const explainSkipped = 2
+
+// explain prints how one file would be categorized and where it would go
+// under the current flags. It only stats the file and reads the headers
+// the classification steps need. The returned reason is empty when the
+// file would be placed.
+func (o Options) explain(path string) (skip string, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("File:", path)
+	fmt.Printf("Stat: %s, %s, modified %s\n", info.Mode(), formatBytes(info.Size()), info.ModTime().Format(time.RFC3339))
+
+	root := ""
+	for _, src := range o.Sources {
+		if isWithin(path, src) {
+			root = src
+			break
+		}
+	}
+	if root == "" {
+		if o.FilesFrom == "" {
+			return "not under any -src, a scan would not find it", nil
+		}
+		root = filepath.Dir(path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Source: %s (relative path %s)\n", root, rel)
+
+	if filepath.Dir(rel) != "." && !o.Recursive && o.FilesFrom == "" {
+		return "in a subfolder of -src and -recursive is off", nil
+	}
+	for dir := range o.Excluded {
+		if isWithin(path, dir) {
+			return "inside destination folder " + dir + ", which the scan skips (-rescan-organized)", nil
+		}
+	}
+	if o.Recursive && len(o.ProjectMarkers) > 0 {
+		for dir := filepath.Dir(path); dir != root && isWithin(dir, root); dir = filepath.Dir(dir) {
+			if m := projectMarker(dir, o.ProjectMarkers); m != "" {
+				return fmt.Sprintf("inside project %s [marker: %s], handled by -projects %s as a whole", dir, m, o.Projects), nil
+			}
+		}
+	}
+	if info.IsDir() {
+		if o.Recursive && len(o.ProjectMarkers) > 0 {
+			if m := projectMarker(path, o.ProjectMarkers); m != "" && o.Projects == "move" {
+				_, dir := o.categoryDir("projects")
+				fmt.Printf("Project [marker: %s] -> %s\n", m, filepath.Join(dir, filepath.Base(path)))
+				return "", nil
+			}
+		}
+		return "directories are not organized", nil
+	}
+	if data := strings.TrimSuffix(path, sidecarSuffix); data != path {
+		if _, err := os.Lstat(data); err == nil {
+			return "sidecar of " + data + ", placed along with it (explain that file instead)", nil
+		}
+	}
+	special := specialKind(info.Mode())
+	if special != "" && !o.renamesSpecial() {
+		return special + ", never read or copied (-special-files rename with -mode move to rename it)", nil
+	}
+	if o.FilesFrom != "" && !info.Mode().IsRegular() {
+		return "not a regular file (-files-from only takes regular files)", nil
+	}
+	if o.isJunk(filepath.Base(path)) {
+		return "OS leftover file (-no-default-ignores to organize it)", nil
+	}
+	if len(o.Include) > 0 && !o.Include.matches(rel) {
+		return "not matching any -include pattern", nil
+	}
+	if o.Exclude.excludes(rel) {
+		return "matches an -exclude pattern", nil
+	}
+	if !o.matchSelects(rel) {
+		return "filtered by -match/-not-match", nil
+	}
+	if !o.sizeSelects(info.Size()) {
+		return "outside the -min-size/-max-size bounds", nil
+	}
+	if kind := placeholderKind(info); kind != "" && (o.Placeholders == "skip" || (kind == "cloud" && o.Placeholders == "category" && o.Mode == "copy")) {
+		return kind + " placeholder, left in place (-placeholders " + o.Placeholders + ")", nil
+	}
+	if !o.ownerSelects(fileEntry{Path: path, Info: info}) {
+		return "not owned by the -owner/-group given", nil
+	}
+	if !o.settled(info, time.Now()) {
+		return fmt.Sprintf("modified %s ago, within -settle %s", time.Since(info.ModTime()).Round(time.Second), o.Settle), nil
+	}
+	if t, source := o.fileTime(path, info); !o.timeSelects(t) {
+		return fmt.Sprintf("%s %s is outside -since/-before", source, t.Format(time.RFC3339)), nil
+	}
+
+	if len(o.IncludeMIME) > 0 {
+		mime, err := sniffFile(path)
+		if err != nil {
+			return "cannot be sniffed for -include-mime: " + err.Error(), nil
+		}
+		if !o.IncludeMIME.matches(mime) {
+			return "content type " + mime + " doesn't match -include-mime", nil
+		}
+		fmt.Println("Content type:", mime)
+	}
+	var m match
+	hinted := false
+	if _, err := os.Lstat(path + sidecarSuffix); err == nil {
+		fmt.Println("Sidecar:", path+sidecarSuffix)
+		m, hinted = sidecarMatch(path + sidecarSuffix)
+	}
+	kind := placeholderKind(info)
+	symlink := isSymlink(info) && !o.FollowSymlinks
+	switch {
+	case hinted:
+		// the sidecar moves along, as <dest>.organizer.json
+	case kind != "" && o.Placeholders == "category":
+		m = match{Category: placeholderCategory, Via: kind + " placeholder"}
+	case symlink, special != "":
+		m = o.Categorizer.categorize("", rel)
+		m.Via = joinNotes(m.Via, cmp.Or(special, "symlink")+", by name")
+	default:
+		o.Categorizer.tracing = true
+		m = o.Categorizer.categorize(path, rel)
+		o.Categorizer.tracing = false
+		fmt.Println("Classification:")
+		for i, step := range o.Categorizer.trace {
+			fmt.Printf("  %d. %s\n", i+1, step)
+		}
+	}
+	via := ""
+	if m.Via != "" {
+		via = " [" + m.Via + "]"
+	}
+	fmt.Printf("Category: %s%s\n", m.Category, via)
+	if !o.Scope.includes(m.Category) {
+		return "category " + m.Category + " is out of scope (-only-categories/-skip-categories)", nil
+	}
+
+	var notes []string
+	if o.MinCategory > 1 {
+		notes = append(notes, fmt.Sprintf("-min-category %d depends on the whole run; %s may be folded into %s", o.MinCategory, topCategory(m.Category), miscCategory))
+	}
+	if o.DuplicatesTo != "" {
+		notes = append(notes, "-duplicates-to needs content hashes and is only checked during a run")
+	}
+
+	var when time.Time
+	if o.DateDirs || (o.Layout != nil && o.Layout.usesDate()) {
+		var source string
+		when, source = o.fileTime(path, info)
+		notes = append(notes, "time: "+source+" "+when.Format(time.RFC3339))
+	}
+	pl, err := o.place(path, rel, m, info, when, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if pl.ProbeErr != nil {
+		notes = append(notes, "probe failed: "+pl.ProbeErr.Error())
+	}
+	for _, n := range []string{pl.AgeNote, pl.LayoutNote} {
+		if n != "" {
+			notes = append(notes, n)
+		}
+	}
+	if pl.SizeBucket != "" {
+		notes = append(notes, "size: "+pl.SizeBucket)
+	}
+
+	destDir, destPath := pl.Dir, pl.Path
+	newName, nameNote := o.metadataName(path, filepath.Base(destPath), m, info)
+	if newName != "" {
+		destPath = filepath.Join(destDir, newName)
+	}
+	if nameNote != "" {
+		notes = append(notes, nameNote)
+	}
+	if o.SanitizeNames {
+		destPath = filepath.Join(destDir, o.slugName(filepath.Base(destPath)))
+	}
+	if norm, existing := o.normalizePath(pl.Root, destPath); norm != destPath {
+		if existing != "" {
+			notes = append(notes, "existing spelling: "+filepath.Base(existing))
+		}
+		destPath, destDir = norm, filepath.Dir(norm)
+	}
+	if safe := o.windowsSafePath(pl.Root, destPath); safe != destPath {
+		notes = append(notes, "windows-safe: "+filepath.Base(destPath))
+		destPath, destDir = safe, filepath.Dir(safe)
+	}
+	if fit, err := o.fitNames(pl.Root, destPath); err != nil {
+		return "", err
+	} else if fit != destPath {
+		notes = append(notes, "shortened from "+filepath.Base(destPath))
+		destPath, destDir = fit, filepath.Dir(fit)
+	}
+	if o.Shard != nil {
+		name := filepath.Base(destPath)
+		if o.Shard.Mode == "hash" {
+			notes = append(notes, "hash shard folders are computed from the content during a run")
+		} else {
+			destDir = filepath.Join(destDir, firstLetterShard(name))
+			destPath = filepath.Join(destDir, name)
+		}
+	}
+	if o.Limiter != nil {
+		destDir = o.Limiter.assign(destDir)
+		destPath = filepath.Join(destDir, filepath.Base(destPath))
+	}
+
+	fmt.Println("Destination:", destPath)
+	for _, n := range notes {
+		fmt.Println("  " + n)
+	}
+	if symlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Println("Symlink to:", linkTarget(path, destPath, target, o.SymlinkTargets == "adjust"))
+		if resolvedPath(path) == resolvedPath(destPath) {
+			return "already at its destination", nil
+		}
+	} else if sameFile(path, destPath) {
+		return "already at its destination", nil
+	}
+	if !symlink {
+		same, err := identicalFile(path, info.Size(), destPath)
+		if err != nil {
+			return "", err
+		}
+		if same && o.DeleteIdentical {
+			return "destination has identical content, the source would be deleted", nil
+		}
+		if same {
+			return "destination has identical content", nil
+		}
+	}
+	res, err := o.resolveConflict(path, info.ModTime(), destPath, nil)
+	if errors.Is(err, errConflict) {
+		return "destination exists, -on-conflict error would abort the run", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if res.Outcome != "" {
+		fmt.Printf("Conflict: destination exists, %s (-on-conflict %s)\n", res.Outcome, o.OnConflict)
+		if o.KeepReplaced && res.Path == destPath {
+			fmt.Println("  the existing file would be kept under", filepath.Join(replacedRoot(o.Dest), o.RunID))
+		}
+	}
+	if res.Path == "" {
+		return "destination exists", nil
+	}
+	if res.Path != destPath {
+		fmt.Println("Renamed to:", res.Path)
+	}
+	return "", nil
+}
+
+func runExplain(o Options, path string) int {
+	skip, err := o.explain(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+	if skip != "" {
+		fmt.Println("Result: skipped:", skip)
+		return explainSkipped
+	}
+	fmt.Printf("Result: would %s\n", strings.ToLower(o.Mode))
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// readFileList reads the -files-from paths, newline- or NUL-delimited. Each
+// file is placed relative to the -src it lies under, or to its own parent
+// folder otherwise. Entries that don't exist or aren't regular files are
+// reported and counted, not returned.
+func readFileList(r io.Reader, nul bool, sources []string) ([]fileEntry, int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	if nul {
+		sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		})
+	}
+
+	var out []fileEntry
+	invalid := 0
+	for sc.Scan() {
+		line := sc.Text()
+		if !nul {
+			line = string(bytes.TrimRight([]byte(line), "\r"))
+		}
+		if line == "" {
+			continue
+		}
+		path, err := filepath.Abs(line)
+		if err != nil {
+			invalid++
+			fmt.Fprintln(os.Stderr, "WARN: bad path", line, ":", err)
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			invalid++
+			fmt.Fprintln(os.Stderr, "WARN: skipping", path, ":", err)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			invalid++
+			fmt.Fprintln(os.Stderr, "WARN: skipping", path, ": not a regular file")
+			continue
+		}
+		root := filepath.Dir(path)
+		for _, src := range sources {
+			if isWithin(path, src) {
+				root = src
+				break
+			}
+		}
+		out = append(out, fileEntry{Root: root, Path: path, Info: info})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, invalid, err
+	}
+	return out, invalid, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+var timeSources = map[string]bool{"mtime": true, "ctime": true, "birth": true}
+
+// timeFallbackWarned keeps the mtime fallback warning to one per source.
+var timeFallbackWarned = make(map[string]bool)
+
+// fileTime returns the timestamp used for date-based placement and the
+// source it actually came from, which is "mtime" when the requested one
+// isn't available for this file or platform.
+func (o Options) fileTime(path string, info os.FileInfo) (time.Time, string) {
+	if o.TimeSource == "mtime" {
+		return info.ModTime(), "mtime"
+	}
+	if t, ok := platformTime(path, info, o.TimeSource); ok {
+		return t, o.TimeSource
+	}
+	if !timeFallbackWarned[o.TimeSource] {
+		timeFallbackWarned[o.TimeSource] = true
+		fmt.Fprintf(os.Stderr, "WARN: %s not available (first seen on %s), falling back to mtime\n", o.TimeSource, path)
+	}
+	return info.ModTime(), "mtime"
+}
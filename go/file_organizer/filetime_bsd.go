@@ -0,0 +1,31 @@
+//go:build darwin || freebsd || netbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func platformTime(path string, info os.FileInfo, source string) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch source {
+	case "ctime":
+		return time.Unix(st.Ctimespec.Unix()), true
+	case "birth":
+		return time.Unix(st.Birthtimespec.Unix()), true
+	}
+	return time.Time{}, false
+}
+
+func accessTime(info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atimespec.Unix()), true
+}
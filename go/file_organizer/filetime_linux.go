@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// statxTrap holds the statx syscall number per architecture; the syscall
+// package predates statx and doesn't export it.
+var statxTrap = map[string]uintptr{
+	"amd64":   332,
+	"386":     383,
+	"arm":     397,
+	"arm64":   291,
+	"riscv64": 291,
+	"loong64": 291,
+	"ppc64":   383,
+	"ppc64le": 383,
+	"s390x":   379,
+}
+
+const (
+	atFDCWD         = -0x64
+	atSymlinkNofoll = 0x100
+	statxBtime      = 0x800
+)
+
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+type statxBuf struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	UID            uint32
+	GID            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	_              [128]byte
+}
+
+func platformTime(path string, info os.FileInfo, source string) (time.Time, bool) {
+	switch source {
+	case "ctime":
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return time.Time{}, false
+		}
+		return time.Unix(st.Ctim.Unix()), true
+	case "birth":
+		return statxBirth(path)
+	}
+	return time.Time{}, false
+}
+
+// statxBirth asks statx for the birth time, which only some kernels and
+// filesystems report.
+func statxBirth(path string) (time.Time, bool) {
+	trap, ok := statxTrap[runtime.GOARCH]
+	if !ok {
+		return time.Time{}, false
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var buf statxBuf
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(trap, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+		atSymlinkNofoll, statxBtime, uintptr(unsafe.Pointer(&buf)), 0)
+	if errno != 0 || buf.Mask&statxBtime == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(buf.Btime.Sec, int64(buf.Btime.Nsec)), true
+}
+
+func accessTime(info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atim.Unix()), true
+}
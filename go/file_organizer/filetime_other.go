@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func platformTime(path string, info os.FileInfo, source string) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func accessTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// platformTime only knows the creation time on Windows; the change time
+// needs a handle-based API and falls back to mtime.
+func platformTime(path string, info os.FileInfo, source string) (time.Time, bool) {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || source != "birth" {
+		return time.Time{}, false
+	}
+	return time.Unix(0, d.CreationTime.Nanoseconds()), true
+}
+
+func accessTime(info os.FileInfo) (time.Time, bool) {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, d.LastAccessTime.Nanoseconds()), true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// systemFolders are never organized without -force-root, along with
+// filesystem roots, the home directory and the folder holding the homes.
+var systemFolders = []string{
+	"/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt", "/proc", "/sbin", "/sys", "/usr", "/var",
+	"/Applications", "/Library", "/System", "/Users",
+}
+
+// checkRiskySource refuses a -src that one bad variable could have turned
+// into a disaster, e.g. -src $UNSET/ or -src $HOME. It names the guard
+// that fired.
+func checkRiskySource(src string) error {
+	real := src
+	if p, err := filepath.EvalSymlinks(src); err == nil {
+		real = p
+	}
+	if filepath.Dir(real) == real {
+		return fmt.Errorf("-src %s is the root of a filesystem; organize a folder inside it, or pass -force-root if you really mean it", src)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil
+	}
+	is := func(p string) bool {
+		other, err := os.Stat(p)
+		return p != "" && err == nil && os.SameFile(info, other)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if is(home) {
+			return fmt.Errorf("-src %s is your home directory itself; organize a folder inside it, or pass -force-root if you really mean it", src)
+		}
+		if is(filepath.Dir(home)) {
+			return fmt.Errorf("-src %s holds every user's home directory; pass -force-root if you really mean it", src)
+		}
+	}
+	folders := systemFolders
+	for _, env := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)", "ProgramData"} {
+		folders = append(folders, os.Getenv(env))
+	}
+	for _, p := range folders {
+		if is(p) {
+			return fmt.Errorf("-src %s is the system folder %s; pass -force-root if you really mean it", src, p)
+		}
+	}
+	return nil
+}
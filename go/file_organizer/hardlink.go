@@ -0,0 +1,22 @@
+package main
+
+var hardlinkModes = map[string]bool{"link": true, "skip": true, "copy": true}
+
+// inodeKey identifies a file across its hard links.
+type inodeKey struct {
+	Dev, Ino uint64
+}
+
+// linkTracker remembers where the first path to each multiply-linked
+// source file went, so later paths to it can become links to that copy.
+type linkTracker struct {
+	mode string // link, skip or copy (no tracking)
+	dest map[inodeKey]string
+}
+
+func newLinkTracker(mode string) *linkTracker {
+	if mode == "copy" {
+		return nil
+	}
+	return &linkTracker{mode: mode, dest: make(map[inodeKey]string)}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+func inodeOf(path string, info os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
+
+func fileID(path string, info os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
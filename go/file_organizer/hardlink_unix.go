@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the identity of a file with more than one hard link.
+func inodeOf(path string, info os.FileInfo) (inodeKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inodeKey{}, false
+	}
+	return fileID(path, info)
+}
+
+// fileID returns the device and inode of any file or folder.
+func fileID(path string, info os.FileInfo) (inodeKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inodeKey{}, false
+	}
+	return inodeKey{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, true
+}
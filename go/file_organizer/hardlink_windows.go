@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the identity of a file with more than one hard link.
+func inodeOf(path string, info os.FileInfo) (inodeKey, bool) {
+	key, links, ok := handleInfo(path)
+	return key, ok && links >= 2
+}
+
+// fileID returns the identity of any file or folder.
+func fileID(path string, info os.FileInfo) (inodeKey, bool) {
+	key, _, ok := handleInfo(path)
+	return key, ok
+}
+
+// handleInfo reads the volume serial number and file index, which
+// FileInfo doesn't carry, and the number of links.
+func handleInfo(path string) (inodeKey, uint32, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return inodeKey{}, 0, false
+	}
+	defer f.Close()
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+		return inodeKey{}, 0, false
+	}
+	return inodeKey{Dev: uint64(d.VolumeSerialNumber), Ino: uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)}, d.NumberOfLinks, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"testing"
+)
+
+// organize runs the tool with args as on the command line and returns
+// what it printed. The settings parseFlags keeps in package variables are
+// put back afterwards.
+func organize(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+	savedArgs, savedFlags := os.Args, flag.CommandLine
+	perms, times, xattrs, owner := preservePerms, preserveTimes, preserveXattrs, preserveOwner
+	savedDurability, savedKeepBoth := durability, keepBothCopies
+	defer func() {
+		os.Args, flag.CommandLine = savedArgs, savedFlags
+		preservePerms, preserveTimes, preserveXattrs, preserveOwner = perms, times, xattrs, owner
+		durability, keepBothCopies = savedDurability, savedKeepBoth
+	}()
+
+	os.Args = append([]string{"file-organizer"}, args...)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	var o Options
+	var err error
+	out := capture(t, &os.Stdout, func() {
+		o, err = parseFlags(false)
+		if err == nil {
+			err = run(context.Background(), o)
+		}
+	})
+	return out, err
+}
+
+// capture returns what fn writes to *file, os.Stdout or os.Stderr.
+func capture(t testing.TB, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	defer func() { *file = saved }()
+	fn()
+	w.Close()
+	return <-done
+}
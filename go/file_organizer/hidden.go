@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// isHidden reports whether a scanned entry is hidden: a dotfile anywhere,
+// plus the platform's hidden flag (see hiddenAttr).
+func isHidden(d os.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".") || hiddenAttr(d)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const ufHidden = 0x8000 // UF_HIDDEN, set by chflags hidden and the Finder
+
+func hiddenAttr(d os.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Flags&ufHidden != 0
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os"
+
+func hiddenAttr(d os.DirEntry) bool {
+	return false
+}
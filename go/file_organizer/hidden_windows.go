@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// hiddenAttr checks FILE_ATTRIBUTE_HIDDEN, which the directory listing
+// already returned.
+func hiddenAttr(d os.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	a, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && a.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
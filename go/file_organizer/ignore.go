@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFileName = ".organizerignore"
+
+// ignoreRule is one line of an .organizerignore file, gitignore style:
+// "#" comments, "!" re-includes, a trailing "/" only matches folders, and
+// a pattern with a "/" in it (other than a trailing one) is relative to the
+// file's folder; otherwise it matches a base name at any depth.
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	base     string // folder of the ignore file, relative to -src ("" at the root)
+	source   string // file:line and the line, for -verbose
+}
+
+// ignoreRules holds the rules of every ignore file met so far in a walk.
+// Later rules win, so deeper files override shallower ones.
+type ignoreRules []ignoreRule
+
+// load reads the ignore file name in dir, if any; its rules apply below
+// rel, relative to -src.
+func (rs *ignoreRules) load(dir, rel, name string) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if rel == "." {
+		rel = ""
+	}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		r, ok := parseIgnoreLine(sc.Text())
+		if !ok {
+			continue
+		}
+		r.base = filepath.ToSlash(rel)
+		where := fmt.Sprintf("%s:%d", filepath.Join(dir, name), n)
+		if err := validGlob(r.pattern); err != nil {
+			return fmt.Errorf("%s: bad pattern %q: %v", where, sc.Text(), err)
+		}
+		r.source = where + " " + strings.TrimSpace(sc.Text())
+		*rs = append(*rs, r)
+	}
+	return sc.Err()
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	var r ignoreRule
+	// trailing spaces are dropped unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+	if line == "" || line[0] == '#' {
+		return r, false
+	}
+	switch {
+	case line[0] == '!':
+		r.negate, line = true, line[1:]
+	case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored, line = true, strings.TrimPrefix(line, "/")
+	}
+	r.pattern = line
+	return r, line != ""
+}
+
+// match returns the rule deciding rel (relative to -src), or nil when no
+// rule matches or the last match re-includes it.
+func (rs ignoreRules) match(rel string, dir bool) *ignoreRule {
+	rel = filepath.ToSlash(rel)
+	var last *ignoreRule
+	for i := range rs {
+		r := &rs[i]
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = rel[len(r.base)+1:]
+		}
+		if r.dirOnly && !dir {
+			continue
+		}
+		subject := sub
+		if !r.anchored {
+			subject = path.Base(sub)
+		}
+		if globMatch(r.pattern, subject) {
+			last = r
+		}
+	}
+	if last != nil && last.negate {
+		return nil
+	}
+	return last
+}
+
+// gitIgnores applies the ignore files of the git repositories met in a
+// walk, for -respect-gitignore.
+type gitIgnores struct {
+	rules ignoreRules
+	repos []string // repository roots relative to -src
+}
+
+// enter loads the ignore files for dir: a repository root (a folder with
+// .git) brings its .git/info/exclude, and .gitignore files count anywhere
+// inside a repository.
+func (g *gitIgnores) enter(dir, rel string) error {
+	if info, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		g.repos = append(g.repos, filepath.ToSlash(rel))
+		// in worktrees and submodules .git is a file pointing elsewhere
+		if info.IsDir() {
+			if err := g.rules.load(filepath.Join(dir, ".git", "info"), rel, "exclude"); err != nil {
+				return err
+			}
+		}
+	}
+	if !g.inRepo(rel) {
+		return nil
+	}
+	return g.rules.load(dir, rel, ".gitignore")
+}
+
+func (g *gitIgnores) inRepo(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, r := range g.repos {
+		if r == "." || rel == r || strings.HasPrefix(rel, r+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		want ignoreRule
+	}{
+		{"", false, ignoreRule{}},
+		{"   ", false, ignoreRule{}},
+		{"# a comment", false, ignoreRule{}},
+		{"#*.tmp", false, ignoreRule{}},
+		{`\#notes`, true, ignoreRule{pattern: "#notes"}},
+		{`\!bang`, true, ignoreRule{pattern: "!bang"}},
+		{"*.tmp", true, ignoreRule{pattern: "*.tmp"}},
+		{"*.tmp   ", true, ignoreRule{pattern: "*.tmp"}},
+		{`name\ `, true, ignoreRule{pattern: "name "}},
+		{`name\    `, true, ignoreRule{pattern: "name "}},
+		{" lead", true, ignoreRule{pattern: " lead"}},
+		{"!important.tmp", true, ignoreRule{pattern: "important.tmp", negate: true}},
+		{"!", false, ignoreRule{negate: true}},
+		{"node_modules/", true, ignoreRule{pattern: "node_modules", dirOnly: true}},
+		{"/build", true, ignoreRule{pattern: "build", anchored: true}},
+		{"/build/", true, ignoreRule{pattern: "build", anchored: true, dirOnly: true}},
+		{"docs/*.md", true, ignoreRule{pattern: "docs/*.md", anchored: true}},
+		{"!/keep/", true, ignoreRule{pattern: "keep", negate: true, anchored: true, dirOnly: true}},
+		{"**/cache", true, ignoreRule{pattern: "**/cache", anchored: true}},
+	}
+	for _, tt := range tests {
+		got, ok := parseIgnoreLine(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseIgnoreLine(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, ignoreFileName): "# scratch files\n*.tmp\n!important.tmp\nnode_modules/\n/build\ndocs/*.md\n",
+		filepath.Join(sub, ignoreFileName):  "!*.tmp\n/local\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rs ignoreRules
+	if err := rs.load(root, ".", ignoreFileName); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.load(sub, "sub", ignoreFileName); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel     string
+		dir     bool
+		ignored bool
+	}{
+		{"a.tmp", false, true},
+		{"deep/down/a.tmp", false, true},
+		{"important.tmp", false, false},
+		{"deep/important.tmp", false, false},
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false}, // a file of that name is not a folder
+		{"build", true, true},
+		{"build", false, true},
+		{"web/build", true, false}, // anchored to the ignore file's folder
+		{"docs/a.md", false, true},
+		{"web/docs/a.md", false, false},
+		{"docs/a.txt", false, false},
+		// sub's own file re-includes *.tmp and anchors /local there
+		{"sub/a.tmp", false, false},
+		{"sub/local", true, true},
+		{"local", true, false},
+		{"sub/deeper/local", true, false},
+	}
+	for _, tt := range tests {
+		if got := rs.match(tt.rel, tt.dir) != nil; got != tt.ignored {
+			t.Errorf("match(%q, dir %v) ignored = %v, want %v", tt.rel, tt.dir, got, tt.ignored)
+		}
+	}
+}
+
+func TestIgnoreFileBadPattern(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ignoreFileName), []byte("ok\n[broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var rs ignoreRules
+	if err := rs.load(dir, ".", ignoreFileName); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// globFilter is an -include or -exclude list. A pattern matches a file by
+// its base name or its path relative to -src; "**" as a path element
+// matches any number of folders.
+type globFilter []string
+
+func parseGlobs(flagName string, patterns []string) (globFilter, error) {
+	for _, p := range patterns {
+		if err := validGlob(p); err != nil {
+			return nil, fmt.Errorf("invalid -%s pattern %q: %v", flagName, p, err)
+		}
+	}
+	return globFilter(patterns), nil
+}
+
+func validGlob(p string) error {
+	for _, elem := range strings.Split(p, "/") {
+		if elem == "**" {
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f globFilter) matches(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	base := path.Base(rel)
+	for _, p := range f {
+		if globMatch(p, base) || globMatch(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludes reports whether rel or one of its folders matches: an excluded
+// folder takes everything below it along.
+func (f globFilter) excludes(rel string) bool {
+	for rel != "." && rel != "" {
+		if f.matches(rel) {
+			return true
+		}
+		rel = filepath.Dir(rel)
+	}
+	return false
+}
+
+// selectFiles applies -include, then -exclude (files must match an include
+// and no exclude); project folders only go through -exclude.
+func (o Options) selectFiles(files []fileEntry) ([]fileEntry, int) {
+	if len(o.Include) == 0 && len(o.Exclude) == 0 {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		rel, err := filepath.Rel(fe.Root, fe.Path)
+		if err == nil && o.selects(rel, fe.Marker != "") {
+			kept = append(kept, fe)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+func (o Options) selects(rel string, dir bool) bool {
+	if len(o.Include) > 0 && !dir && !o.Include.matches(rel) {
+		return false
+	}
+	return !o.Exclude.excludes(rel)
+}
+
+func globMatch(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// nameRegexp is one -match or -not-match expression. It is tried on the
+// base name, or with a "path:" prefix on the slash-separated path relative
+// to -src.
+type nameRegexp struct {
+	re   *regexp.Regexp
+	path bool
+}
+
+type regexpFilter []nameRegexp
+
+func parseRegexps(flagName string, exprs []string) (regexpFilter, error) {
+	var f regexpFilter
+	for _, e := range exprs {
+		r := nameRegexp{}
+		if rest, ok := strings.CutPrefix(e, "path:"); ok {
+			e, r.path = rest, true
+		}
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -%s expression: %v", flagName, err)
+		}
+		r.re = re
+		f = append(f, r)
+	}
+	return f, nil
+}
+
+func (f regexpFilter) matches(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, r := range f {
+		if r.path && r.re.MatchString(rel) || !r.path && r.re.MatchString(path.Base(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSelects applies -match (any of them) and -not-match (none of them).
+func (o Options) matchSelects(rel string) bool {
+	return (len(o.Match) == 0 || o.Match.matches(rel)) && !o.NotMatch.matches(rel)
+}
+
+// selectMatches applies -match and -not-match to files; project folders
+// are left to -exclude.
+func (o Options) selectMatches(files []fileEntry) ([]fileEntry, int) {
+	if len(o.Match) == 0 && len(o.NotMatch) == 0 {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		rel, err := filepath.Rel(fe.Root, fe.Path)
+		if err != nil || fe.Marker != "" || o.matchSelects(rel) {
+			kept = append(kept, fe)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+// sizeSelects applies -min-size and -max-size (-1: no upper bound).
+func (o Options) sizeSelects(size int64) bool {
+	return size >= o.MinSize && (o.MaxSize < 0 || size <= o.MaxSize)
+}
+
+// selectSizes drops files outside the size bounds, using the FileInfo
+// gathered during collection. Project folders and files that couldn't be
+// stat'ed are kept.
+func (o Options) selectSizes(files []fileEntry) ([]fileEntry, int) {
+	if o.MinSize == 0 && o.MaxSize < 0 {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if fe.Marker != "" || fe.Info == nil || o.sizeSelects(fe.Info.Size()) {
+			kept = append(kept, fe)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+// parseCutoff reads -since/-before: a date (YYYY-MM-DD, local midnight),
+// an RFC3339 timestamp or an age before now (7d, 48h).
+func parseCutoff(flagName, s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.Trim(s, "0123456789") == "" {
+		return time.Time{}, fmt.Errorf("ambiguous -%s %q: give an age with a unit (%sd, %sh) or a date (YYYY-MM-DD)", flagName, s, s, s)
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q (use YYYY-MM-DD, RFC3339 or an age like 7d, 48h)", flagName, s)
+	}
+	return now.Add(-d), nil
+}
+
+// timeSelects applies -since (inclusive) and -before (exclusive).
+func (o Options) timeSelects(t time.Time) bool {
+	return (o.Since.IsZero() || !t.Before(o.Since)) && (o.Before.IsZero() || t.Before(o.Before))
+}
+
+// selectTimes drops files outside -since/-before by their -time-source
+// time.
+func (o Options) selectTimes(files []fileEntry) ([]fileEntry, int) {
+	if o.Since.IsZero() && o.Before.IsZero() {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if fe.Marker != "" || fe.Info == nil {
+			kept = append(kept, fe)
+			continue
+		}
+		if t, _ := o.fileTime(fe.Path, fe.Info); o.timeSelects(t) {
+			kept = append(kept, fe)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
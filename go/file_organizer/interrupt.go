@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// exitInterrupted is the exit code of a run stopped by SIGINT or SIGTERM,
+// as a shell reports for Ctrl-C.
+const exitInterrupted = 130
+
+// exitTimeout is the exit code when -timeout ran out, as timeout(1) uses.
+const exitTimeout = 124
+
+var errInterrupted = errors.New("interrupted")
+
+// contextReader fails reads once its context is done, so a long copy can
+// be abandoned midway.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// cancelable wraps r for ctx. A context that can't be cancelled leaves r
+// as it is, which keeps io.Copy's in-kernel copy for *os.File.
+func cancelable(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return contextReader{ctx, r}
+}
+
+// catchInterrupts turns the first SIGINT or SIGTERM into a request to stop
+// once the current file is done; a second one quits at once, leaving at
+// most a temporary file for the next run to remove.
+func catchInterrupts() *atomic.Bool {
+	stop := new(atomic.Bool)
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		stop.Store(true)
+		fmt.Fprintln(os.Stderr, "\nInterrupted: finishing the current file, then stopping (again to quit at once)")
+		<-ch
+		fmt.Fprintln(os.Stderr, "Quitting now")
+		os.Exit(exitInterrupted)
+	}()
+	return stop
+}
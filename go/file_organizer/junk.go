@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultJunk are the files and folders operating systems leave behind,
+// skipped unless -no-default-ignores is given. Matched without regard to
+// case against base names.
+var defaultJunk = []string{
+	".DS_Store", "._*", ".Spotlight-V100", ".Trashes", ".fseventsd", ".TemporaryItems",
+	"Thumbs.db", "ehthumbs.db", "ehthumbs_vista.db", "desktop.ini", "$RECYCLE.BIN", "System Volume Information", "__MACOSX",
+}
+
+func (o Options) isJunk(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range o.Junk {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectJunk drops junk files and returns them for deleteJunk.
+func (o Options) selectJunk(files []fileEntry) ([]fileEntry, []string) {
+	if len(o.Junk) == 0 {
+		return files, nil
+	}
+	kept := files[:0]
+	var junk []string
+	for _, fe := range files {
+		if fe.Marker != "" || !o.isJunk(filepath.Base(fe.Path)) {
+			kept = append(kept, fe)
+			continue
+		}
+		junk = append(junk, fe.Path)
+		if o.Verbose && !o.DeleteJunk {
+			fmt.Println("JUNK:", fe.Path)
+		}
+	}
+	return kept, junk
+}
+
+// deleteJunk removes the junk files for -delete-junk and returns how many
+// are gone.
+func (o Options) deleteJunk(junk []string, mf *manifest) int {
+	n := 0
+	for _, p := range junk {
+		if o.DryRun {
+			fmt.Println("DRY-RUN: delete junk", p)
+			n++
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot delete junk:", err)
+			continue
+		}
+		n++
+		if o.Verbose {
+			fmt.Println("DELETE junk:", p)
+		}
+		if err := mf.record(manifestEntry{Action: "delete-junk", Src: p}); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+		}
+	}
+	return n
+}
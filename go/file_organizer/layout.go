@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layoutDir returns extra folders to nest under the category directory for
+// metadata-driven layouts, plus a note for verbose and dry-run output. A
+// non-nil error means the file fell back to the plain category and should
+// be reported as a warning.
+func (o Options) layoutDir(path string, m match) (string, string, error) {
+	switch {
+	case len(o.MusicLayout) > 0 && m.kind() == "audio":
+		dir, note := musicDir(path, o.MusicLayout)
+		return dir, note, nil
+	case len(o.PhotoLayout) > 0 && m.kind() == "images":
+		dir, note := o.photoDir(path)
+		return dir, note, nil
+	case len(o.VideoBuckets) > 0 && m.kind() == "videos":
+		return o.videoDir(path)
+	}
+	return "", "", nil
+}
+
+var musicTokens = map[string]bool{"artist": true, "album": true, "year": true}
+
+func parseMusicLayout(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(strings.ToLower(s), "/")
+	for _, p := range parts {
+		if !musicTokens[p] {
+			return nil, fmt.Errorf("invalid -music-layout %q: unknown part %q (use artist, album, year)", s, p)
+		}
+	}
+	return parts, nil
+}
+
+func musicDir(path string, layout []string) (string, string) {
+	t, err := readAudioTags(path)
+	if err != nil {
+		return "", "no tags: " + err.Error()
+	}
+
+	dirs := make([]string, 0, len(layout))
+	for _, part := range layout {
+		var v string
+		switch part {
+		case "artist":
+			v = t.AlbumArtist
+			if v == "" {
+				v = t.Artist
+			}
+		case "album":
+			v = t.Album
+		case "year":
+			if len(t.Year) >= 4 {
+				v = t.Year[:4]
+			}
+		}
+		v = sanitizeComponent(v)
+		if v == "" {
+			return "", "missing " + part + " tag"
+		}
+		dirs = append(dirs, v)
+	}
+	return filepath.Join(dirs...), "tags: " + strings.Join(dirs, "/")
+}
+
+var photoTokens = map[string]bool{"date": true, "camera": true, "geo": true}
+
+func parsePhotoLayout(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(strings.ToLower(s), "/")
+	for _, p := range parts {
+		if !photoTokens[p] {
+			return nil, fmt.Errorf("invalid -photo-layout %q: unknown part %q (use date, camera, geo)", s, p)
+		}
+	}
+	return parts, nil
+}
+
+// validateDateFormat checks a Go time layout used for folder names.
+func validateDateFormat(flagName, layout string) error {
+	sample := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC).Format(layout)
+	if sample == layout {
+		return fmt.Errorf("invalid %s %q: no date fields (use Go layout like 2006/2006-01)", flagName, layout)
+	}
+	if dateDir(time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), layout) == "" {
+		return fmt.Errorf("invalid %s %q: produces an empty folder name", flagName, layout)
+	}
+	return nil
+}
+
+// photoDated reports whether -photo-layout already puts m under a date
+// folder, so -date-dirs doesn't nest it twice.
+func (o Options) photoDated(m match) bool {
+	if m.kind() != "images" {
+		return false
+	}
+	for _, part := range o.PhotoLayout {
+		if part == "date" {
+			return true
+		}
+	}
+	return false
+}
+
+// dateDir formats t with a Go time layout; slashes in the layout become
+// nested folders.
+func dateDir(t time.Time, layout string) string {
+	var dirs []string
+	for _, part := range strings.Split(t.Format(layout), "/") {
+		if part = sanitizeComponent(part); part != "" {
+			dirs = append(dirs, part)
+		}
+	}
+	return filepath.Join(dirs...)
+}
+
+func (o Options) photoDir(path string) (string, string) {
+	info, exifErr := readEXIF(path)
+
+	var dirs, notes []string
+	for _, part := range o.PhotoLayout {
+		switch part {
+		case "date":
+			t := info.DateTaken
+			if t.IsZero() {
+				fi, err := os.Stat(path)
+				if err != nil {
+					return "", "cannot stat: " + err.Error()
+				}
+				var source string
+				t, source = o.fileTime(path, fi)
+				if exifErr != nil && !errors.Is(exifErr, errNoEXIF) {
+					notes = append(notes, "EXIF unreadable ("+exifErr.Error()+"), using "+source)
+				} else {
+					notes = append(notes, "no EXIF date, using "+source)
+				}
+			} else {
+				notes = append(notes, "EXIF date")
+			}
+			dirs = append(dirs, dateDir(t, o.PhotoDateFormat))
+		case "camera":
+			cam := cameraDir(info.Make, info.Model)
+			if cam == "" {
+				cam = "unknown_camera"
+			}
+			notes = append(notes, "camera: "+cam)
+			dirs = append(dirs, cam)
+		case "geo":
+			region := "no_location"
+			if info.HasGPS {
+				region = o.geoRegion(info.Latitude, info.Longitude)
+			}
+			notes = append(notes, "region: "+region)
+			dirs = append(dirs, filepath.Join("geo", region))
+		}
+	}
+	return filepath.Join(dirs...), strings.Join(notes, "; ")
+}
+
+// selfDescribingModels are model names that identify the device without
+// the manufacturer ("iPhone 14" rather than "Apple iPhone 14").
+var selfDescribingModels = []string{"iPhone", "iPad", "Pixel", "Galaxy"}
+
+// cameraDir builds a folder name like "Canon_EOS_R6" from EXIF Make/Model,
+// dropping the make when the model already includes it.
+func cameraDir(maker, model string) string {
+	maker, model = strings.TrimSpace(maker), strings.TrimSpace(model)
+	name := model
+	brand, _, _ := strings.Cut(maker, " ")
+	switch {
+	case model == "":
+		name = maker
+	case brand == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(brand)):
+	default:
+		name = maker + " " + model
+		for _, p := range selfDescribingModels {
+			if strings.HasPrefix(model, p) {
+				name = model
+				break
+			}
+		}
+	}
+	return strings.ReplaceAll(sanitizeComponent(name), " ", "_")
+}
+
+type geoRegion struct {
+	Name           string
+	MinLat, MinLon float64
+	MaxLat, MaxLon float64
+}
+
+func (r geoRegion) contains(lat, lon float64) bool {
+	if lat < r.MinLat || lat > r.MaxLat {
+		return false
+	}
+	if r.MinLon <= r.MaxLon {
+		return lon >= r.MinLon && lon <= r.MaxLon
+	}
+	// box crosses the antimeridian
+	return lon >= r.MinLon || lon <= r.MaxLon
+}
+
+// geoRegion names the first user region containing the point, or else a
+// grid cell like "52.5N_13.4E" computed offline from the coordinates.
+func (o Options) geoRegion(lat, lon float64) string {
+	for _, r := range o.Regions {
+		if r.contains(lat, lon) {
+			return r.Name
+		}
+	}
+	return gridCell(lat, lon, o.GeoGrid)
+}
+
+func gridCell(lat, lon, grid float64) string {
+	cell := func(v float64, pos, neg string) string {
+		hemi := pos
+		if v < 0 {
+			hemi, v = neg, -v
+		}
+		v = math.Floor(v/grid+1e-9) * grid
+		return strconv.FormatFloat(v, 'f', gridDecimals(grid), 64) + hemi
+	}
+	return cell(lat, "N", "S") + "_" + cell(lon, "E", "W")
+}
+
+func gridDecimals(grid float64) int {
+	for d := 0; d < 6; d++ {
+		scaled := grid * math.Pow10(d)
+		if math.Abs(scaled-math.Round(scaled)) < 1e-9 {
+			return d
+		}
+	}
+	return 6
+}
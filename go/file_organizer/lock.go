@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockFileName = "lock"
+
+// runLock keeps two runs off the same -dest. The OS drops the lock with
+// the process, so it is released on every exit, signals and crashes
+// included; the file itself stays and only says who held it last.
+type runLock struct {
+	f *os.File
+}
+
+type lockHolder struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// acquireLock takes the lock at path, waiting up to wait for a run that
+// holds it.
+func acquireLock(path string, wait time.Duration) (*runLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("cannot lock %s: %v", path, err)
+		}
+		if ok {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			holder := readHolder(f)
+			f.Close()
+			if wait > 0 {
+				return nil, fmt.Errorf("another run (%s) is still active after -wait-lock %s", holder, wait)
+			}
+			return nil, fmt.Errorf("another run (%s) is active; use -wait-lock to wait for it", holder)
+		}
+		time.Sleep(min(250*time.Millisecond, time.Until(deadline)))
+	}
+	b, _ := json.Marshal(lockHolder{PID: os.Getpid(), Started: time.Now()})
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt(append(b, '\n'), 0)
+	}
+	return &runLock{f: f}, nil
+}
+
+func readHolder(f *os.File) string {
+	b := make([]byte, 256)
+	n, _ := f.ReadAt(b, 0)
+	var h lockHolder
+	if json.Unmarshal(b[:n], &h) != nil || h.PID == 0 {
+		return "holder unknown"
+	}
+	return fmt.Sprintf("pid %d, started %s", h.PID, h.Started.Local().Format("2006-01-02 15:04"))
+}
+
+func (l *runLock) release() {
+	if l != nil {
+		_ = unlock(l.f)
+		_ = l.f.Close()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxNameLen is NAME_MAX on Linux/macOS and the NTFS component
+// limit. Lengths are counted in bytes, which is never less than the UTF-16
+// units Windows counts.
+const defaultMaxNameLen = 255
+
+var longNamePolicies = map[string]bool{"shorten": true, "error": true}
+
+var errNameTooLong = errors.New("name too long")
+
+// fitNames checks the components of path below root against -max-name-len
+// and, with -long-names shorten, cuts the long ones down.
+func (o Options) fitNames(root, path string) (string, error) {
+	if o.MaxNameLen <= 0 {
+		return path, nil
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path, nil
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	changed := false
+	for i, p := range parts {
+		if len(p) <= o.MaxNameLen {
+			continue
+		}
+		if o.LongNames == "error" {
+			return path, fmt.Errorf("%w: %s is %d bytes (-max-name-len %d)", errNameTooLong, p, len(p), o.MaxNameLen)
+		}
+		ext := ""
+		if i == len(parts)-1 {
+			_, ext = o.Categorizer.splitExt(p)
+		}
+		parts[i], changed = shortenName(p, ext, o.MaxNameLen), true
+	}
+	if !changed {
+		return path, nil
+	}
+	return filepath.Join(root, filepath.Join(parts...)), nil
+}
+
+// shortenName cuts name to max bytes, keeping ext and appending a hash of
+// the full name so two long names sharing a prefix stay apart:
+// <stem prefix>~<hash8><ext>.
+func shortenName(name, ext string, max int) string {
+	sum := sha256.Sum256([]byte(name))
+	tail := "~" + hex.EncodeToString(sum[:4])
+	if len(ext)+len(tail) > max/2 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	n := max - len(tail) - len(ext)
+	for n > 0 && !utf8.RuneStart(stem[n]) {
+		n--
+	}
+	return stem[:n] + tail + ext
+}
+
+// explainLength replaces the raw error of a path that is too long for the
+// filesystem with one that says so.
+func explainLength(path string, err error) error {
+	if err == nil || !nameTooLong(err) {
+		return err
+	}
+	longest := 0
+	for _, p := range strings.Split(path, string(filepath.Separator)) {
+		longest = max(longest, len(p))
+	}
+	return fmt.Errorf("%s: destination path too long (%d bytes, longest name %d bytes; see -max-name-len): %w", path, len(path), longest, err)
+}
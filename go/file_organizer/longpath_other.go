@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func longPath(p string) string {
+	return p
+}
+
+func nameTooLong(err error) bool {
+	return errors.Is(err, syscall.ENAMETOOLONG)
+}
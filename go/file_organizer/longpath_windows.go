@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const errorFilenameExcedRange = syscall.Errno(206)
+
+// longPath gives an absolute path the \\?\ prefix, which lifts the
+// MAX_PATH (260) limit for every call, not only the ones package os
+// already rewrites.
+func longPath(p string) string {
+	if len(p) < 248 || strings.HasPrefix(p, `\\?\`) || !filepath.IsAbs(p) {
+		return p
+	}
+	if strings.HasPrefix(p, `\\`) {
+		return `\\?\UNC\` + p[2:]
+	}
+	return `\\?\` + filepath.Clean(p)
+}
+
+func nameTooLong(err error) bool {
+	return errors.Is(err, errorFilenameExcedRange) || errors.Is(err, syscall.ENAMETOOLONG)
+}
@@ -1,219 +1,2311 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Options struct {
-	Src       string
-	Dest      string
-	Mode      string // "move" or "copy"
-	Recursive bool
-	DryRun    bool
-	Verbose   bool
+	Src               string // first -src; the default -dest
+	SrcFlags          stringList
+	Sources           []string
+	Archives          []string // -src values that are archives, extracted entry by entry
+	FilesFrom         string   // "-" for stdin
+	ExplainPath       string   // file given to the explain subcommand
+	NulList           bool
+	Dest              string
+	Mode              string // "move" or "copy"
+	OnConflict        string // skip, overwrite, rename, newer or error
+	RenameTemplate    string
+	Renamer           *renamer
+	DeleteIdentical   bool
+	KeepReplaced      bool
+	ReplacedRetention int
+	RunID             string // names this run in the replaced store
+	DestCase          string
+	Case              *caseFolder
+	AllowNested       bool
+	RescanOrganized   bool
+	NameFlags         stringList
+	NameTemplates     *nameTemplates
+	Interactive       bool
+	Prompter          *conflictPrompter
+	Update            bool
+	MtimeTolerance    time.Duration
+	DeleteUpToDate    bool
+	KeepVersions      int
+	PruneToTrash      bool
+	Versions          *versionStore
+	ConflictReport    string
+	Report            *conflictReport
+	WindowsSafe       bool
+	WinNames          *windowsNames
+	NormalizeNames    string
+	SanitizeNames     bool
+	MaxNameLen        int
+	LongNames         string
+	DeferredDelete    bool
+	Verify            bool
+	NoPreservePerms   bool
+	NoPreserveTimes   bool
+	PreserveXattrs    bool
+	NoPreserveOwner   bool
+	IgnoreSpaceCheck  bool
+	WaitLock          time.Duration
+	Timeout           time.Duration
+	Durability        string
+	LockPath          string
+	Hardlinks         string
+	IncludeFlags      stringList
+	Include           globFilter
+	IncludeMIMEFlag   string
+	IncludeMIME       mimeFilter
+	ExcludeFlags      stringList
+	Exclude           globFilter
+	MatchFlags        stringList
+	NotMatchFlags     stringList
+	Match             regexpFilter
+	NotMatch          regexpFilter
+	MinSizeFlag       string
+	MaxSizeFlag       string
+	MinSize           int64
+	MaxSize           int64 // -1: no -max-size
+	SinceFlag         string
+	BeforeFlag        string
+	Since             time.Time
+	Before            time.Time
+	OwnerName         string
+	OwnerUID          int
+	GroupName         string
+	GroupGID          int
+	Owners            ownerFilter
+	SkipHidden        bool
+	NoIgnoreFile      bool
+	RespectGitignore  bool
+	MaxDepth          int // -1: unlimited
+	OnlyCategories    string
+	SkipCategories    string
+	Scope             *categoryScope
+	MaxFiles          int // 0: no limit
+	MaxBytesFlag      string
+	MaxBytes          int64 // 0: no limit
+	BatchOrder        string
+	CursorPath        string
+	Cursor            *batchCursor
+	Settle            time.Duration
+	Sample            int
+	Seed              int64
+	SettleRecheck     bool
+	Placeholders      string
+	Links             *linkTracker
+	Excluded          map[string]bool // destination folders skipped by the scan -> seen
+	Recursive         bool
+	FollowSymlinks    bool
+	SymlinkTargets    string
+	SpecialFiles      string
+	ForceRoot         bool
+	ProbeWrites       bool
+	OnRemoveFailure   string
+	WarnFiles         int
+	NoDefaultIgnores  bool
+	DeleteJunk        bool
+	Junk              []string // base name globs, see defaultJunk
+	DryRun            bool
+	Verbose           bool
+	Rules             string
+	RuleFlags         stringList
+	MapFlags          stringList
+	Sniff             bool
+	FoldNames         bool
+	Dotfiles          string // "category" or "strip"
+
+	UnknownCategory string
+	SplitUnknown    bool
+	SplitCode       bool
+	Screenshots     bool
+	ByOrigin        bool
+	By              string
+	MIMESubtypes    bool
+	ByOwner         bool
+	DuplicatesTo    string
+	OwnerDirMode    string
+	MusicLayoutFlag string
+	PhotoLayoutFlag string
+	PhotoDateFormat string
+	GeoGrid         float64
+	VideoResolution bool
+	DateDirs        bool
+	KeepStructure   bool
+	LayoutFlag      string
+	SizeBucketFlag  string
+	AgeBucketFlag   string
+	ShardFlag       string
+	MinCategory     int
+	RunSubdir       bool
+	RunFormat       string
+	MaxPerDir       int
+	OverflowName    string
+	HashAlgo        string
+	TimeSource      string
+	Manifest        string
+	Projects        string // "", "skip" or "move"
+	MarkerFlag      string
+	DateFormat      string
+	VideoBucketFlag string
+	DestFor         stringList
+
+	DestRoots      map[string]string // category -> destination root from -dest-for
+	MusicLayout    []string
+	PhotoLayout    []string
+	Regions        []geoRegion
+	VideoBuckets   []resolutionBucket
+	Layout         *layoutTemplate
+	SizeBuckets    sizeBuckets
+	AgeBuckets     ageBuckets
+	Shard          *shardSpec
+	ProjectMarkers []string
+	Limiter        *dirLimiter
+	RunDir         string // per-run folder from -run-subdir, created on first use
+	OwnerMode      os.FileMode
+
+	Categorizer *categorizer
 }
 
 func main() {
-	opts, err := parseFlags()
+	explain := len(os.Args) > 1 && os.Args[1] == "explain"
+	if explain {
+		os.Args = append(os.Args[:1:1], os.Args[2:]...)
+	}
+	opts, err := parseFlags(explain)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERROR:", err)
 		os.Exit(1)
 	}
-
-	if err := run(opts); err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR:", err)
-		os.Exit(1)
+	if explain {
+		os.Exit(runExplain(opts, opts.ExplainPath))
+	}
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	err = run(ctx, opts)
+	switch {
+	case errors.Is(err, errInterrupted):
+		os.Exit(exitInterrupted)
+	case errors.Is(err, context.DeadlineExceeded):
+		os.Exit(exitTimeout)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(explain bool) (Options, error) {
+	var o Options
+
+	flag.StringVar(&o.FilesFrom, "files-from", "", "Read the files to organize from this list (- for stdin) instead of scanning -src")
+	flag.BoolVar(&o.NulList, "0", false, "Entries in -files-from are NUL-delimited (find -print0)")
+	flag.Var(&o.SrcFlags, "src", "Source directory to organize (repeatable or comma-separated)")
+	flag.StringVar(&o.Dest, "dest", "", "Destination root directory (default: same as src)")
+	flag.Var(&o.DestFor, "dest-for", "Per-category destination CATEGORY=DIR, e.g. images=/mnt/nas/photos (repeatable)")
+	flag.StringVar(&o.Mode, "mode", "move", "Operation mode: move or copy")
+	flag.StringVar(&o.OnConflict, "on-conflict", "skip", "When the destination exists: skip, overwrite, rename, newer (replace if the source is newer) or error")
+	flag.BoolVar(&o.DeleteIdentical, "delete-identical-source", false, "With -mode move, delete sources whose destination already holds identical content")
+	flag.BoolVar(&o.KeepReplaced, "keep-replaced", false, "Move files about to be overwritten into dest/.organizer/replaced/<run-id>/ instead")
+	flag.IntVar(&o.ReplacedRetention, "replaced-retention", 0, "Purge -keep-replaced runs older than N days (0 keeps them)")
+	flag.BoolVar(&o.AllowNested, "allow-nested", false, "No longer needed: destination folders inside -src are always left out of -recursive scans")
+	flag.BoolVar(&o.RescanOrganized, "rescan-organized", false, "With -recursive, also scan destination folders inside -src, e.g. to re-organize after changing rules")
+	flag.StringVar(&o.DestCase, "dest-case", "auto", "Destination name matching for collisions: auto (probe the filesystem), sensitive or insensitive")
+	flag.Var(&o.NameFlags, "name-template", "Rename files from metadata, e.g. images={taken} or audio=\"{artist} - {title}\" (repeatable)")
+	flag.BoolVar(&o.Interactive, "interactive-conflicts", false, "Ask on the terminal how to resolve each conflict with an existing file")
+	flag.BoolVar(&o.Update, "update", false, "Replace an existing destination only if the source mtime is newer (like rsync --update)")
+	flag.DurationVar(&o.MtimeTolerance, "mtime-tolerance", defaultMtimeTolerance, "Slack when comparing mtimes for -update and -on-conflict newer")
+	flag.BoolVar(&o.DeleteUpToDate, "delete-up-to-date", false, "With -update and -mode move, delete sources whose destination is up to date")
+	flag.IntVar(&o.KeepVersions, "keep-versions", 0, "With -on-conflict rename, keep at most N renamed versions per file, pruning the oldest")
+	flag.BoolVar(&o.PruneToTrash, "prune-to-trash", false, "Move versions pruned by -keep-versions to dest/.organizer/trash/ instead of deleting them")
+	flag.IntVar(&o.MaxNameLen, "max-name-len", defaultMaxNameLen, "Longest destination file or folder name in bytes (0: no limit)")
+	flag.StringVar(&o.LongNames, "long-names", "shorten", "Names over -max-name-len: shorten (keep the extension, add a hash) or error")
+	flag.StringVar(&o.Hardlinks, "hardlinks", "link", "Further paths to an already placed hardlinked source: link (hardlink the destination to its copy), skip or copy")
+	flag.StringVar(&o.Durability, "durability", "default", "Crash safety: full (sync folders after every file), default (sync each folder once, and before a copied source is deleted) or none")
+	flag.DurationVar(&o.Timeout, "timeout", 0, "Stop cleanly after this long (e.g. 45m): no new files are started, a copy under way is abandoned, the summary is printed")
+	flag.DurationVar(&o.WaitLock, "wait-lock", 0, "When another run holds the lock on -dest, wait up to this long (e.g. 10m) instead of failing")
+	flag.BoolVar(&o.IgnoreSpaceCheck, "ignore-space-check", false, "Start even when a destination filesystem has less free space than the run needs")
+	flag.BoolVar(&o.NoPreserveOwner, "no-preserve-owner", false, "When running as root, leave copies owned by root instead of giving them the source's owner")
+	flag.BoolVar(&o.PreserveXattrs, "preserve-xattrs", true, "Copy extended attributes (user.* on Linux, all on macOS) along with the data; false drops them")
+	flag.BoolVar(&o.NoPreserveTimes, "no-preserve-times", false, "Leave copies with the time they were written instead of the source's modification and access times")
+	flag.BoolVar(&o.NoPreservePerms, "no-preserve-perms", false, "Give copies the default mode instead of the source's permission bits")
+	flag.BoolVar(&o.Verify, "verify", false, "Hash each copy while writing it and read it back before the source is removed; bad copies are deleted, the source kept")
+	flag.BoolVar(&o.DeferredDelete, "deferred-delete", false, "With -mode move, copy and verify every file first and delete the sources only if the whole run succeeded")
+	flag.BoolVar(&o.SanitizeNames, "sanitize-names", false, "Rename files to lowercase ASCII words joined by _ (Invoice (final).PDF -> invoice_final.pdf)")
+	flag.StringVar(&o.NormalizeNames, "normalize-names", "nfc", "Unicode form of destination names: nfc, nfd or none (NFC and NFD spellings always collide)")
+	flag.BoolVar(&o.WindowsSafe, "windows-safe", false, "Make destination names valid on Windows (automatic on NTFS/FAT/exFAT destinations)")
+	flag.StringVar(&o.ConflictReport, "conflict-report", "", "Write every collision and its resolution to this file (CSV, or JSON for .json)")
+	flag.StringVar(&o.RenameTemplate, "rename-template", defaultRenameTemplate, "File name for -on-conflict rename; tokens {name}, {ext}, {n}, {date}, {hash8}")
+	flag.Var(&o.IncludeFlags, "include", "Only organize files whose name or path relative to -src matches this glob; ** spans folders (repeatable)")
+	flag.Var(&o.MatchFlags, "match", "Only organize files whose name matches this Go regexp; prefix path: to match the path relative to -src (repeatable, any may match)")
+	flag.Var(&o.NotMatchFlags, "not-match", "Leave files whose name matches this Go regexp alone; path: as for -match (repeatable)")
+	flag.StringVar(&o.IncludeMIMEFlag, "include-mime", "", "Only organize files whose sniffed content type matches, e.g. image/*,application/pdf (reads the first 512 bytes)")
+	flag.Var(&o.ExcludeFlags, "exclude", "Leave files whose name or path relative to -src matches this glob alone; matching folders are not scanned (repeatable)")
+	flag.StringVar(&o.MinSizeFlag, "min-size", "0", "Only organize files of at least this size, e.g. 10MB (0: no lower bound)")
+	flag.StringVar(&o.MaxSizeFlag, "max-size", "", "Only organize files of at most this size, e.g. 100KB")
+	flag.StringVar(&o.SinceFlag, "since", "", "Only organize files whose time (-time-source) is at or after this date, RFC3339 time or age (2023-01-01, 7d, 48h)")
+	flag.StringVar(&o.BeforeFlag, "before", "", "Only organize files whose time (-time-source) is before this date, RFC3339 time or age")
+	flag.StringVar(&o.OnlyCategories, "only-categories", "", "Only organize files of these categories, e.g. videos,images; others are left alone")
+	flag.StringVar(&o.SkipCategories, "skip-categories", "", "Leave files of these categories alone, e.g. code,other")
+	flag.StringVar(&o.Placeholders, "placeholders", "skip", "Empty and online-only cloud files: skip, category (move them to placeholders/ without reading them) or move (organize like any file)")
+	flag.DurationVar(&o.Settle, "settle", 0, "Leave files modified within this long of now alone, e.g. 5m; they may still be written to")
+	flag.BoolVar(&o.SettleRecheck, "settle-recheck", false, "Also stat files again a second later and leave the ones that changed alone")
+	flag.IntVar(&o.Sample, "sample", 0, "Organize only N files picked at random after filtering, and report the category distribution (best with -dry-run)")
+	flag.Int64Var(&o.Seed, "seed", 0, "Seed for -sample, so a sample can be repeated to compare rules (default: random, printed in the summary)")
+	flag.IntVar(&o.MaxFiles, "max-files", 0, "Organize at most N files this run, in -batch-order; the summary says how many remain (0: no limit)")
+	flag.StringVar(&o.MaxBytesFlag, "max-bytes", "", "Stop moving or copying once this much data was transferred in this run, e.g. 20GB; the rest is deferred")
+	flag.StringVar(&o.BatchOrder, "batch-order", "oldest", "Which files -max-files and -max-bytes take first: oldest, newest, name, largest or smallest")
+	flag.StringVar(&o.CursorPath, "cursor", "", "With -max-files and -batch-order oldest, remember in this file how far the runs got and skip older files")
+	flag.BoolVar(&o.RespectGitignore, "respect-gitignore", false, "Inside git repositories, leave what .gitignore (and .git/info/exclude) ignores alone")
+	flag.BoolVar(&o.NoDefaultIgnores, "no-default-ignores", false, "Organize OS leftovers like .DS_Store, ._* and Thumbs.db instead of skipping them")
+	flag.BoolVar(&o.DeleteJunk, "delete-junk", false, "Delete the skipped OS leftover files (.DS_Store, Thumbs.db, ...) instead of leaving them")
+	flag.StringVar(&o.SymlinkTargets, "symlink-targets", "adjust", "Symlinks placed as links: adjust relative targets so they still resolve from the new folder, or keep them as they are")
+	flag.StringVar(&o.SpecialFiles, "special-files", "skip", "FIFOs, sockets and device files: skip, or rename (with -mode move, only within one filesystem; never copied)")
+	flag.StringVar(&o.OnRemoveFailure, "on-remove-failure", "rollback", "When a move across filesystems can't remove the source: rollback (delete the copy, the move fails) or keep (keep both, recorded in -manifest)")
+	flag.BoolVar(&o.ProbeWrites, "probe-writes", false, "With -dry-run, check each destination folder by creating and removing a file in it instead of asking for the permissions")
+	flag.BoolVar(&o.ForceRoot, "force-root", false, "Allow -src to be a filesystem root, your home directory (or the folder holding the homes) or a system folder like /etc, /usr or C:\\Windows")
+	flag.IntVar(&o.WarnFiles, "warn-files", 100000, "Warn before organizing when the scan finds more than this many files (0: never)")
+	flag.BoolVar(&o.FollowSymlinks, "follow-symlinks", false, "Organize what symlinks point to: scan symlinked folders (cycles are detected) and copy the targets of symlinked files")
+	flag.IntVar(&o.MaxDepth, "max-depth", -1, "With -recursive, descend at most N levels (0: only the files directly in -src)")
+	flag.BoolVar(&o.NoIgnoreFile, "no-ignore-file", false, "Don't read "+ignoreFileName+" files (gitignore-style patterns) while scanning")
+	flag.StringVar(&o.OwnerName, "owner", "", "Only organize files owned by this user, e.g. $(whoami) (Unix only)")
+	flag.IntVar(&o.OwnerUID, "owner-uid", -1, "Only organize files owned by this numeric UID (Unix only)")
+	flag.StringVar(&o.GroupName, "group", "", "Only organize files of this group (Unix only)")
+	flag.IntVar(&o.GroupGID, "group-gid", -1, "Only organize files of this numeric GID (Unix only)")
+	flag.BoolVar(&o.SkipHidden, "skip-hidden", false, "Leave hidden files in place (dotfiles, the Windows hidden attribute, macOS chflags hidden); hidden folders are not scanned")
+	flag.BoolVar(&o.Recursive, "recursive", false, "Scan directories recursively")
+	flag.BoolVar(&o.KeepStructure, "keep-structure", false, "Keep the source folder structure under each category (with -recursive)")
+	flag.BoolVar(&o.DryRun, "dry-run", false, "Show what would happen without changing files")
+	flag.BoolVar(&o.Verbose, "verbose", false, "Print detailed actions")
+	flag.StringVar(&o.Rules, "rules", "", "JSON file with extra extension-to-category rules")
+	flag.Var(&o.RuleFlags, "rule", "Pattern rule PATTERN=CATEGORY, checked before extensions (repeatable)")
+	flag.Var(&o.MapFlags, "map", "Extension override .EXT=CATEGORY (repeatable)")
+	flag.BoolVar(&o.FoldNames, "ignore-name-case", false, "Match well-known filenames (Makefile, LICENSE) case-insensitively")
+	flag.StringVar(&o.Dotfiles, "dotfiles", "category", "Dotfile handling: category (put in dotfiles/) or strip (categorize by the rest of the name)")
+	flag.StringVar(&o.UnknownCategory, "unknown-category", "other", "Category for files with unrecognized extensions")
+	flag.BoolVar(&o.SplitUnknown, "split-unknown", false, "Place unrecognized files into per-extension subfolders (other/xcf)")
+	flag.BoolVar(&o.SplitCode, "split-code", false, "Split the code category into language subfolders (code/go, code/python)")
+	flag.BoolVar(&o.Screenshots, "screenshots", false, "Route screenshots (by filename pattern) into a screenshots category")
+	flag.StringVar(&o.By, "by", "category", "Classification: category (built-in tables) or mime (top-level content type folders)")
+	flag.BoolVar(&o.MIMESubtypes, "mime-subtype", false, "With -by mime, add the subtype as a second level (application/pdf)")
+	flag.BoolVar(&o.ByOrigin, "by-origin", false, "Group downloads by originating domain (macOS WhereFroms, Windows Zone.Identifier, Linux xdg xattrs)")
+	flag.BoolVar(&o.ByOwner, "by-owner", false, "Group files per owner: dest/<user>/<category> (Unix only)")
+	flag.StringVar(&o.OwnerDirMode, "owner-dir-mode", "0755", "Permissions (octal) for folders created by -by-owner")
+	flag.StringVar(&o.DuplicatesTo, "duplicates-to", "", "Send files whose content is already placed to this folder, e.g. duplicates (-> duplicates/<category>)")
+	flag.StringVar(&o.MusicLayoutFlag, "music-layout", "", "Nest audio files by tags, e.g. artist/album (ID3, FLAC, Ogg, MP4)")
+	flag.StringVar(&o.PhotoLayoutFlag, "photo-layout", "", "Nest images by EXIF metadata: date, camera, geo, in the given order (camera/date)")
+	flag.StringVar(&o.LayoutFlag, "layout", "", "Destination path template, e.g. {category}/{year}/{ext}/{name}")
+	flag.StringVar(&o.SizeBucketFlag, "size-buckets", "", "Split categories by size NAME=MAX,...,NAME= (e.g. "+defaultSizeBuckets+")")
+	flag.StringVar(&o.AgeBucketFlag, "age-buckets", "", "Split categories by age since modification NAME=AGE,... (e.g. old=180d,archive=2y)")
+	flag.StringVar(&o.ShardFlag, "shard", "", "Shard folders inside each destination: first-letter or hash:2/2")
+	flag.StringVar(&o.HashAlgo, "hash-algo", "sha256", "Hash for -shard hash: sha256, sha1, sha512 or md5")
+	flag.StringVar(&o.Projects, "projects", "", "Keep project directories whole with -recursive: skip them, or move them to projects/")
+	flag.StringVar(&o.MarkerFlag, "project-markers", defaultProjectMarkers, "Names that mark a directory as a project for -projects")
+	flag.BoolVar(&o.RunSubdir, "run-subdir", false, "Put this run's output under a timestamped folder in -dest (and each -dest-for root)")
+	flag.StringVar(&o.RunFormat, "run-format", "run-2006-01-02T150405", "Go time layout for the -run-subdir folder name")
+	flag.IntVar(&o.MinCategory, "min-category", 0, "Fold categories that would get fewer than N files (and don't exist yet) into misc/")
+	flag.IntVar(&o.MaxPerDir, "max-per-dir", 0, "Start overflow folders (images_002, ...) once a destination folder holds this many entries")
+	flag.StringVar(&o.OverflowName, "overflow-name", defaultOverflowName, "Overflow folder name for -max-per-dir; {dir} is the full folder's name, {n} the 3-digit counter")
+	flag.StringVar(&o.TimeSource, "time-source", "mtime", "Timestamp for date-based placement: mtime, ctime or birth")
+	flag.StringVar(&o.Manifest, "manifest", "", "Write a JSON Lines record of every moved/copied file to this path")
+	flag.BoolVar(&o.DateDirs, "date-dirs", false, "Nest files under category/<date> folders by file time (see -time-source)")
+	flag.StringVar(&o.DateFormat, "date-format", "2006/2006-01", "Go time layout for -date-dirs folders")
+	flag.StringVar(&o.PhotoDateFormat, "photo-date-format", "2006/2006-01", "Go time layout for -photo-layout date folders")
+	flag.Float64Var(&o.GeoGrid, "geo-grid", 0.1, "Grid cell size in degrees for -photo-layout geo")
+	flag.BoolVar(&o.VideoResolution, "video-resolution", false, "Nest videos into resolution buckets read from MP4/MKV/WebM headers")
+	flag.StringVar(&o.VideoBucketFlag, "video-buckets", "4k=2160,1080p=1080,720p=720,sd=0", "Resolution buckets NAME=MIN_HEIGHT for -video-resolution")
+	flag.BoolVar(&o.Sniff, "sniff", false, "Detect content type of files with unknown or missing extensions")
+
+	flag.Parse()
+
+	if explain {
+		if flag.NArg() != 1 {
+			return o, errors.New("usage: file-organizer explain [flags] FILE")
+		}
+		abs, err := filepath.Abs(flag.Arg(0))
+		if err != nil {
+			return o, err
+		}
+		o.ExplainPath = abs
+		if len(o.SrcFlags) == 0 && o.FilesFrom == "" {
+			o.SrcFlags = stringList{filepath.Dir(abs)}
+		}
+	}
+
+	for _, v := range o.SrcFlags {
+		for _, src := range strings.Split(v, ",") {
+			if src = strings.TrimSpace(src); src == "" {
+				continue
+			}
+			abs, err := filepath.Abs(src)
+			if err != nil {
+				return o, err
+			}
+			info, err := os.Stat(abs)
+			if err != nil {
+				return o, err
+			}
+			if !info.IsDir() {
+				if info.Mode().IsRegular() && archiveKind(abs) != "" {
+					o.Archives = append(o.Archives, abs)
+					continue
+				}
+				return o, fmt.Errorf("-src %s must be a directory or a .zip/.tar/.tar.gz/.tar.bz2 archive", abs)
+			}
+			if !o.ForceRoot && o.ExplainPath == "" {
+				if err := checkRiskySource(abs); err != nil {
+					return o, err
+				}
+			}
+			for _, prev := range o.Sources {
+				if isWithin(abs, prev) || isWithin(prev, abs) {
+					return o, fmt.Errorf("-src %s overlaps -src %s", abs, prev)
+				}
+			}
+			o.Sources = append(o.Sources, abs)
+		}
+	}
+	if len(o.Sources) == 0 && len(o.Archives) == 0 && o.FilesFrom == "" {
+		return o, errors.New("missing required flag: -src")
+	}
+	if len(o.Sources) > 0 {
+		o.Src = o.Sources[0]
+	}
+
+	if o.Dest == "" {
+		if o.Src == "" {
+			return o, errors.New("-dest is required with -files-from or archive sources")
+		}
+		if len(o.Sources) > 1 {
+			return o, errors.New("-dest is required with more than one -src")
+		}
+		o.Dest = o.Src
+	} else {
+		destAbs, err := filepath.Abs(o.Dest)
+		if err != nil {
+			return o, err
+		}
+		o.Dest = destAbs
+	}
+
+	o.Mode = strings.ToLower(strings.TrimSpace(o.Mode))
+	if o.Mode != "move" && o.Mode != "copy" {
+		return o, errors.New("invalid -mode (use 'move' or 'copy')")
+	}
+	if o.Update {
+		conflictSet := false
+		flag.Visit(func(f *flag.Flag) { conflictSet = conflictSet || f.Name == "on-conflict" })
+		if conflictSet && o.OnConflict != "newer" {
+			return o, fmt.Errorf("-update cannot be combined with -on-conflict %s", o.OnConflict)
+		}
+		o.OnConflict = "newer"
+	}
+	if o.DeleteUpToDate && (!o.Update || o.Mode != "move") {
+		return o, errors.New("-delete-up-to-date needs -update and -mode move")
+	}
+	if o.MtimeTolerance < 0 {
+		return o, errors.New("invalid -mtime-tolerance (use a duration like 2s)")
+	}
+	if !conflictPolicies[o.OnConflict] {
+		return o, errors.New("invalid -on-conflict (use skip, overwrite, rename, newer or error)")
+	}
+	if !destCaseModes[o.DestCase] {
+		return o, errors.New("invalid -dest-case (use auto, sensitive or insensitive)")
+	}
+	if o.MaxDepth >= 0 && !o.Recursive {
+		return o, errors.New("-max-depth needs -recursive")
+	}
+	if !placeholderModes[o.Placeholders] {
+		return o, errors.New("invalid -placeholders (use skip, category or move)")
+	}
+	if o.Settle < 0 {
+		return o, errors.New("-settle must not be negative")
+	}
+	if o.Sample < 0 {
+		return o, errors.New("-sample must not be negative")
+	}
+	if o.Sample > 0 && o.CursorPath != "" {
+		return o, errors.New("-sample can't be combined with -cursor")
+	}
+	if o.Sample > 0 {
+		seedSet := false
+		flag.Visit(func(f *flag.Flag) { seedSet = seedSet || f.Name == "seed" })
+		if !seedSet {
+			o.Seed = time.Now().UnixNano()
+		}
+	}
+	if o.MaxFiles < 0 {
+		return o, errors.New("-max-files must not be negative")
+	}
+	if !batchOrders[o.BatchOrder] {
+		return o, errors.New("invalid -batch-order (use oldest, newest, name, largest or smallest)")
+	}
+	if o.CursorPath != "" && ((o.MaxFiles == 0 && o.MaxBytesFlag == "") || o.BatchOrder != "oldest") {
+		return o, errors.New("-cursor needs -max-files or -max-bytes, and -batch-order oldest")
+	}
+	if !hardlinkModes[o.Hardlinks] {
+		return o, errors.New("invalid -hardlinks (use link, skip or copy)")
+	}
+	o.Links = newLinkTracker(o.Hardlinks)
+	if o.DeferredDelete && o.Mode != "move" {
+		return o, errors.New("-deferred-delete needs -mode move")
+	}
+	if !longNamePolicies[o.LongNames] {
+		return o, errors.New("invalid -long-names (use shorten or error)")
+	}
+	if o.MaxNameLen < 0 || (o.MaxNameLen > 0 && o.MaxNameLen < 32) {
+		return o, errors.New("invalid -max-name-len (use 0 or at least 32)")
+	}
+	if !normalizeForms[o.NormalizeNames] {
+		return o, errors.New("invalid -normalize-names (use nfc, nfd or none)")
+	}
+	o.Case = newCaseFolder(o.DestCase, o.DryRun)
+	o.WinNames = newWindowsNames(o.WindowsSafe)
+	if o.ReplacedRetention < 0 {
+		return o, errors.New("invalid -replaced-retention (use a number of days)")
+	}
+	o.RunID = time.Now().Format(runIDFormat)
+	if o.DeleteIdentical && o.Mode != "move" {
+		return o, errors.New("-delete-identical-source needs -mode move")
+	}
+	if o.Interactive && !explain {
+		if o.FilesFrom == "-" {
+			return o, errors.New("-interactive-conflicts cannot read answers while -files-from reads stdin")
+		}
+		var err error
+		if o.Prompter, err = newConflictPrompter(); err != nil {
+			return o, err
+		}
+	}
+	if o.KeepVersions < 0 || (o.KeepVersions > 0 && o.OnConflict != "rename" && !o.Interactive) {
+		return o, errors.New("-keep-versions needs a positive count and -on-conflict rename")
+	}
+	if o.OnConflict == "rename" || o.Interactive {
+		var err error
+		if o.Renamer, err = newRenamer(o.RenameTemplate); err != nil {
+			return o, err
+		}
+	}
+	if len(o.Archives) > 0 {
+		modeSet := false
+		flag.Visit(func(f *flag.Flag) { modeSet = modeSet || f.Name == "mode" })
+		if modeSet && o.Mode == "move" {
+			return o, errors.New("-mode move is not supported for archive sources; entries are extracted (copied)")
+		}
+	}
+
+	var err error
+	if o.DestRoots, err = parseDestFor(o.DestFor, o.Sources); err != nil {
+		return o, err
+	}
+
+	if o.MusicLayout, err = parseMusicLayout(o.MusicLayoutFlag); err != nil {
+		return o, err
+	}
+
+	if o.PhotoLayout, err = parsePhotoLayout(o.PhotoLayoutFlag); err != nil {
+		return o, err
+	}
+	if o.NameTemplates, err = parseNameTemplates(o.NameFlags); err != nil {
+		return o, err
+	}
+	if o.By != "category" && o.By != "mime" {
+		return o, errors.New("invalid -by (use category or mime)")
+	}
+	if o.DuplicatesTo != "" {
+		if o.DuplicatesTo, err = cleanCategory(o.DuplicatesTo); err != nil {
+			return o, fmt.Errorf("invalid -duplicates-to: %v", err)
+		}
+	}
+	mode, err := strconv.ParseUint(o.OwnerDirMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return o, errors.New("invalid -owner-dir-mode (use octal permissions like 0750)")
+	}
+	o.OwnerMode = os.FileMode(mode)
+	switch o.Projects {
+	case "":
+	case "skip", "move":
+		if o.ProjectMarkers, err = parseProjectMarkers(o.MarkerFlag); err != nil {
+			return o, err
+		}
+	default:
+		return o, errors.New("invalid -projects (use skip or move)")
+	}
+	if !timeSources[o.TimeSource] {
+		return o, errors.New("invalid -time-source (use mtime, ctime or birth)")
+	}
+	if o.Manifest != "" {
+		if o.Manifest, err = filepath.Abs(o.Manifest); err != nil {
+			return o, err
+		}
+	}
+	if o.ConflictReport != "" && !explain {
+		path, err := filepath.Abs(o.ConflictReport)
+		if err != nil {
+			return o, err
+		}
+		o.Report = &conflictReport{path: path}
+	}
+	if o.CursorPath != "" && !explain {
+		if o.Cursor, err = loadCursor(o.CursorPath); err != nil {
+			return o, fmt.Errorf("invalid -cursor: %w", err)
+		}
+	}
+	if o.Include, err = parseGlobs("include", o.IncludeFlags); err != nil {
+		return o, err
+	}
+	if o.Exclude, err = parseGlobs("exclude", o.ExcludeFlags); err != nil {
+		return o, err
+	}
+	if o.IncludeMIME, err = parseMIMEFilter(o.IncludeMIMEFlag); err != nil {
+		return o, err
+	}
+	if o.Match, err = parseRegexps("match", o.MatchFlags); err != nil {
+		return o, err
+	}
+	if o.NotMatch, err = parseRegexps("not-match", o.NotMatchFlags); err != nil {
+		return o, err
+	}
+	if o.MinSize, err = parseSize(o.MinSizeFlag); err != nil {
+		return o, fmt.Errorf("-min-size: %v", err)
+	}
+	if o.MaxBytesFlag != "" {
+		if o.MaxBytes, err = parseSize(o.MaxBytesFlag); err != nil || o.MaxBytes <= 0 {
+			return o, fmt.Errorf("invalid -max-bytes %q (use a size like 20GB)", o.MaxBytesFlag)
+		}
+	}
+	if o.Owners, err = parseOwnerFilter(o); err != nil {
+		return o, err
+	}
+	now := time.Now()
+	if o.SinceFlag != "" {
+		if o.Since, err = parseCutoff("since", o.SinceFlag, now); err != nil {
+			return o, err
+		}
+	}
+	if o.BeforeFlag != "" {
+		if o.Before, err = parseCutoff("before", o.BeforeFlag, now); err != nil {
+			return o, err
+		}
+	}
+	if !o.Since.IsZero() && !o.Before.IsZero() && !o.Since.Before(o.Before) {
+		return o, fmt.Errorf("-since %s is not before -before %s", o.Since.Format(time.RFC3339), o.Before.Format(time.RFC3339))
+	}
+	o.MaxSize = -1
+	if o.MaxSizeFlag != "" {
+		if o.MaxSize, err = parseSize(o.MaxSizeFlag); err != nil {
+			return o, fmt.Errorf("-max-size: %v", err)
+		}
+		if o.MaxSize < o.MinSize {
+			return o, errors.New("-max-size is smaller than -min-size")
+		}
+	}
+	if o.Shard, err = parseShard(o.ShardFlag, o.HashAlgo); err != nil {
+		return o, err
+	}
+	if o.MaxPerDir != 0 {
+		if o.Limiter, err = newDirLimiter(o.MaxPerDir, o.OverflowName); err != nil {
+			return o, err
+		}
+	}
+	if o.AgeBucketFlag != "" {
+		if o.AgeBuckets, err = parseAgeBuckets(o.AgeBucketFlag); err != nil {
+			return o, err
+		}
+	}
+	if o.SizeBucketFlag != "" {
+		if o.SizeBuckets, err = parseSizeBuckets(o.SizeBucketFlag); err != nil {
+			return o, err
+		}
+	}
+	if o.LayoutFlag != "" {
+		if o.Layout, err = parseLayoutTemplate(o.LayoutFlag); err != nil {
+			return o, err
+		}
+		o.Layout.sizes = o.SizeBuckets
+		if o.Layout.sizes == nil {
+			o.Layout.sizes, _ = parseSizeBuckets(defaultSizeBuckets)
+		}
+		if o.DateDirs || o.MusicLayoutFlag != "" || o.PhotoLayoutFlag != "" || o.VideoResolution {
+			return o, errors.New("-layout cannot be combined with -date-dirs, -music-layout, -photo-layout or -video-resolution")
+		}
+	}
+	if len(o.Archives) > 0 {
+		if name := o.archiveUnsupported(); name != "" {
+			return o, fmt.Errorf("%s is not supported for archive sources; entries are placed by name, size and time only", name)
+		}
+	}
+	if err := validateDateFormat("-date-format", o.DateFormat); err != nil {
+		return o, err
+	}
+	if err := validateDateFormat("-photo-date-format", o.PhotoDateFormat); err != nil {
+		return o, err
+	}
+	if o.GeoGrid <= 0 || o.GeoGrid > 90 {
+		return o, errors.New("invalid -geo-grid (use a size in degrees, e.g. 0.1)")
+	}
+	if o.VideoResolution {
+		if o.VideoBuckets, err = parseVideoBuckets(o.VideoBucketFlag); err != nil {
+			return o, err
+		}
+	}
+
+	o.Dotfiles = strings.ToLower(strings.TrimSpace(o.Dotfiles))
+	if o.Dotfiles != "category" && o.Dotfiles != "strip" {
+		return o, errors.New("invalid -dotfiles (use 'category' or 'strip')")
+	}
+
+	if o.UnknownCategory, err = cleanCategory(o.UnknownCategory); err != nil {
+		return o, fmt.Errorf("invalid -unknown-category: %v", err)
+	}
+
+	o.Categorizer = newCategorizer()
+	o.Categorizer.dotfiles = o.Dotfiles
+	o.Categorizer.unknown = o.UnknownCategory
+	o.Categorizer.splitUnknown = o.SplitUnknown
+	o.Categorizer.split["code"] = o.SplitCode
+	o.Categorizer.detectScreenshot = o.Screenshots
+	o.Categorizer.byOrigin = o.ByOrigin
+	o.Categorizer.byMIME = o.By == "mime"
+	o.Categorizer.mimeSubtypes = o.MIMESubtypes
+	o.Categorizer.sniff = o.Sniff
+	o.Categorizer.foldNames = o.FoldNames
+	for _, v := range o.RuleFlags {
+		r, err := parseRuleFlag(v)
+		if err != nil {
+			return o, err
+		}
+		o.Categorizer.patterns = append(o.Categorizer.patterns, r)
+	}
+	if !o.NoDefaultIgnores {
+		o.Junk = append([]string(nil), defaultJunk...)
+	}
+	if o.Rules != "" {
+		rules, err := loadRules(o.Rules)
+		if err != nil {
+			return o, fmt.Errorf("invalid -rules: %w", err)
+		}
+		o.Categorizer.override(rules.Ext, filepath.Base(o.Rules))
+		o.Categorizer.overrideNames(rules.Filenames, filepath.Base(o.Rules))
+		o.Categorizer.screenshots = append(o.Categorizer.screenshots, rules.Screenshots...)
+		o.Junk = append(o.Junk, rules.Junk...)
+		o.Regions = rules.Regions
+		for cat, table := range rules.Subcategories {
+			o.Categorizer.overrideSubcategories(cat, table)
+		}
+		o.Categorizer.patterns = append(o.Categorizer.patterns, rules.Patterns...)
+	}
+	if len(o.MapFlags) > 0 {
+		overrides, err := parseMapFlags(o.MapFlags)
+		if err != nil {
+			return o, err
+		}
+		o.Categorizer.override(overrides, "-map")
+	}
+
+	preservePerms, preserveTimes = !o.NoPreservePerms, !o.NoPreserveTimes
+	preserveXattrs, preserveOwner = o.PreserveXattrs, !o.NoPreserveOwner
+	if !durabilityModes[o.Durability] {
+		return o, fmt.Errorf("invalid -durability %q (use full, default or none)", o.Durability)
+	}
+	durability = o.Durability
+	if !symlinkTargets[o.SymlinkTargets] {
+		return o, fmt.Errorf("invalid -symlink-targets %q (use adjust or keep)", o.SymlinkTargets)
+	}
+	switch o.OnRemoveFailure {
+	case "rollback", "keep":
+		keepBothCopies = o.OnRemoveFailure == "keep"
+	default:
+		return o, fmt.Errorf("invalid -on-remove-failure %q (use rollback or keep)", o.OnRemoveFailure)
+	}
+	if !specialFileModes[o.SpecialFiles] {
+		return o, fmt.Errorf("invalid -special-files %q (use skip or rename)", o.SpecialFiles)
+	}
+
+	if o.Scope, err = parseCategoryScope(o); err != nil {
+		return o, err
+	}
+	o.Excluded = make(map[string]bool)
+	o.excludeNested()
+
+	if !explain {
+		if err := os.MkdirAll(o.Dest, 0755); err != nil {
+			return o, err
+		}
+	}
+
+	// the lock covers the whole -dest, not one -run-subdir folder
+	o.LockPath = filepath.Join(o.Dest, stateDir, lockFileName)
+
+	if o.RunSubdir {
+		name := sanitizeComponent(time.Now().Format(o.RunFormat))
+		if name == "" || name == o.RunFormat {
+			return o, fmt.Errorf("invalid -run-format %q: needs date or time fields", o.RunFormat)
+		}
+		o.RunDir = filepath.Join(o.Dest, name)
+		o.Dest = o.RunDir
+		for cat, root := range o.DestRoots {
+			o.DestRoots[cat] = filepath.Join(root, name)
+		}
+	}
+
+	if o.KeepVersions > 0 && !explain {
+		if o.Versions, err = loadVersions(o.Dest); err != nil {
+			return o, err
+		}
+	}
+
+	return o, nil
+}
+
+func run(ctx context.Context, o Options) error {
+	start := time.Now()
+
+	if !o.DryRun {
+		lock, err := acquireLock(o.LockPath, o.WaitLock)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+	stop := catchInterrupts()
+	// halted says why the run stops early: a signal or -timeout
+	halted := func() string {
+		switch {
+		case stop.Load():
+			return "interrupted"
+		case ctx.Err() != nil:
+			return "-timeout " + o.Timeout.String() + " reached"
+		}
+		return ""
+	}
+	var unfinished, abandoned int // files not started / copies given up once halted
+	var unfinishedBytes int64
+
+	if n := o.cleanTemps(); n > 0 && !o.DryRun {
+		fmt.Fprintf(os.Stderr, "WARN: removed %d temporary file(s) left by an interrupted run\n", n)
+	}
+
+	var files []fileEntry
+	invalidListed := 0
+	var scanned scanCounts
+	if o.FilesFrom != "" {
+		r := os.Stdin
+		if o.FilesFrom != "-" {
+			f, err := os.Open(o.FilesFrom)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		var err error
+		if files, invalidListed, err = readFileList(r, o.NulList, o.Sources); err != nil {
+			return fmt.Errorf("reading -files-from: %v", err)
+		}
+	} else {
+		for _, src := range o.Sources {
+			found, err := o.collectFiles(ctx, src, &scanned)
+			if err != nil && ctx.Err() == nil {
+				return err
+			}
+			files = append(files, found...)
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "WARN: -timeout reached while scanning", src)
+				break
+			}
+		}
+		if o.WarnFiles > 0 && len(files) > o.WarnFiles {
+			fmt.Fprintf(os.Stderr, "WARN: the scan found %d files, more than -warn-files %d; if -src %s is not what you meant, press Ctrl-C now\n", len(files), o.WarnFiles, strings.Join(o.Sources, ", "))
+		}
+	}
+
+	files, sidecars := attachSidecars(files)
+	files, junk := o.selectJunk(files)
+	files, filtered := o.selectFiles(files)
+	files, matchFiltered := o.selectMatches(files)
+	files, sizeFiltered := o.selectSizes(files)
+	files, timeFiltered := o.selectTimes(files)
+	files, ownerFiltered := o.selectOwners(files)
+	files, unsettled := o.selectSettled(files, start)
+	files, placeholdersLeft := o.selectPlaceholders(files)
+	files, beforeCursor := o.Cursor.skip(files)
+	files, mimeFiltered := o.selectMIME(files)
+	population := len(files)
+	if o.Sample > 0 {
+		files = sampleFiles(files, o.Sample, o.Seed)
+	}
+	if o.MaxFiles > 0 || o.MaxBytes > 0 {
+		orderBatch(files, o.BatchOrder)
+	}
+	if o.Verbose {
+		// everything the scan returned, before any of it was left out
+		found := population + len(junk) + filtered + matchFiltered + sizeFiltered + timeFiltered +
+			ownerFiltered + unsettled + placeholdersLeft["empty"] + placeholdersLeft["cloud"] + beforeCursor + mimeFiltered
+		fmt.Println("Files found:", found)
+		if sidecars > 0 {
+			fmt.Println("Sidecars ("+sidecarSuffix+") paired with their files:", sidecars)
+		}
+		if filtered > 0 {
+			fmt.Println("Filtered by -include/-exclude:", filtered)
+		}
+		if matchFiltered > 0 {
+			fmt.Println("Filtered by -match/-not-match:", matchFiltered)
+		}
+		if sizeFiltered > 0 {
+			fmt.Println("Filtered by size:", sizeFiltered)
+		}
+		if timeFiltered > 0 {
+			fmt.Println("Filtered by time:", timeFiltered)
+		}
+		if len(scanned.Ignored) > 0 {
+			fmt.Println("Ignored by " + ignoreFileName + ":")
+			rules := make([]string, 0, len(scanned.Ignored))
+			for r := range scanned.Ignored {
+				rules = append(rules, r)
+			}
+			sort.Strings(rules)
+			for _, r := range rules {
+				fmt.Printf("  %s: %d\n", r, scanned.Ignored[r])
+			}
+		}
+	}
+	if o.Verbose || o.DryRun {
+		printRules(o.Categorizer)
+	}
+
+	moved := 0
+	skipped := 0
+	failed := 0
+	probeFailed := 0
+	projects := 0
+	duplicates := 0
+	var dupBytes int64
+	var dups *dupIndex
+	if o.DuplicatesTo != "" {
+		dups = newDupIndex()
+	}
+	unknownExts := make(map[string]int)
+	usage := make(rootUsages)
+	usesDates := o.DateDirs || (o.Layout != nil && o.Layout.usesDate())
+
+	defer func() {
+		if err := o.Report.write(); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write -conflict-report:", err)
+		}
+	}()
+
+	plan, folded := o.planCategories(files)
+	if !o.IgnoreSpaceCheck {
+		if err := o.checkSpace(files, plan); err != nil {
+			if !o.DryRun {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "WARN:", err)
+		}
+	}
+
+	var mf *manifest
+	if o.Manifest != "" && !o.DryRun {
+		var err error
+		if mf, err = openManifest(o.Manifest); err != nil {
+			return err
+		}
+		defer mf.Close()
+	}
+	junkDeleted := 0
+	if o.DeleteJunk {
+		junkDeleted = o.deleteJunk(junk, mf)
+	}
+	dateFolders := make(map[string]bool)
+	layoutFolders := make(map[string]bool)
+	bucketCounts := make(map[string]int)
+	ageCounts := make(map[string]int)
+	shardCounts := make(map[string]int)
+
+	sourceFiles := make(map[string]int)
+	sourceFailed := make(map[string]int)
+	placed := make(map[string]string) // destKey -> source, to catch two sources sharing a name
+	conflicts := make(map[string]int)
+	identical := 0
+	organized := 0
+	outOfScope := 0
+	junkEntries := 0
+	linkEntries := 0
+	taken, remaining := 0, 0
+	var reached, firstFailed time.Time // for -cursor
+	var transferred, deferredBytes int64
+	deferredFiles := 0
+	verifiedCount, verifyFailed := 0, 0
+	var relocated moveCounts
+	var deferred deferredDeletes
+	linksKept, linksSkipped := 0, 0
+	var linkBytes int64
+	symlinks, retargeted := 0, 0
+	disappeared := 0
+	rolledBack, bothKept := 0, 0
+	var pre *preflight
+	if o.DryRun {
+		pre = newPreflight(o.ProbeWrites)
+	}
+	answered := 0
+	newFiles := 0
+	displaced := 0
+	purged := 0
+	if o.KeepReplaced && o.ReplacedRetention > 0 {
+		var err error
+		if purged, err = o.purgeReplaced(start); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot purge replaced files:", err)
+		}
+	}
+
+	for i, f := range files {
+		if halted() != "" {
+			remaining = len(files) - i
+			unfinished += remaining
+			for _, f := range files[i:] {
+				if f.Info != nil {
+					unfinishedBytes += f.Info.Size()
+				}
+			}
+			break
+		}
+		if o.MaxFiles > 0 && taken >= o.MaxFiles {
+			remaining = len(files) - i
+			break
+		}
+		if f.Info != nil {
+			reached = f.Info.ModTime()
+		}
+		srcPath := f.Path
+		sourceFiles[f.Root]++
+		// the cursor must not move past files this run left behind
+		holdCursor := func() {
+			if f.Info != nil && (firstFailed.IsZero() || f.Info.ModTime().Before(firstFailed)) {
+				firstFailed = f.Info.ModTime()
+			}
+		}
+		fail := func() {
+			failed++
+			sourceFailed[f.Root]++
+			holdCursor()
+		}
+		// gone tells a source that disappeared since the scan (moved or
+		// cleaned up by someone else) from a real failure; it is skipped.
+		gone := func(err error) bool {
+			if !errors.Is(err, os.ErrNotExist) {
+				return false
+			}
+			if _, serr := os.Lstat(srcPath); !errors.Is(serr, os.ErrNotExist) {
+				return false
+			}
+			skipped++
+			disappeared++
+			fmt.Println("DISAPPEARED:", srcPath, "is no longer there, skipped")
+			return true
+		}
+		rel, err := filepath.Rel(f.Root, srcPath)
+		if err != nil {
+			fail()
+			fmt.Fprintln(os.Stderr, "WARN: cannot build relative path for", srcPath, ":", err)
+			continue
+		}
+
+		if f.Marker != "" {
+			if !o.Scope.includes("projects") {
+				outOfScope++
+				continue
+			}
+			if o.Projects == "skip" {
+				skipped++
+				if o.Verbose || o.DryRun {
+					fmt.Printf("SKIP project: %s [marker: %s]\n", srcPath, f.Marker)
+				}
+				continue
+			}
+			dest, err := o.placeProject(f, rel)
+			if errors.Is(err, errProjectInPlace) {
+				skipped++
+				continue
+			}
+			if err != nil {
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN:", err)
+				continue
+			}
+			moved++
+			projects++
+			taken++
+			if err := mf.record(manifestEntry{Action: o.Mode, Src: srcPath, Dest: dest, Dir: true}); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+			}
+			continue
+		}
+
+		m := plan[i]
+		if !o.Scope.includes(m.Category) {
+			outOfScope++
+			if o.Verbose {
+				fmt.Printf("OUT OF SCOPE: %s [%s]\n", srcPath, m.Category)
+			}
+			continue
+		}
+		if m.SniffErr != nil && o.Verbose {
+			fmt.Fprintln(os.Stderr, "WARN: cannot sniff", srcPath, ":", m.SniffErr)
+		}
+		if m.UnknownExt != "" {
+			unknownExts[m.UnknownExt]++
+		}
+
+		var size int64
+		var when time.Time
+		var timeSource string
+		info := f.Info
+		if info != nil {
+			size = info.Size()
+			if usesDates && f.Placeholder == "" {
+				when, timeSource = o.fileTime(srcPath, info)
+			}
+		}
+
+		var dupNote, dupSum string
+		if dups != nil && info != nil && f.Placeholder == "" && f.Link == "" && f.Special == "" {
+			_, catDir := o.categoryDir(m.Category)
+			dups.scan(catDir)
+			orig, sum, err := dups.find(srcPath, size)
+			if gone(err) {
+				continue
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot hash", srcPath, ":", err)
+			}
+			dupSum = sum
+			if orig != "" {
+				m.Category = filepath.Join(o.DuplicatesTo, m.Category)
+				dupNote = "duplicate of " + orig
+			}
+		}
+
+		pl, err := o.place(srcPath, rel, m, info, when, start)
+		if gone(err) {
+			continue
+		}
+		if err != nil {
+			fail()
+			fmt.Fprintln(os.Stderr, "WARN:", err)
+			continue
+		}
+		if pl.ProbeErr != nil {
+			probeFailed++
+			fmt.Fprintln(os.Stderr, "WARN:", pl.ProbeErr)
+		}
+		if pl.TemplateDir != "" {
+			layoutFolders[pl.TemplateDir] = true
+		}
+		if len(o.AgeBuckets) > 0 && info != nil {
+			age := pl.Age
+			if age == "" {
+				age = "current"
+			}
+			ageCounts[age]++
+		}
+		if pl.SizeBucket != "" {
+			bucketCounts[pl.SizeBucket]++
+		}
+		if pl.DateDir != "" {
+			dateFolders[pl.DateDir] = true
+		}
+		root, ownerDir := pl.Root, pl.OwnerDir
+		destDir, destPath := pl.Dir, pl.Path
+		layoutNote, ageNote := pl.LayoutNote, pl.AgeNote
+
+		var origName string
+		var newName, nameNote string
+		if f.Placeholder == "" && f.Link == "" && f.Special == "" {
+			newName, nameNote = o.metadataName(srcPath, filepath.Base(destPath), m, info)
+		}
+		if newName != "" {
+			origName = filepath.Base(destPath)
+			destPath = filepath.Join(destDir, newName)
+		}
+		if o.SanitizeNames {
+			if slug := o.slugName(filepath.Base(destPath)); slug != filepath.Base(destPath) {
+				if origName == "" {
+					origName = filepath.Base(destPath)
+				}
+				destPath = filepath.Join(destDir, slug)
+			}
+		}
+		var spellNote string
+		if norm, existing := o.normalizePath(root, destPath); norm != destPath {
+			destPath, destDir = norm, filepath.Dir(norm)
+			if existing != "" {
+				spellNote = "existing spelling: " + filepath.Base(existing)
+			}
+		}
+		var sanitizedFrom, safeNote string
+		if safe := o.windowsSafePath(root, destPath); safe != destPath {
+			sanitizedFrom, safeNote = destPath, "windows-safe: "+filepath.Base(destPath)
+			destPath, destDir = safe, filepath.Dir(safe)
+		}
+		if fit, err := o.fitNames(root, destPath); err != nil {
+			fail()
+			fmt.Fprintln(os.Stderr, "WARN:", err)
+			continue
+		} else if fit != destPath {
+			if sanitizedFrom == "" {
+				sanitizedFrom = destPath
+			}
+			destPath, destDir = fit, filepath.Dir(fit)
+		}
+
+		var sum, staged string
+		if o.Shard != nil && !((f.Placeholder == "cloud" || f.Link != "" || f.Special != "") && o.Shard.Mode == "hash") {
+			name := filepath.Base(destPath)
+			shard, hashSum, stagedPath, err := o.shard(ctx, srcPath, filepath.Dir(destPath), name)
+			if gone(err) {
+				continue
+			}
+			if err != nil {
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN:", err)
+				continue
+			}
+			sum, staged = hashSum, stagedPath
+			destDir = filepath.Join(filepath.Dir(destPath), shard)
+			destPath = filepath.Join(destDir, name)
+			shardCounts[shard]++
+		}
+
+		inPlace := sameFile(srcPath, destPath)
+		if f.Link != "" {
+			// sameFile would follow the link
+			inPlace = resolvedPath(srcPath) == resolvedPath(destPath)
+		}
+		if inPlace || (o.Limiter != nil && o.Limiter.holds(destPath, srcPath)) {
+			discardStaged(staged)
+			skipped++
+			organized++
+			if o.Verbose {
+				fmt.Println("IN PLACE:", srcPath)
+			}
+			continue
+		}
+
+		if o.Limiter != nil {
+			destDir = o.Limiter.assign(destDir)
+			destPath = filepath.Join(destDir, filepath.Base(destPath))
+		}
+		if info != nil && info.Mode().IsRegular() && f.Placeholder != "cloud" {
+			same, err := identicalFile(srcPath, size, destPath)
+			if gone(err) {
+				discardStaged(staged)
+				continue
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot compare", srcPath, "with", destPath, ":", err)
+			}
+			if same {
+				discardStaged(staged)
+				skipped++
+				identical++
+				row := conflictRowFor(srcPath, destPath)
+				row.Identical, row.Policy, row.Outcome = true, o.OnConflict, "identical, skipped"
+				o.Report.add(row)
+				if o.Verbose || o.DryRun {
+					fmt.Printf("IDENTICAL: %s already at %s\n", srcPath, destPath)
+				}
+				if o.DeleteIdentical {
+					if o.DryRun {
+						fmt.Println("DRY-RUN: delete identical source", srcPath)
+					} else if o.DeferredDelete {
+						deferred.add(manifestEntry{Action: "delete-identical", Src: srcPath, Dest: destPath, Size: size})
+					} else if err := os.Remove(srcPath); err != nil {
+						fmt.Fprintln(os.Stderr, "WARN: cannot delete identical source:", err)
+					} else if err := mf.record(manifestEntry{Action: "delete-identical", Src: srcPath, Dest: destPath, Size: size}); err != nil {
+						fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+					}
+				}
+				continue
+			}
+		}
+		var linkKey inodeKey
+		var linkTo string
+		if o.Links != nil && info != nil && info.Mode().IsRegular() {
+			if key, ok := inodeOf(srcPath, info); ok {
+				if first, seen := o.Links.dest[key]; !seen {
+					linkKey = key
+				} else if o.Links.mode == "skip" {
+					discardStaged(staged)
+					skipped++
+					linksSkipped++
+					if o.Verbose || o.DryRun {
+						fmt.Printf("HARDLINK: %s is linked to what went to %s, skipped\n", srcPath, first)
+					}
+					continue
+				} else {
+					linkTo = first
+				}
+			}
+		}
+		var srcTime time.Time
+		if info != nil {
+			srcTime = info.ModTime()
+		}
+		res, err := o.resolveConflict(srcPath, srcTime, destPath, placed)
+		if err != nil {
+			discardStaged(staged)
+			return err
+		}
+		if res.Outcome != "" {
+			conflicts[res.Outcome]++
+			o.reportConflict(srcPath, destPath, res)
+		}
+		if res.Asked {
+			answered++
+		}
+		if res.Outcome == conflictUpToDate && o.DeleteUpToDate {
+			if o.DryRun {
+				fmt.Println("DRY-RUN: delete up-to-date source", srcPath)
+			} else if o.DeferredDelete {
+				deferred.add(manifestEntry{Action: "delete-up-to-date", Src: srcPath, Dest: destPath, Size: size})
+			} else if err := os.Remove(srcPath); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot delete up-to-date source:", err)
+			} else if err := mf.record(manifestEntry{Action: "delete-up-to-date", Src: srcPath, Dest: destPath, Size: size}); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+			}
+		}
+		if res.Path == "" {
+			discardStaged(staged)
+			skipped++
+			if res.Asked {
+				if err := mf.record(manifestEntry{Action: "skip", Src: srcPath, Dest: destPath, Size: size, Conflict: res.Outcome}); err != nil {
+					fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+				}
+			}
+			continue
+		}
+		if o.MaxBytes > 0 && linkTo == "" && transferred+size > o.MaxBytes {
+			discardStaged(staged)
+			deferredFiles++
+			deferredBytes += size
+			holdCursor()
+			if o.Verbose || o.DryRun {
+				fmt.Printf("DEFERRED: %s (%s), over -max-bytes %s\n", srcPath, formatBytes(size), o.MaxBytesFlag)
+			}
+			continue
+		}
+		transferred += size
+		versionOf := ""
+		if res.Outcome == conflictRenamed {
+			versionOf = destPath
+		}
+		destPath = res.Path
+		placed[o.destKey(destPath)] = srcPath
+		taken++
+
+		if o.KeepReplaced && res.replaces() {
+			kept, err := o.keepReplaced(root, m.Category, destPath)
+			if err != nil {
+				discardStaged(staged)
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN:", err)
+				continue
+			}
+			displaced++
+			if err := mf.record(kept); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+			}
+		}
+
+		if ownerDir != "" && !o.DryRun {
+			if err := ensureOwnerDir(ownerDir, o.OwnerMode, info); err != nil {
+				discardStaged(staged)
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN:", err)
+				continue
+			}
+		}
+		if err := ensureDir(destDir, o.DryRun, o.Verbose); err != nil {
+			discardStaged(staged)
+			fail()
+			fmt.Fprintln(os.Stderr, "WARN:", err)
+			continue
+		}
+
+		if pre != nil {
+			dirs := []string{destDir}
+			if o.Mode == "move" {
+				dirs = append(dirs, filepath.Dir(srcPath))
+			}
+			if err := pre.check(dirs...); err != nil {
+				discardStaged(staged)
+				fail()
+				fmt.Printf("WOULD FAIL: %s -> %s: %v\n", srcPath, destPath, err)
+				continue
+			}
+		}
+		symTarget := ""
+		if f.Link != "" {
+			symTarget = linkTarget(srcPath, destPath, f.Link, o.SymlinkTargets == "adjust")
+		}
+		if o.Verbose || o.DryRun {
+			var notes []string
+			timeNote := ""
+			if timeSource != "" {
+				timeNote = "time: " + timeSource
+			}
+			for _, n := range []string{m.Via, dupNote, ageNote, layoutNote, nameNote, spellNote, safeNote, timeNote} {
+				if n != "" {
+					notes = append(notes, n)
+				}
+			}
+			note := ""
+			if len(notes) > 0 {
+				note = " [" + strings.Join(notes, "; ") + "]"
+			}
+			verb := strings.ToUpper(o.Mode)
+			if linkTo != "" {
+				verb, note = "LINK", note+" (hardlink to "+linkTo+")"
+			}
+			if f.Link != "" {
+				note += " (symlink to " + symTarget + ")"
+			}
+			fmt.Printf("%s: %s -> %s%s\n", verb, srcPath, destPath, note)
+			if f.Sidecar != "" && o.DryRun {
+				fmt.Printf("SIDECAR: %s -> %s\n", f.Sidecar, destPath+sidecarSuffix)
+			}
+		}
+
+		if dups != nil {
+			if dupNote != "" {
+				duplicates++
+				dupBytes += size
+			} else if o.DryRun {
+				dups.add(srcPath, dupSum, size)
+			} else {
+				dups.add(destPath, dupSum, size)
+			}
+		}
+
+		countSymlink := func() {
+			if symTarget != "" {
+				symlinks++
+				if symTarget != f.Link {
+					retargeted++
+				}
+			}
+		}
+		if o.DryRun {
+			moved++
+			countSymlink()
+			if linkTo != "" {
+				linksKept++
+				linkBytes += size
+			} else {
+				usage.add(root, size)
+			}
+			if linkKey != (inodeKey{}) {
+				o.Links.dest[linkKey] = destPath
+			}
+			if res.Outcome == "" {
+				newFiles++
+			}
+			if versionOf != "" {
+				o.trackVersion(versionOf, destPath)
+			}
+			continue
+		}
+
+		pending := false
+		var verified string
+		copyFailed := func(what string, err error) {
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				// abandoned midway; the temporary copy is gone
+				holdCursor()
+				abandoned++
+				unfinishedBytes += size
+				fmt.Fprintln(os.Stderr, "WARN: "+what+" of", srcPath, "abandoned:", halted())
+				return
+			}
+			if gone(err) {
+				return
+			}
+			fail()
+			if errors.Is(err, errVerify) {
+				verifyFailed++
+			}
+			if errors.Is(err, errRolledBack) {
+				rolledBack++
+			}
+			if errors.Is(err, errBothKept) {
+				bothKept++
+				if err := mf.record(manifestEntry{Action: "source-kept", Src: srcPath, Dest: destPath, Size: size}); err != nil {
+					fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+				}
+			}
+			fmt.Fprintln(os.Stderr, "WARN: "+what+" failed:", err)
+		}
+		if f.Placeholder == "cloud" {
+			// a rename keeps the data online; copying would download it
+			if err := os.Rename(srcPath, longPath(destPath)); gone(err) {
+				continue
+			} else if err != nil {
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN: cannot move online-only file", srcPath, "without downloading it:", err)
+				continue
+			}
+		} else if linkTo != "" {
+			if err := os.Link(linkTo, longPath(destPath)); err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: cannot hardlink", destPath, "to", linkTo+", copying instead:", err)
+				linkTo = ""
+			} else {
+				discardStaged(staged)
+			}
+		}
+		if linkTo != "" {
+			if o.Mode == "move" && o.DeferredDelete {
+				pending = true
+				deferred.add(manifestEntry{Action: "delete-source", Src: srcPath, Dest: destPath, Size: size})
+			} else if o.Mode == "move" {
+				if err := os.Remove(srcPath); err != nil {
+					fmt.Fprintln(os.Stderr, "WARN: cannot delete linked source:", err)
+				}
+			}
+		} else if f.Special != "" {
+			// a FIFO or device has nothing to copy; renaming is all there is
+			if err := os.Rename(srcPath, longPath(destPath)); gone(err) {
+				continue
+			} else if err != nil {
+				fail()
+				if crossDevice(err) {
+					fmt.Fprintf(os.Stderr, "WARN: cannot move %s %s to another filesystem, left in place\n", f.Special, srcPath)
+				} else {
+					fmt.Fprintln(os.Stderr, "WARN: move failed:", explainLength(destPath, err))
+				}
+				continue
+			}
+			relocated.count(false)
+		} else if f.Link != "" {
+			move := o.Mode == "move" && !o.DeferredDelete
+			created, err := placeLink(srcPath, destPath, symTarget, move)
+			if err != nil {
+				copyFailed("symlink", err)
+				continue
+			}
+			if move {
+				relocated.count(created)
+			} else if o.Mode == "move" {
+				pending = true
+				deferred.add(manifestEntry{Action: "delete-source", Src: srcPath, Dest: destPath, Size: size})
+			}
+		} else if o.DeferredDelete {
+			// phase one: copy and verify, the source stays
+			var err error
+			if staged != "" {
+				if err = os.Rename(staged, longPath(destPath)); err != nil {
+					err = explainLength(destPath, err)
+					discardStaged(staged)
+				} else if o.Verify {
+					verified, err = verifyCopy(destPath, o.Shard.Algo, sum)
+				}
+			} else if o.Verify {
+				verified, err = copyVerified(ctx, srcPath, destPath)
+			} else {
+				err = copyFile(ctx, srcPath, destPath)
+			}
+			if err == nil {
+				if err = verifySize(srcPath, destPath); err != nil {
+					removePartial(destPath)
+				}
+			}
+			if err != nil {
+				copyFailed("copy", err)
+				continue
+			}
+			pending = true
+			deferred.add(manifestEntry{Action: "delete-source", Src: srcPath, Dest: destPath, Size: size})
+		} else if o.Mode == "move" && f.Target != "" {
+			copied, v, err := moveLinked(ctx, srcPath, f.Target, destPath, o.Verify)
+			if err != nil {
+				copyFailed("move", err)
+				continue
+			}
+			verified = v
+			relocated.count(copied)
+		} else if o.Mode == "move" && o.Verify {
+			var err error
+			if verified, err = moveVerified(ctx, srcPath, destPath); err != nil {
+				copyFailed("move", err)
+				continue
+			}
+			relocated.count(verified != "")
+		} else if o.Mode == "move" {
+			copied, err := relocate(ctx, srcPath, destPath)
+			if err != nil {
+				copyFailed("move", err)
+				continue
+			}
+			relocated.count(copied)
+		} else if staged != "" {
+			if err := os.Rename(staged, longPath(destPath)); err != nil {
+				err = explainLength(destPath, err)
+				discardStaged(staged)
+				fail()
+				fmt.Fprintln(os.Stderr, "WARN: copy failed:", err)
+				continue
+			}
+			if o.Verify {
+				var err error
+				if verified, err = verifyCopy(destPath, o.Shard.Algo, sum); err != nil {
+					copyFailed("copy", err)
+					continue
+				}
+			}
+		} else if o.Verify {
+			var err error
+			if verified, err = copyVerified(ctx, srcPath, destPath); err != nil {
+				copyFailed("copy", err)
+				continue
+			}
+		} else {
+			if err := copyFile(ctx, srcPath, destPath); err != nil {
+				copyFailed("copy", err)
+				continue
+			}
+		}
+		if verified != "" {
+			verifiedCount++
+		}
+		moved++
+		countSymlink()
+		if linkTo != "" {
+			linksKept++
+			linkBytes += size
+		} else {
+			usage.add(root, size)
+		}
+		if linkKey != (inodeKey{}) {
+			o.Links.dest[linkKey] = destPath
+		}
+		if res.Outcome == "" {
+			newFiles++
+		}
+		if versionOf != "" {
+			o.trackVersion(versionOf, destPath)
+		}
+		action := o.Mode
+		if pending {
+			action = "copy"
+		}
+		mtime, atime := sourceTimes(info)
+		if err := mf.record(manifestEntry{
+			Action:        action,
+			Src:           srcPath,
+			Dest:          destPath,
+			Size:          size,
+			TimeSource:    timeSource,
+			FileTime:      formatFileTime(when),
+			Hash:          o.Shard.hashLabel(sum),
+			OriginalName:  origName,
+			SanitizedFrom: sanitizedFrom,
+			Conflict:      res.Outcome,
+			VersionOf:     versionOf,
+			DeleteSource:  pending,
+			LinkOf:        linkTo,
+			Symlink:       symTarget,
+			Verified:      verified,
+			Mtime:         mtime,
+			Atime:         atime,
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+		}
+		if f.Sidecar != "" {
+			o.carrySidecar(ctx, f.Sidecar, destPath, pending, &deferred, mf)
+		}
+		noteDir(filepath.Dir(destPath))
+		if o.Mode == "move" && !pending {
+			noteDir(filepath.Dir(srcPath))
+		}
+	}
+
+	processed := len(files) - remaining - abandoned
+	if o.Cursor != nil && !o.DryRun {
+		if !firstFailed.IsZero() && firstFailed.Before(reached) {
+			reached = firstFailed
+		}
+		if err := o.Cursor.save(reached); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot write -cursor:", err)
+		}
+	}
+	for i, a := range o.Archives {
+		if why := halted(); why != "" {
+			fmt.Printf("Archives not extracted (%s): %d\n", why, len(o.Archives)-i)
+			break
+		}
+		st, err := o.extractArchive(a, placed, dateFolders, start, mf)
+		if err != nil {
+			return err
+		}
+		for k, n := range st.Conflicts {
+			conflicts[k] += n
+		}
+		for k, n := range st.Ages {
+			ageCounts[k] += n
+		}
+		for k, n := range st.Buckets {
+			bucketCounts[k] += n
+		}
+		for dir := range st.LayoutFolders {
+			layoutFolders[dir] = true
+		}
+		processed += st.Entries
+		moved += st.Extracted
+		skipped += st.Skipped
+		filtered += st.Filtered
+		matchFiltered += st.MatchFiltered
+		mimeFiltered += st.MIMEFiltered
+		sizeFiltered += st.SizeFiltered
+		timeFiltered += st.TimeFiltered
+		outOfScope += st.OutOfScope
+		junkEntries += st.Junk
+		linkEntries += st.Links
+		failed += st.Failed
+		if len(o.Sources)+len(o.Archives) > 1 {
+			sourceFiles[a] += st.Entries
+			sourceFailed[a] += st.Failed
+		}
+	}
+
+	// the copies must be on disk before -deferred-delete removes sources
+	flushDirs()
+	// phase two of -deferred-delete
+	deletedSources, keptSources := deferred.finish(failed == 0 && halted() == "", mf)
+
+	if !o.DryRun {
+		if err := o.Versions.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot save version lineage:", err)
+		}
+	}
+
+	switch {
+	case stop.Load():
+		fmt.Println("Interrupted.")
+	case ctx.Err() != nil:
+		fmt.Println("Timed out.")
+	default:
+		fmt.Println("Done.")
+	}
+	fmt.Println("Processed:", processed)
+	fmt.Println("Succeeded:", moved)
+	fmt.Println("Skipped:", skipped)
+	fmt.Println("Failed:", failed)
+	if disappeared > 0 {
+		fmt.Println("Disappeared since the scan, skipped:", disappeared)
+	}
+	if linkEntries > 0 {
+		fmt.Println("Archive link and special entries not extracted, skipped:", linkEntries)
+	}
+	if rolledBack+bothKept > 0 {
+		fmt.Printf("Sources that could not be removed after copying: %d copy(ies) rolled back, %d left as two copies (\"source-kept\" in -manifest)\n", rolledBack, bothKept)
+	}
+	if pre != nil {
+		pre.summary()
+	}
+	if len(o.Include) > 0 || len(o.Exclude) > 0 {
+		fmt.Println("Filtered:", filtered)
+		if scanned.Pruned > 0 {
+			fmt.Println("Excluded folders not scanned:", scanned.Pruned)
+		}
+	}
+	if len(o.Match) > 0 || len(o.NotMatch) > 0 {
+		fmt.Println("Filtered by -match/-not-match:", matchFiltered)
+	}
+	if len(o.IncludeMIME) > 0 {
+		fmt.Println("Filtered by -include-mime:", mimeFiltered)
+	}
+	if o.Owners.active() {
+		fmt.Println("Filtered by owner:", ownerFiltered)
+	}
+	if o.MinSize > 0 || o.MaxSize >= 0 {
+		fmt.Println("Filtered by size:", sizeFiltered)
+	}
+	if len(junk)+junkEntries+scanned.JunkDirs > 0 {
+		how := "skipped"
+		if o.DeleteJunk {
+			how = fmt.Sprintf("%d deleted", junkDeleted)
+		}
+		fmt.Printf("Junk: %d file(s), %s; %d archive entries, %d folder(s) not scanned\n", len(junk), how, junkEntries, scanned.JunkDirs)
+	}
+	if o.Placeholders != "move" && len(placeholdersLeft) > 0 {
+		fmt.Printf("Placeholders left in place: %d empty, %d online-only\n", placeholdersLeft["empty"], placeholdersLeft["cloud"])
 	}
-}
-
-func parseFlags() (Options, error) {
-	var o Options
-
-	flag.StringVar(&o.Src, "src", "", "Source directory to organize")
-	flag.StringVar(&o.Dest, "dest", "", "Destination root directory (default: same as src)")
-	flag.StringVar(&o.Mode, "mode", "move", "Operation mode: move or copy")
-	flag.BoolVar(&o.Recursive, "recursive", false, "Scan directories recursively")
-	flag.BoolVar(&o.DryRun, "dry-run", false, "Show what would happen without changing files")
-	flag.BoolVar(&o.Verbose, "verbose", false, "Print detailed actions")
-
-	flag.Parse()
-
-	if o.Src == "" {
-		return o, errors.New("missing required flag: -src")
+	if o.Settle > 0 || o.SettleRecheck {
+		fmt.Println("Not settled, left for a later run:", unsettled)
 	}
-
-	srcAbs, err := filepath.Abs(o.Src)
-	if err != nil {
-		return o, err
+	if o.Verbose && o.PreserveXattrs && (xattrStats.Files > 0 || xattrStats.Rejected > 0) {
+		fmt.Printf("Extended attributes: %d copied onto %d file(s), %d refused by the destination\n", xattrStats.Copied, xattrStats.Files, xattrStats.Rejected)
 	}
-	o.Src = srcAbs
-
-	if o.Dest == "" {
-		o.Dest = o.Src
-	} else {
-		destAbs, err := filepath.Abs(o.Dest)
-		if err != nil {
-			return o, err
+	if o.Mode == "move" && relocated.Renamed+relocated.Copied > 0 {
+		fmt.Printf("Moved: %d renamed, %d copied across filesystems\n", relocated.Renamed, relocated.Copied)
+	}
+	if o.Verify {
+		fmt.Printf("Verified copies: %d; verification failures: %d (sources kept)\n", verifiedCount, verifyFailed)
+	}
+	if o.MaxBytes > 0 {
+		fmt.Printf("Transferred: %s of -max-bytes %s; deferred: %d file(s), %s left for the next run\n", formatBytes(transferred), o.MaxBytesFlag, deferredFiles, formatBytes(deferredBytes))
+	}
+	if o.Sample > 0 {
+		printSample(files, plan, population, o.Seed)
+	}
+	if o.MaxFiles > 0 {
+		fmt.Printf("Batch: %d of -max-files %d taken, remaining: %d\n", taken, o.MaxFiles, remaining)
+		if o.Cursor != nil {
+			fmt.Println("Older than -cursor, not examined:", beforeCursor)
 		}
-		o.Dest = destAbs
 	}
-
-	o.Mode = strings.ToLower(strings.TrimSpace(o.Mode))
-	if o.Mode != "move" && o.Mode != "copy" {
-		return o, errors.New("invalid -mode (use 'move' or 'copy')")
+	if o.Scope != nil {
+		fmt.Println("Out of scope (-only-categories/-skip-categories):", outOfScope)
 	}
-
-	info, err := os.Stat(o.Src)
-	if err != nil {
-		return o, err
+	if o.RespectGitignore {
+		fmt.Println("Ignored by .gitignore:", scanned.GitIgnored)
 	}
-	if !info.IsDir() {
-		return o, errors.New("-src must be a directory")
+	if o.FollowSymlinks {
+		fmt.Printf("Symlinks: %d broken, skipped; %d cycle(s) broken; %d pointing at files found already\n", scanned.BrokenLinks, scanned.LinkCycles, scanned.LinkedTwice)
 	}
-
-	if err := os.MkdirAll(o.Dest, 0755); err != nil {
-		return o, err
+	if scanned.Special > 0 {
+		fmt.Println("Special files skipped (FIFOs, sockets, devices):", scanned.Special)
+	}
+	if o.MaxDepth >= 0 {
+		fmt.Printf("Folders below -max-depth %d, not scanned: %d\n", o.MaxDepth, scanned.DepthPruned)
+	}
+	if o.SkipHidden {
+		fmt.Printf("Hidden, left in place: %d file(s), %d folder(s) not scanned\n", scanned.Hidden, scanned.HiddenDirs)
+	}
+	if !o.Since.IsZero() || !o.Before.IsZero() {
+		var cut []string
+		if !o.Since.IsZero() {
+			cut = append(cut, "since "+o.Since.Format(time.RFC3339))
+		}
+		if !o.Before.IsZero() {
+			cut = append(cut, "before "+o.Before.Format(time.RFC3339))
+		}
+		fmt.Printf("Filtered by time: %d (%s %s)\n", timeFiltered, o.TimeSource, strings.Join(cut, ", "))
+	}
+	if invalidListed > 0 {
+		fmt.Println("Invalid list entries:", invalidListed)
+	}
+	if len(o.Sources)+len(o.Archives) > 1 {
+		for _, src := range append(o.Sources, o.Archives...) {
+			fmt.Printf("  %s: processed %d, failed %d\n", src, sourceFiles[src], sourceFailed[src])
+		}
+	}
+	var excluded []string
+	for dir, met := range o.Excluded {
+		if met {
+			excluded = append(excluded, dir)
+		}
+	}
+	if len(excluded) > 0 {
+		sort.Strings(excluded)
+		fmt.Printf("Excluded destination folders: %d (%s), %d file(s) already organized not rescanned (-rescan-organized)\n", len(excluded), strings.Join(excluded, ", "), scanned.Organized)
+	}
+	if o.RunDir != "" {
+		switch {
+		case o.DryRun:
+			fmt.Println("Run directory:", o.RunDir, "(dry-run, not created)")
+		case moved == 0:
+			fmt.Println("Run directory:", o.RunDir, "(nothing processed, not created)")
+		default:
+			fmt.Println("Run directory:", o.RunDir)
+		}
+	}
+	if o.DeferredDelete && !o.DryRun {
+		if why := halted(); why != "" && keptSources > 0 {
+			fmt.Printf("Sources kept: %d (-deferred-delete: %s, so no source was deleted; copies are in place)\n", keptSources, why)
+		} else if failed > 0 && keptSources > 0 {
+			fmt.Printf("Sources kept: %d (-deferred-delete: %d file(s) failed, so no source was deleted; copies are in place; a re-run with -delete-identical-source finishes the move)\n", keptSources, failed)
+		} else {
+			fmt.Printf("Sources deleted after the run: %d", deletedSources)
+			if keptSources > 0 {
+				fmt.Printf(", kept %d (see warnings)", keptSources)
+			}
+			fmt.Println()
+		}
+	}
+	if linksKept > 0 {
+		fmt.Printf("Hardlinks preserved: %d (%s not copied again)\n", linksKept, formatBytes(linkBytes))
+	}
+	if linksSkipped > 0 {
+		fmt.Println("Hardlinks skipped:", linksSkipped)
+	}
+	if symlinks > 0 {
+		fmt.Printf("Symlinks placed as links: %d (%d relative target(s) adjusted)\n", symlinks, retargeted)
+	}
+	if organized > 0 {
+		fmt.Println("Already organized, skipped:", organized)
+	}
+	if identical > 0 {
+		fmt.Println("Identical, skipped:", identical)
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("Conflicts: %s\n", formatCounts(conflicts))
+	}
+	if o.Update {
+		fmt.Printf("Update: new %d, updated %d, up to date %d\n", newFiles, conflicts[conflictUpdated], conflicts[conflictUpToDate])
 	}
+	if answered > 0 {
+		fmt.Println("Conflicts answered at the prompt:", answered)
+	}
+	if o.KeepReplaced {
+		fmt.Printf("Replaced kept: %d (store: %s in %s", displaced, formatBytes(storeUsage(replacedRoot(o.Dest))), replacedRoot(o.Dest))
+		if purged > 0 {
+			fmt.Printf(", %d old run(s) purged", purged)
+		}
+		fmt.Println(")")
+	}
+	if projects > 0 {
+		fmt.Println("Projects:", projects)
+	}
+	if len(folded) > 0 {
+		fmt.Printf("Folded into %s: %s\n", miscCategory, formatCounts(folded))
+	}
+	if dups != nil {
+		fmt.Printf("Duplicates: %d (%s reclaimable)\n", duplicates, formatBytes(dupBytes))
+	}
+	if o.DateDirs {
+		fmt.Println("Date folders:", len(dateFolders))
+	}
+	if len(o.AgeBuckets) > 0 {
+		fmt.Printf("Age buckets: %s\n", formatCounts(ageCounts))
+	}
+	if len(o.SizeBuckets) > 0 {
+		fmt.Printf("Size buckets: %s\n", formatCounts(bucketCounts))
+	}
+	if o.Shard != nil {
+		if o.Shard.Mode == "hash" {
+			fmt.Println("Shards:", len(shardCounts))
+		} else {
+			fmt.Printf("Shards: %d (%s)\n", len(shardCounts), formatCounts(shardCounts))
+		}
+	}
+	if o.Layout != nil {
+		fmt.Printf("Layout folders: %d (%s)\n", len(layoutFolders), o.Layout.Source)
+	}
+	if probeFailed > 0 {
+		fmt.Println("Probe failures:", probeFailed)
+	}
+	if len(unknownExts) > 0 {
+		fmt.Printf("Unknown extensions: %d (%s)\n", len(unknownExts), formatCounts(unknownExts))
+	}
+	if len(o.DestRoots) > 0 {
+		printRootUsage(usage)
+	}
+	if why := halted(); why != "" {
+		fmt.Printf("Not processed (%s): %d file(s), %s\n", why, unfinished+abandoned, formatBytes(unfinishedBytes))
+		if abandoned > 0 {
+			fmt.Printf("Copies abandoned midway: %d (nothing left behind)\n", abandoned)
+		}
+	}
+	fmt.Println("Duration:", time.Since(start).Round(time.Millisecond))
 
-	return o, nil
+	if stop.Load() {
+		return errInterrupted
+	}
+	return ctx.Err()
 }
 
-func run(o Options) error {
-	start := time.Now()
+// placement is where a categorized file goes before sharding, overflow
+// folders and collision checks are applied.
+type placement struct {
+	Root     string // destination root the file counts against
+	OwnerDir string // -by-owner folder to create, if any
+	Dir      string
+	Path     string
 
-	files, err := collectFiles(o.Src, o.Recursive)
-	if err != nil {
-		return err
-	}
+	LayoutNote, AgeNote string
+	Age, SizeBucket     string
+	DateDir             string // -date-dirs folder, if the file was dated
+	TemplateDir         string // folder resolved from -layout
+	ProbeErr            error  // metadata probe failed; the file stays in its category
+}
 
-	if o.Verbose {
-		fmt.Println("Files found:", len(files))
+// place computes the destination of one file from its category and the
+// layout flags. It only reads metadata; nothing is created.
+func (o Options) place(srcPath, rel string, m match, info os.FileInfo, when, now time.Time) (placement, error) {
+	var p placement
+	root, destDir := o.categoryDir(m.Category)
+	p.Root = root
+	base := root
+	if o.ByOwner && info != nil {
+		if owner := fileOwner(info); owner != "" {
+			p.OwnerDir = filepath.Join(root, owner)
+			if rest, err := filepath.Rel(root, destDir); err == nil {
+				destDir = filepath.Join(p.OwnerDir, rest)
+			}
+			base = p.OwnerDir
+		}
 	}
-
-	moved := 0
-	skipped := 0
-	failed := 0
-
-	for _, srcPath := range files {
-		rel, err := filepath.Rel(o.Src, srcPath)
+	var destPath string
+	if o.Layout != nil && m.Category != placeholderCategory {
+		if info == nil {
+			return p, fmt.Errorf("cannot stat %s", srcPath)
+		}
+		_, ext := o.Categorizer.splitExt(filepath.Base(rel))
+		resolved, err := o.Layout.resolve(srcPath, filepath.Base(rel), ext, m, info, when)
 		if err != nil {
-			failed++
-			fmt.Fprintln(os.Stderr, "WARN: cannot build relative path for", srcPath, ":", err)
-			continue
+			return p, err
 		}
-
-		ext := strings.ToLower(filepath.Ext(srcPath))
-		category := categoryByExt(ext)
-
-		destDir := filepath.Join(o.Dest, category)
-		destPath := filepath.Join(destDir, filepath.Base(rel))
-
-		if sameFile(srcPath, destPath) {
-			skipped++
-			continue
+		destPath = filepath.Join(base, resolved)
+		p.TemplateDir = filepath.Dir(destPath)
+	} else {
+		if len(o.AgeBuckets) > 0 && info != nil {
+			if p.Age = o.AgeBuckets.bucket(info.ModTime(), now); p.Age != "" {
+				destDir = filepath.Join(destDir, p.Age)
+				p.AgeNote = "age: " + p.Age
+			}
 		}
-
-		if err := ensureDir(destDir, o.DryRun, o.Verbose); err != nil {
-			failed++
-			fmt.Fprintln(os.Stderr, "WARN:", err)
-			continue
+		if len(o.SizeBuckets) > 0 && info != nil {
+			if p.SizeBucket = o.SizeBuckets.bucket(info.Size()); p.SizeBucket != "" {
+				destDir = filepath.Join(destDir, p.SizeBucket)
+			}
 		}
-
-		if o.Verbose || o.DryRun {
-			fmt.Printf("%s: %s -> %s\n", strings.ToUpper(o.Mode), srcPath, destPath)
+		if o.DateDirs && !o.photoDated(m) && !when.IsZero() {
+			destDir = filepath.Join(destDir, dateDir(when, o.DateFormat))
+			p.DateDir = destDir
 		}
+		sub, note, err := o.layoutDir(srcPath, m)
+		p.LayoutNote, p.ProbeErr = note, err
+		destPath = filepath.Join(destDir, sub, filepath.Base(rel))
+	}
 
-		if o.DryRun {
-			moved++
-			continue
+	if dir := filepath.Dir(rel); o.KeepStructure && dir != "." {
+		if !filepath.IsLocal(dir) {
+			return p, fmt.Errorf("unsafe relative path %s", rel)
 		}
+		destPath = filepath.Join(filepath.Dir(destPath), dir, filepath.Base(destPath))
+	}
+	p.Dir, p.Path = filepath.Dir(destPath), destPath
+	return p, nil
+}
 
-		if o.Mode == "move" {
-			if err := moveFile(srcPath, destPath); err != nil {
-				failed++
-				fmt.Fprintln(os.Stderr, "WARN: move failed:", err)
-				continue
-			}
-		} else {
-			if err := copyFile(srcPath, destPath); err != nil {
-				failed++
-				fmt.Fprintln(os.Stderr, "WARN: copy failed:", err)
-				continue
-			}
+// formatCounts renders a count map as "a x3, b x1", most frequent first.
+func formatCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
 		}
-		moved++
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s x%d", k, m[k])
 	}
+	return strings.Join(parts, ", ")
+}
 
-	fmt.Println("Done.")
-	fmt.Println("Processed:", len(files))
-	fmt.Println("Succeeded:", moved)
-	fmt.Println("Skipped:", skipped)
-	fmt.Println("Failed:", failed)
-	fmt.Println("Duration:", time.Since(start).Round(time.Millisecond))
+// fileEntry is a collected file with the Lstat result taken while
+// scanning; Info is nil when that failed.
+type fileEntry struct {
+	Root        string // the -src directory the file was found under
+	Path        string
+	Info        os.FileInfo
+	Marker      string // set for project directories found by -projects
+	Placeholder string // "empty" or "cloud", see placeholderKind
+	Target      string // -follow-symlinks: where a symlinked file points; Info describes it
+	Link        string // a symlink placed as a link: what it points to (Readlink)
+	Special     string // -special-files rename: the kind of special file, see specialKind
+	Sidecar     string // its <name>.organizer.json, placed along with it
+}
 
-	return nil
+func newFileEntry(root, path string, d os.DirEntry) fileEntry {
+	info, err := d.Info()
+	if err != nil {
+		info = nil
+	}
+	return fileEntry{Root: root, Path: path, Info: info}
 }
 
-func collectFiles(root string, recursive bool) ([]string, error) {
-	var out []string
+// collectFiles lists the files under root. With -projects markers set,
+// recursive scans stop at directories holding a marker and return them as
+// a single project entry instead. Directories in o.Excluded are not
+// entered; the ones met are marked true. Folders matching -exclude or an
+// .organizerignore file and, with -skip-hidden, hidden entries are not
+// walked at all; counts tallies them.
+// A cancelled ctx stops the scan; what was found so far is returned with
+// the context's error.
+func (o Options) collectFiles(ctx context.Context, root string, counts *scanCounts) ([]fileEntry, error) {
+	var out []fileEntry
+	var ignore ignoreRules
+	useIgnore := !o.NoIgnoreFile
+	var git gitIgnores
+	ignored := func(rel string, dir bool) bool {
+		r := ignore.match(rel, dir)
+		if r == nil {
+			return false
+		}
+		if counts.Ignored == nil {
+			counts.Ignored = make(map[string]int)
+		}
+		counts.Ignored[r.source]++
+		return true
+	}
 
-	if !recursive {
+	if !o.Recursive {
+		if useIgnore {
+			if err := ignore.load(root, ".", ignoreFileName); err != nil {
+				return nil, err
+			}
+		}
+		if o.RespectGitignore {
+			if err := git.enter(root, "."); err != nil {
+				return nil, err
+			}
+		}
 		entries, err := os.ReadDir(root)
 		if err != nil {
 			return nil, err
 		}
 		for _, e := range entries {
-			if e.IsDir() {
+			if e.IsDir() || (useIgnore && e.Name() == ignoreFileName) {
+				continue
+			}
+			path := filepath.Join(root, e.Name())
+			if skipJunction(path, e) {
+				continue
+			}
+			if o.SkipHidden && isHidden(e) {
+				counts.Hidden++
+				continue
+			}
+			if useIgnore && ignored(e.Name(), false) {
+				continue
+			}
+			if o.RespectGitignore && (e.Name() == ".git" || git.rules.match(e.Name(), false) != nil) {
+				counts.GitIgnored++
+				continue
+			}
+			if o.FollowSymlinks && e.Type()&os.ModeSymlink != 0 {
+				target, info, err := followLink(path)
+				if err != nil {
+					counts.BrokenLinks++
+					fmt.Fprintln(os.Stderr, "WARN: broken symlink", path+":", err)
+					continue
+				}
+				if !info.IsDir() && !o.skipSpecial(path, specialKind(info.Mode()), true, counts) {
+					out = append(out, fileEntry{Root: root, Path: path, Info: info, Target: target})
+				}
+				continue
+			}
+			if e.Type()&os.ModeSymlink != 0 {
+				if l, ok := linkEntry(root, path, e); ok {
+					out = append(out, l)
+				}
+				continue
+			}
+			kind := specialKind(e.Type())
+			if o.skipSpecial(path, kind, false, counts) {
 				continue
 			}
-			out = append(out, filepath.Join(root, e.Name()))
+			fe := newFileEntry(root, path, e)
+			fe.Special = kind
+			out = append(out, fe)
 		}
-		return out, nil
+		return dropLinkedTwice(out, counts), nil
 	}
 
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	// walk scans real and reports what it finds under logical, which is
+	// the path of the symlink it was reached through (or real itself).
+	var visited map[string]bool // -follow-symlinks: folders entered so far
+	if o.FollowSymlinks {
+		visited = make(map[string]bool)
+	}
+	var visit func(p, path string, d os.DirEntry) error
+	var walk func(real, logical string) error
+	walk = func(real, logical string) error {
+		return filepath.WalkDir(real, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			path := logical
+			if p != real {
+				sub, err := filepath.Rel(real, p)
+				if err != nil {
+					return err
+				}
+				path = filepath.Join(logical, sub)
+			}
+			return visit(p, path, d)
+		})
+	}
+	visit = func(p, path string, d os.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
+		if path != root && skipJunction(path, d) {
+			return nil
+		}
 		if d.IsDir() {
+			if d.Name() == stateDir && path != root {
+				return filepath.SkipDir
+			}
+			for _, dir := range []string{path, p} {
+				if _, ok := o.Excluded[dir]; ok {
+					o.Excluded[dir] = true
+					counts.Organized += countFiles(dir)
+					return filepath.SkipDir
+				}
+			}
+			if visited != nil {
+				id := dirIdentity(p, d)
+				if visited[id] {
+					counts.LinkCycles++
+					if o.Verbose {
+						fmt.Println("SYMLINK CYCLE:", path, "leads back to a folder already scanned")
+					}
+					return filepath.SkipDir
+				}
+				visited[id] = true
+			}
+			if path != root {
+				if len(o.Exclude) > 0 && o.Exclude.matches(rel) {
+					counts.Pruned++
+					return filepath.SkipDir
+				}
+				if o.SkipHidden && isHidden(d) {
+					counts.HiddenDirs++
+					return filepath.SkipDir
+				}
+				if o.isJunk(d.Name()) {
+					counts.JunkDirs++
+					return filepath.SkipDir
+				}
+				if useIgnore && ignored(rel, true) {
+					return filepath.SkipDir
+				}
+				if o.RespectGitignore && (d.Name() == ".git" || git.rules.match(rel, true) != nil) {
+					counts.GitIgnored++
+					return filepath.SkipDir
+				}
+				// the folder's entries would be at depth = number of elements in rel
+				if o.MaxDepth >= 0 && strings.Count(rel, string(filepath.Separator))+1 > o.MaxDepth {
+					counts.DepthPruned++
+					return filepath.SkipDir
+				}
+			}
+			if useIgnore {
+				if err := ignore.load(path, rel, ignoreFileName); err != nil {
+					return err
+				}
+			}
+			if o.RespectGitignore {
+				if err := git.enter(path, rel); err != nil {
+					return err
+				}
+			}
+			if path != root && len(o.ProjectMarkers) > 0 {
+				if m := projectMarker(path, o.ProjectMarkers); m != "" {
+					e := newFileEntry(root, path, d)
+					e.Marker = m
+					out = append(out, e)
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if useIgnore && d.Name() == ignoreFileName {
+			return nil
+		}
+		if o.SkipHidden && isHidden(d) {
+			counts.Hidden++
+			return nil
+		}
+		if useIgnore && ignored(rel, false) {
+			return nil
+		}
+		if o.RespectGitignore && (d.Name() == ".git" || git.rules.match(rel, false) != nil) {
+			counts.GitIgnored++
+			return nil
+		}
+		if o.FollowSymlinks && d.Type()&os.ModeSymlink != 0 {
+			target, info, err := followLink(p)
+			if err != nil {
+				counts.BrokenLinks++
+				fmt.Fprintln(os.Stderr, "WARN: broken symlink", path+":", err)
+				return nil
+			}
+			if info.IsDir() {
+				return walk(target, path)
+			}
+			if !o.skipSpecial(path, specialKind(info.Mode()), true, counts) {
+				out = append(out, fileEntry{Root: root, Path: path, Info: info, Target: target})
+			}
+			return nil
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			if l, ok := linkEntry(root, path, d); ok {
+				out = append(out, l)
+			}
+			return nil
+		}
+		kind := specialKind(d.Type())
+		if o.skipSpecial(path, kind, false, counts) {
 			return nil
 		}
-		out = append(out, path)
+		fe := newFileEntry(root, path, d)
+		fe.Special = kind
+		out = append(out, fe)
 		return nil
-	})
-	if err != nil {
+	}
+	if err := walk(root, root); err != nil {
+		if ctx.Err() != nil {
+			return dropLinkedTwice(out, counts), err
+		}
 		return nil, err
 	}
-	return out, nil
+	return dropLinkedTwice(out, counts), nil
 }
 
-func categoryByExt(ext string) string {
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".bmp", ".tiff":
-		return "images"
-	case ".mp4", ".mov", ".mkv", ".avi", ".webm":
-		return "videos"
-	case ".mp3", ".wav", ".flac", ".aac", ".m4a":
-		return "audio"
-	case ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".txt", ".md":
-		return "documents"
-	case ".zip", ".tar", ".gz", ".tgz", ".rar", ".7z":
-		return "archives"
-	case ".go", ".py", ".js", ".ts", ".java", ".c", ".cpp", ".cs", ".html", ".css", ".json", ".yaml", ".yml", ".sh":
-		return "code"
-	default:
-		if ext == "" {
-			return "no_extension"
-		}
-		return "other"
-	}
+// scanCounts tallies what collectFiles left out.
+type scanCounts struct {
+	Pruned      int            // folders matching -exclude
+	Hidden      int            // hidden files (-skip-hidden)
+	HiddenDirs  int            // hidden folders not scanned
+	Ignored     map[string]int // .organizerignore "file:line pattern" -> files and folders it excluded
+	DepthPruned int            // folders below -max-depth
+	Organized   int            // files in destination folders that were not scanned
+	BrokenLinks int            // -follow-symlinks: links whose target is missing
+	LinkCycles  int            // -follow-symlinks: links back into a folder already scanned
+	LinkedTwice int            // -follow-symlinks: symlinked files whose target was found already
+	JunkDirs    int            // folders like $RECYCLE.BIN not scanned
+	Special     int            // FIFOs, sockets and devices (-special-files)
+	GitIgnored  int            // -respect-gitignore: files and folders git ignores
 }
 
 func ensureDir(dir string, dryRun bool, verbose bool) error {
@@ -223,47 +2315,172 @@ func ensureDir(dir string, dryRun bool, verbose bool) error {
 		}
 		return nil
 	}
-	return os.MkdirAll(dir, 0755)
+	return explainLength(dir, os.MkdirAll(longPath(dir), 0755))
 }
 
 func moveFile(src, dest string) error {
-	if err := os.Rename(src, dest); err == nil {
+	_, err := relocate(context.Background(), src, dest)
+	return err
+}
+
+// moveCounts tells renames from copies across filesystems in -mode move.
+type moveCounts struct {
+	Renamed, Copied int
+}
+
+func (c *moveCounts) count(copied bool) {
+	if copied {
+		c.Copied++
+	} else {
+		c.Renamed++
+	}
+}
+
+// rename is os.Rename; tests swap it to take the copy fallback of moves.
+var rename = os.Rename
+
+// relocate renames src to dest, copying and removing src only when they
+// are on different filesystems; any other rename error is returned as is.
+// It reports whether a copy was made.
+func relocate(ctx context.Context, src, dest string) (bool, error) {
+	err := rename(src, longPath(dest))
+	if err == nil {
+		return false, nil
+	}
+	if !crossDevice(err) {
+		return false, explainLength(dest, err)
+	}
+
+	if err := copyFile(ctx, src, dest); err != nil {
+		return true, err
+	}
+	if err := verifySize(src, dest); err != nil {
+		removePartial(dest)
+		return true, err
+	}
+	return true, finishMove(src, dest)
+}
+
+// keepBothCopies is set by -on-remove-failure keep.
+var keepBothCopies bool
+
+// removeSource is os.Remove; tests swap it where root ignores a read-only
+// folder.
+var removeSource = os.Remove
+
+// errRolledBack and errBothKept mark a move across filesystems whose
+// source could not be removed after it was copied (read-only mount,
+// permissions): the copy was deleted again, or with -on-remove-failure
+// keep both are left and the run records them.
+var (
+	errRolledBack = errors.New("copy rolled back")
+	errBothKept   = errors.New("source and copy both kept")
+)
+
+// finishMove ends a move across filesystems once src was copied to dest:
+// the copy is synced and src removed. If either fails, the move is undone
+// by removing dest, unless -on-remove-failure keep is set.
+func finishMove(src, dest string) error {
+	err := syncBeforeRemove(dest)
+	if err != nil {
+		err = fmt.Errorf("cannot sync folder: %v", err)
+	} else if err = removeSource(src); err == nil || errors.Is(err, os.ErrNotExist) {
 		return nil
 	}
+	if keepBothCopies {
+		return fmt.Errorf("%w: %s was copied to %s but %v", errBothKept, src, dest, err)
+	}
+	if rerr := os.Remove(dest); rerr != nil {
+		return fmt.Errorf("%w: %s was copied to %s but %v; removing the copy failed too: %v", errBothKept, src, dest, err, rerr)
+	}
+	return fmt.Errorf("%w, %s left in place: %v", errRolledBack, src, err)
+}
 
-	if err := copyFile(src, dest); err != nil {
+func verifySize(src, dest string) error {
+	if li, err := os.Lstat(src); err == nil && isSymlink(li) {
+		// placed as a link, perhaps with an adjusted target
+		di, err := os.Lstat(dest)
+		if err == nil && !isSymlink(di) {
+			err = fmt.Errorf("%s is not a symlink", dest)
+		}
+		return err
+	}
+	si, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	di, err := os.Stat(dest)
+	if err != nil {
 		return err
 	}
-	return os.Remove(src)
+	if si.Size() != di.Size() {
+		return fmt.Errorf("copy of %s is %d bytes, expected %d", src, di.Size(), si.Size())
+	}
+	return nil
 }
 
-func copyFile(src, dest string) error {
+// copyFile copies src to dest; a cancelled ctx abandons the copy.
+func copyFile(ctx context.Context, src, dest string) error {
 	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	out, err := os.Create(dest)
-	if err != nil {
+	return writeAtomic(dest, in, func(out io.Writer) error {
+		if n, err := io.Copy(out, cancelable(ctx, in)); err != nil {
+			return copyError(src, dest, n, err)
+		}
+		return nil
+	})
+}
+
+// ensureOwnerDir creates a -by-owner folder with the configured mode and,
+// when running as root, hands it to the file's owner; an existing folder
+// is left alone.
+func ensureOwnerDir(dir string, mode os.FileMode, info os.FileInfo) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
 		return err
 	}
-	defer func() {
-		_ = out.Close()
-	}()
-
-	if _, err := io.Copy(out, in); err != nil {
+	// MkdirAll is subject to the umask
+	if err := os.Chmod(dir, mode); err != nil {
 		return err
 	}
-	return out.Sync()
+	if id, ok := fileOwnerIDs(info); ok && geteuid() == 0 {
+		return chown(dir, id.UID, id.GID)
+	}
+	return nil
+}
+
+// discardStaged removes a temporary copy that won't be renamed into place.
+func discardStaged(path string) {
+	if path != "" {
+		_ = os.Remove(path)
+	}
 }
 
+// sameFile reports whether a and b name the same file: by device and
+// inode when both exist (symlinked folders, bind mounts, case-insensitive
+// names), otherwise by path with the parent folders' symlinks resolved.
 func sameFile(a, b string) bool {
-	aa, err1 := filepath.Abs(a)
-	bb, err2 := filepath.Abs(b)
-	if err1 != nil || err2 != nil {
-		return false
+	ai, err1 := os.Stat(a)
+	bi, err2 := os.Stat(b)
+	if err1 == nil && err2 == nil {
+		return os.SameFile(ai, bi)
 	}
-	return aa == bb
+	return resolvedPath(a) == resolvedPath(b)
 }
 
+func resolvedPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestEntry is one line of the -manifest file, written after each file
+// is moved or copied.
+type manifestEntry struct {
+	Action     string `json:"action"`
+	Src        string `json:"src"`
+	Dest       string `json:"dest"`
+	Size       int64  `json:"size"`
+	Dir        bool   `json:"dir,omitempty"`
+	TimeSource string `json:"time_source,omitempty"`
+	FileTime   string `json:"file_time,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	Conflict   string `json:"conflict,omitempty"`   // how a taken destination was resolved
+	VersionOf  string `json:"version_of,omitempty"` // the taken destination a renamed file is a version of
+	// OriginalName is the source file name when -name-template or
+	// -sanitize-names renamed it.
+	OriginalName string `json:"original_name,omitempty"`
+	// SanitizedFrom is the destination before Windows-safe renaming or
+	// -max-name-len shortening.
+	SanitizedFrom string `json:"sanitized_from,omitempty"`
+	// DeleteSource marks a -deferred-delete copy whose source is removed
+	// (as a later "delete-source" record) once the run has succeeded.
+	DeleteSource bool `json:"delete_source,omitempty"`
+	// LinkOf is the destination this one was hardlinked to (-hardlinks link).
+	LinkOf string `json:"link_of,omitempty"`
+	// Symlink is where a symlink placed as a link points at dest.
+	Symlink string `json:"symlink,omitempty"`
+	// Verified is "sha256:<digest>" (or the -shard hash) for a copy that
+	// -verify read back; renames within a filesystem aren't verified.
+	Verified string `json:"verified,omitempty"`
+	// Mtime and Atime are the source's times as found, whether or not
+	// they were carried over to the destination.
+	Mtime string `json:"mtime,omitempty"`
+	Atime string `json:"atime,omitempty"`
+}
+
+// manifest writes JSON Lines so a partial run still leaves a usable record.
+type manifest struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openManifest(path string) (*manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (m *manifest) record(e manifestEntry) error {
+	if m == nil {
+		return nil
+	}
+	return m.enc.Encode(e)
+}
+
+func (m *manifest) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.f.Close()
+}
+
+func formatFileTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// sourceTimes formats the times of a source file for the manifest.
+func sourceTimes(info os.FileInfo) (string, string) {
+	if info == nil {
+		return "", ""
+	}
+	mtime, atime := info.ModTime().Format(time.RFC3339Nano), ""
+	if t, ok := accessTime(info); ok {
+		atime = t.Format(time.RFC3339Nano)
+	}
+	return mtime, atime
+}
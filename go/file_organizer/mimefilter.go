@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// mimeFilter is -include-mime: content types or type/* patterns.
+type mimeFilter []string
+
+func parseMIMEFilter(list string) (mimeFilter, error) {
+	var f mimeFilter
+	for _, p := range strings.Split(list, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			return nil, fmt.Errorf("invalid -include-mime %q (use type/subtype or type/*)", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid -include-mime %q: %v", p, err)
+		}
+		f = append(f, p)
+	}
+	return f, nil
+}
+
+func (f mimeFilter) matches(mime string) bool {
+	for _, p := range f {
+		if ok, _ := path.Match(p, mime); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffFile reads the content type of path once; later calls, e.g. from the
+// categorizer after -include-mime, get the cached result.
+func (c *categorizer) sniffFile(path string) (string, error) {
+	if mime, ok := c.sniffed[path]; ok {
+		return mime, nil
+	}
+	mime, err := sniffFile(path)
+	if err != nil {
+		return "", err
+	}
+	if c.sniffed == nil {
+		c.sniffed = make(map[string]string)
+	}
+	c.sniffed[path] = mime
+	return mime, nil
+}
+
+// selectMIME applies -include-mime, reading at most sniffLen bytes of each
+// remaining file. Files that cannot be read are left out with a warning,
+// and so are online-only placeholders, which reading would download.
+func (o Options) selectMIME(files []fileEntry) ([]fileEntry, int) {
+	if len(o.IncludeMIME) == 0 {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if fe.Marker != "" {
+			kept = append(kept, fe)
+			continue
+		}
+		if fe.Placeholder == "cloud" || fe.Info == nil || !fe.Info.Mode().IsRegular() {
+			continue
+		}
+		mime, err := o.Categorizer.sniffFile(fe.Path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot sniff", fe.Path, "for -include-mime:", err)
+			continue
+		}
+		if o.IncludeMIME.matches(mime) {
+			kept = append(kept, fe)
+		} else if o.Verbose {
+			fmt.Printf("MIME FILTERED: %s [%s]\n", fe.Path, mime)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// classifyMIME is the -by mime mode: folders come from the content type
+// (extension mapping first, then sniffing) instead of the category tables.
+func (c *categorizer) classifyMIME(path, rel, name, ext string) match {
+	for _, r := range c.patterns {
+		if cat, ok := r.category(name, rel); ok {
+			c.tracef("%s rule %s: matched -> %s", r.kind(), r.Name, cat)
+			return match{Category: cat, Via: "rule: " + r.Name}
+		}
+		c.tracef("%s rule %s: no match", r.kind(), r.Name)
+	}
+
+	typ, via := "", "by extension"
+	if ext != "" {
+		typ = stripMIMEParams(mime.TypeByExtension(ext))
+		c.tracef("MIME type by extension %s: %q", ext, typ)
+	}
+	if typ == "" {
+		if path == "" {
+			return match{Category: "unknown", UnknownExt: ext}
+		}
+		sniffed, err := c.sniffFile(path)
+		if err != nil {
+			c.tracef("sniff: %v", err)
+			return match{Category: "unknown", SniffErr: err, UnknownExt: ext}
+		}
+		c.tracef("sniff: %s", sniffed)
+		typ, via = sniffed, "sniffed"
+	}
+
+	top, sub, _ := strings.Cut(typ, "/")
+	top = sanitizeComponent(strings.ToLower(top))
+	if top == "" {
+		return match{Category: "unknown", UnknownExt: ext}
+	}
+	m := match{Category: top, Via: via + " as " + typ, Kind: categoryByMIME(typ)}
+	if sub = sanitizeComponent(strings.ToLower(sub)); c.mimeSubtypes && sub != "" {
+		m.Category = filepath.Join(top, sub)
+	}
+	return m
+}
+
+func stripMIMEParams(t string) string {
+	t, _, _ = strings.Cut(t, ";")
+	return strings.TrimSpace(t)
+}
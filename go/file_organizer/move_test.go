@@ -0,0 +1,89 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// readOnlySource puts src in a folder it can't be removed from; root
+// ignores the folder's mode, so the removal is refused for it as well.
+func readOnlySource(t *testing.T) (src, dest string) {
+	t.Helper()
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "ro")
+	if err := os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src = filepath.Join(srcDir, "photo.jpg")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(srcDir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(srcDir, 0755) })
+	if os.Geteuid() == 0 {
+		removeSource = func(string) error {
+			return &os.PathError{Op: "remove", Path: src, Err: syscall.EACCES}
+		}
+		t.Cleanup(func() { removeSource = os.Remove })
+	}
+	return src, filepath.Join(dir, "photo.jpg")
+}
+
+func TestFinishMoveRollsBack(t *testing.T) {
+	src, dest := readOnlySource(t)
+	forceCopyFallback(t)
+	_, err := relocate(context.Background(), src, dest)
+	if !errors.Is(err, errRolledBack) {
+		t.Fatalf("relocate = %v, want errRolledBack", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("source gone after a rollback: %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("copy left after a rollback: %v", err)
+	}
+}
+
+func TestFinishMoveKeepsBoth(t *testing.T) {
+	keepBothCopies = true
+	t.Cleanup(func() { keepBothCopies = false })
+	src, dest := readOnlySource(t)
+	forceCopyFallback(t)
+	_, err := relocate(context.Background(), src, dest)
+	if !errors.Is(err, errBothKept) {
+		t.Fatalf("relocate = %v, want errBothKept", err)
+	}
+	for _, path := range []string{src, dest} {
+		if b, err := os.ReadFile(path); err != nil || string(b) != "data" {
+			t.Errorf("%s = %q, %v; want both copies kept", path, b, err)
+		}
+	}
+}
+
+func TestFinishMoveRemovesSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	for _, path := range []string{src, dest} {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := finishMove(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still there: %v", err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("copy removed: %v", err)
+	}
+}
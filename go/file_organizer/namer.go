@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// nameTimeFormat renders {taken} and {mtime}: 2023-07-14_183205.
+const nameTimeFormat = "2006-01-02_150405"
+
+var nameTokens = map[string]bool{
+	"name": true, "taken": true, "camera": true, "mtime": true, "hash8": true,
+	"artist": true, "title": true, "album": true, "year": true,
+}
+
+var nameTokenRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// nameTemplates holds the -name-template values: one for every category,
+// or CATEGORY=TEMPLATE overrides.
+type nameTemplates struct {
+	all   string
+	byCat map[string]string
+}
+
+func parseNameTemplates(values []string) (*nameTemplates, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	t := &nameTemplates{byCat: make(map[string]string)}
+	for _, v := range values {
+		tmpl, cat := v, ""
+		if i := strings.Index(v, "="); i > 0 && !strings.ContainsAny(v[:i], "{}") {
+			c, err := cleanCategory(v[:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid -name-template %q: %v", v, err)
+			}
+			cat, tmpl = c, v[i+1:]
+		}
+		if strings.ContainsAny(tmpl, `/\`) {
+			return nil, fmt.Errorf("invalid -name-template %q: must be a file name, not a path", v)
+		}
+		if !strings.Contains(tmpl, "{") {
+			return nil, fmt.Errorf("invalid -name-template %q: needs at least one token", v)
+		}
+		for _, sub := range nameTokenRe.FindAllStringSubmatch(tmpl, -1) {
+			if !nameTokens[sub[1]] {
+				return nil, fmt.Errorf("invalid -name-template %q: unknown token {%s} (use name, taken, camera, mtime, hash8, artist, title, album, year)", v, sub[1])
+			}
+		}
+		if strings.ContainsAny(nameTokenRe.ReplaceAllString(tmpl, ""), "{}") {
+			return nil, fmt.Errorf("invalid -name-template %q: unmatched brace", v)
+		}
+		if cat == "" {
+			t.all = tmpl
+		} else {
+			t.byCat[cat] = tmpl
+		}
+	}
+	return t, nil
+}
+
+func (t *nameTemplates) forCategory(cat string) string {
+	if t == nil {
+		return ""
+	}
+	if tmpl, ok := t.byCat[cat]; ok {
+		return tmpl
+	}
+	if tmpl, ok := t.byCat[topCategory(cat)]; ok {
+		return tmpl
+	}
+	return t.all
+}
+
+// metadataName renders the template for the file's category and keeps
+// the original extension. It returns "" and the reason when a token has no
+// value, so the file keeps its name.
+func (o Options) metadataName(path, name string, m match, info os.FileInfo) (string, string) {
+	tmpl := o.NameTemplates.forCategory(m.Category)
+	if tmpl == "" {
+		return "", ""
+	}
+	stem, ext := o.Categorizer.splitExt(name)
+
+	var ex *exifInfo
+	var tags *audioTags
+	var missing string
+	out := nameTokenRe.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		var v string
+		switch tok[1 : len(tok)-1] {
+		case "name":
+			v = stem
+		case "mtime":
+			if info != nil {
+				v = info.ModTime().Format(nameTimeFormat)
+			}
+		case "hash8":
+			v, _ = contentHash(path)
+		case "taken", "camera":
+			if ex == nil {
+				e, _ := readEXIF(path)
+				ex = &e
+			}
+			if tok == "{taken}" && !ex.DateTaken.IsZero() {
+				v = ex.DateTaken.Format(nameTimeFormat)
+			} else if tok == "{camera}" {
+				v = cameraDir(ex.Make, ex.Model)
+			}
+		default:
+			if tags == nil {
+				t, _ := readAudioTags(path)
+				tags = &t
+			}
+			switch tok {
+			case "{artist}":
+				if v = tags.Artist; v == "" {
+					v = tags.AlbumArtist
+				}
+			case "{title}":
+				v = tags.Title
+			case "{album}":
+				v = tags.Album
+			case "{year}":
+				if len(tags.Year) >= 4 {
+					v = tags.Year[:4]
+				}
+			}
+		}
+		if v = strings.TrimSpace(v); v == "" && missing == "" {
+			missing = tok
+		}
+		return v
+	})
+	if missing != "" {
+		return "", "no " + missing + ", kept the name"
+	}
+	out = sanitizeComponent(out)
+	if out == "" {
+		return "", "empty name, kept the name"
+	}
+	if out+ext == name {
+		return "", ""
+	}
+	return out + ext, "named from " + tmpl
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mimeTopLevels are the folders -by mime creates.
+var mimeTopLevels = []string{"application", "audio", "font", "image", "message", "model", "multipart", "text", "video", "unknown"}
+
+// excludeNested keeps a recursive scan out of the destination: a -dest
+// inside -src is excluded as a whole, and with -dest equal to -src the
+// folders this tool creates are. -rescan-organized scans them anyway.
+// Symlinks are resolved, so a -dest linking back into -src counts too.
+func (o *Options) excludeNested() {
+	if !o.Recursive || o.RescanOrganized {
+		return
+	}
+	dest := realPath(o.Dest)
+	for _, src := range o.Sources {
+		real := realPath(src)
+		if !isWithin(dest, real) {
+			continue
+		}
+		// the folder as the scan of src reaches it
+		rel, _ := filepath.Rel(real, dest)
+		if rel != "." {
+			o.Excluded[filepath.Join(src, rel)] = false
+			continue
+		}
+		for _, cat := range o.knownCategories() {
+			o.Excluded[filepath.Join(src, cat)] = false
+		}
+	}
+}
+
+// realPath resolves the symlinks in path, which is kept as is if that
+// fails (a -dest that doesn't exist yet).
+func realPath(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		return p
+	}
+	return path
+}
+
+// countFiles counts the files below dir without stat'ing them, for the
+// summary of excluded destination folders.
+func countFiles(dir string) int {
+	n := 0
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// knownCategories lists the top-level folders a run can create under -dest.
+func (o Options) knownCategories() []string {
+	seen := map[string]bool{
+		o.UnknownCategory: true, "no_extension": true, "dotfiles": true, "screenshots": true,
+		"downloads": true, "projects": true, miscCategory: true, stateDir: true,
+	}
+	if o.Placeholders == "category" {
+		seen[placeholderCategory] = true
+	}
+	if o.DuplicatesTo != "" {
+		seen[topCategory(o.DuplicatesTo)] = true
+	}
+	c := o.Categorizer
+	for _, cat := range c.ext {
+		seen[topCategory(cat)] = true
+	}
+	for _, cat := range c.names {
+		seen[topCategory(cat)] = true
+	}
+	for _, r := range c.patterns {
+		if top := topCategory(filepath.FromSlash(r.Category)); !strings.Contains(top, "$") {
+			seen[top] = true
+		}
+	}
+	if c.byMIME {
+		for _, t := range mimeTopLevels {
+			seen[t] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for cat := range seen {
+		out = append(out, cat)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// linkedDest makes src with an organized images folder and a loose file,
+// and a symlink to src to use as -dest.
+func linkedDest(t *testing.T) (src, link string) {
+	t.Helper()
+	dir := t.TempDir()
+	src = filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join("images", "photo.jpg"), "new.jpg"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link = filepath.Join(dir, "link")
+	if err := os.Symlink(src, link); err != nil {
+		t.Skip("symlinks not available:", err)
+	}
+	return src, link
+}
+
+func TestSameFileThroughSymlinkedDest(t *testing.T) {
+	src, link := linkedDest(t)
+	for _, name := range []string{filepath.Join("images", "photo.jpg"), filepath.Join("images", "missing.jpg")} {
+		if !sameFile(filepath.Join(src, name), filepath.Join(link, name)) {
+			t.Errorf("%s is not the same file through the -dest link", name)
+		}
+	}
+	if sameFile(filepath.Join(src, "new.jpg"), filepath.Join(link, "images", "new.jpg")) {
+		t.Error("different paths reported as the same file")
+	}
+}
+
+func TestExcludeNestedResolvesDest(t *testing.T) {
+	src, link := linkedDest(t)
+	sub := filepath.Join(filepath.Dir(src), "sub")
+	if err := os.Symlink(filepath.Join(src, "images"), sub); err != nil {
+		t.Fatal(err)
+	}
+	for dest, want := range map[string]string{link: "images", sub: "images"} {
+		o := Options{Recursive: true, Sources: []string{src}, Dest: dest, Excluded: make(map[string]bool), Categorizer: newCategorizer(), UnknownCategory: "other"}
+		o.excludeNested()
+		if _, ok := o.Excluded[filepath.Join(src, want)]; !ok {
+			t.Errorf("-dest %s: %s not excluded from the scan, have %v", dest, want, o.Excluded)
+		}
+	}
+}
+
+func TestSymlinkedDestInsideSrc(t *testing.T) {
+	src, link := linkedDest(t)
+	out, err := organize(t, "-src", src, "-dest", link, "-recursive")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for _, want := range []string{"Processed: 1\n", "Succeeded: 1\n", "Failed: 0\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	for _, name := range []string{"photo.jpg", "new.jpg"} {
+		if _, err := os.Stat(filepath.Join(src, "images", name)); err != nil {
+			t.Errorf("images/%s: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(src, "new.jpg")); !os.IsNotExist(err) {
+		t.Errorf("new.jpg still in -src: %v", err)
+	}
+}
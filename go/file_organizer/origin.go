@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxOriginData bounds how much xattr or stream data is read; the real
+// records are a few hundred bytes.
+const maxOriginData = 64 << 10
+
+// downloadOrigin returns the folder-safe domain a file was downloaded from,
+// or "" when the platform recorded nothing usable.
+func downloadOrigin(path string) string {
+	for _, raw := range originURLs(path) {
+		if host := originHost(raw); host != "" {
+			return host
+		}
+	}
+	return ""
+}
+
+func originHost(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ftp") {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if net.ParseIP(host) == nil {
+		host = strings.TrimPrefix(host, "www.")
+		for _, r := range host {
+			if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.') {
+				return ""
+			}
+		}
+	}
+	return sanitizeComponent(strings.ReplaceAll(host, ":", "_"))
+}
+
+// parseWhereFroms decodes the binary plist macOS stores in
+// com.apple.metadata:kMDItemWhereFroms: an array of URL strings (the
+// download URL first, then the referring page).
+func parseWhereFroms(b []byte) []string {
+	if len(b) < 40 || !bytes.HasPrefix(b, []byte("bplist00")) {
+		return nil
+	}
+	trailer := b[len(b)-32:]
+	offSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	tableAt := binary.BigEndian.Uint64(trailer[24:])
+	if offSize < 1 || offSize > 8 || refSize < 1 || refSize > 8 ||
+		numObjects > uint64(len(b)) || top >= numObjects ||
+		tableAt > uint64(len(b)) || uint64(len(b))-tableAt < numObjects*uint64(offSize) {
+		return nil
+	}
+
+	offset := func(i uint64) (int, bool) {
+		at := tableAt + i*uint64(offSize)
+		o := beUint(b[at : at+uint64(offSize)])
+		return int(o), o < tableAt
+	}
+	topAt, ok := offset(top)
+	if !ok {
+		return nil
+	}
+
+	obj := b[topAt:tableAt]
+	if obj[0]>>4 == 0x5 || obj[0]>>4 == 0x6 {
+		if s, ok := plistString(obj); ok {
+			return []string{s}
+		}
+		return nil
+	}
+	if obj[0]>>4 != 0xa {
+		return nil
+	}
+	count, body, ok := plistCount(obj)
+	if !ok || uint64(len(body)) < count*uint64(refSize) {
+		return nil
+	}
+	var out []string
+	for i := uint64(0); i < count; i++ {
+		ref := beUint(body[i*uint64(refSize) : (i+1)*uint64(refSize)])
+		if ref >= numObjects {
+			continue
+		}
+		at, ok := offset(ref)
+		if !ok {
+			continue
+		}
+		if s, ok := plistString(b[at:tableAt]); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// plistCount reads an object's length nibble, which 0xf extends with a
+// following integer object.
+func plistCount(obj []byte) (uint64, []byte, bool) {
+	n := uint64(obj[0] & 0x0f)
+	if n != 0x0f {
+		return n, obj[1:], true
+	}
+	if len(obj) < 2 || obj[1]>>4 != 0x1 {
+		return 0, nil, false
+	}
+	size := 1 << (obj[1] & 0x0f)
+	if size > 8 || len(obj) < 2+size {
+		return 0, nil, false
+	}
+	return beUint(obj[2 : 2+size]), obj[2+size:], true
+}
+
+func plistString(obj []byte) (string, bool) {
+	if len(obj) == 0 {
+		return "", false
+	}
+	kind := obj[0] >> 4
+	n, body, ok := plistCount(obj)
+	if !ok {
+		return "", false
+	}
+	switch kind {
+	case 0x5:
+		if uint64(len(body)) < n {
+			return "", false
+		}
+		return string(body[:n]), true
+	case 0x6:
+		if uint64(len(body))/2 < n {
+			return "", false
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(body[2*i:])
+		}
+		return string(utf16.Decode(u)), true
+	}
+	return "", false
+}
+
+func beUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// parseZoneIdentifier reads HostUrl (then ReferrerUrl) from the INI-style
+// Zone.Identifier stream Windows attaches to downloads.
+func parseZoneIdentifier(b []byte) []string {
+	if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+		u := make([]uint16, (len(b)-2)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(b[2+2*i:])
+		}
+		b = []byte(string(utf16.Decode(u)))
+	}
+	var host, referrer string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		key, val, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "hosturl":
+			host = val
+		case "referrerurl":
+			referrer = val
+		}
+	}
+	var out []string
+	for _, u := range []string{host, referrer} {
+		if u != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
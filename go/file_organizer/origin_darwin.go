@@ -0,0 +1,29 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const xattrNoFollow = 0x0001
+
+// originURLs reads kMDItemWhereFroms; the syscall package has no getxattr
+// wrapper on darwin.
+func originURLs(path string) []string {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil
+	}
+	name, err := syscall.BytePtrFromString("com.apple.metadata:kMDItemWhereFroms")
+	if err != nil {
+		return nil
+	}
+	buf := make([]byte, maxOriginData)
+	n, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR,
+		uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(name)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, xattrNoFollow)
+	if errno != 0 || int(n) > len(buf) {
+		return nil
+	}
+	return parseWhereFroms(buf[:n])
+}
@@ -0,0 +1,16 @@
+package main
+
+import "syscall"
+
+// originURLs reads the xdg attributes Chrome and Firefox set on downloads.
+func originURLs(path string) []string {
+	var out []string
+	buf := make([]byte, maxOriginData)
+	for _, attr := range []string{"user.xdg.origin.url", "user.xdg.referrer.url"} {
+		n, err := syscall.Getxattr(path, attr, buf)
+		if err == nil && n > 0 {
+			out = append(out, string(buf[:n]))
+		}
+	}
+	return out
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+func originURLs(path string) []string {
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+func originURLs(path string) []string {
+	f, err := os.Open(path + ":Zone.Identifier")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxOriginData))
+	if err != nil {
+		return nil
+	}
+	return parseZoneIdentifier(b)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const defaultOverflowName = "{dir}_{n}"
+
+// dirLimiter spreads files over dir, dir_002, dir_003, ... so that no
+// destination folder gets more than max entries, counting what earlier
+// runs left there.
+type dirLimiter struct {
+	max     int
+	pattern string
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newDirLimiter(max int, pattern string) (*dirLimiter, error) {
+	if max < 1 {
+		return nil, fmt.Errorf("invalid -max-per-dir %d: must be at least 1", max)
+	}
+	if !strings.Contains(pattern, "{n}") {
+		return nil, fmt.Errorf("invalid -overflow-name %q: must contain {n}", pattern)
+	}
+	if strings.ContainsAny(strings.ReplaceAll(pattern, "{dir}", ""), `/\`) {
+		return nil, fmt.Errorf("invalid -overflow-name %q: must be a single folder name", pattern)
+	}
+	return &dirLimiter{max: max, pattern: pattern, counts: make(map[string]int)}, nil
+}
+
+// overflowName builds the n-th folder name for dir (n >= 2).
+func (l *dirLimiter) overflowName(dir string, n int) string {
+	name := strings.ReplaceAll(l.pattern, "{dir}", filepath.Base(dir))
+	name = strings.ReplaceAll(name, "{n}", fmt.Sprintf("%03d", n))
+	return filepath.Join(filepath.Dir(dir), sanitizeComponent(name))
+}
+
+// assign reserves a slot for one file and returns the folder to use. The
+// same sequence of calls yields the same folders in dry-run and real runs,
+// since nothing created during the run is re-read.
+func (l *dirLimiter) assign(dir string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for n := 1; ; n++ {
+		d := dir
+		if n > 1 {
+			d = l.overflowName(dir, n)
+		}
+		count, ok := l.counts[d]
+		if !ok {
+			count = existingEntries(d)
+		}
+		if count < l.max {
+			l.counts[d] = count + 1
+			return d
+		}
+		l.counts[d] = count
+	}
+}
+
+// holds reports whether src already is dest or its copy in one of the
+// existing overflow folders of dest's folder.
+func (l *dirLimiter) holds(dest, src string) bool {
+	dir, name := filepath.Dir(dest), filepath.Base(dest)
+	for n := 2; ; n++ {
+		d := l.overflowName(dir, n)
+		if _, err := os.Stat(d); err != nil {
+			return false
+		}
+		if sameFile(src, filepath.Join(d, name)) {
+			return true
+		}
+	}
+}
+
+func existingEntries(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// ownerFilter is -owner/-owner-uid and -group/-group-gid; -1 takes any.
+type ownerFilter struct {
+	UID, GID int
+}
+
+func (f ownerFilter) active() bool {
+	return f.UID >= 0 || f.GID >= 0
+}
+
+func parseOwnerFilter(o Options) (ownerFilter, error) {
+	f := ownerFilter{UID: -1, GID: -1}
+	if o.OwnerName == "" && o.OwnerUID < 0 && o.GroupName == "" && o.GroupGID < 0 {
+		return f, nil
+	}
+	if !ownersSupported {
+		return f, errors.New("-owner, -owner-uid, -group and -group-gid need Unix file ownership; they are not supported on this system")
+	}
+	if o.OwnerName != "" && o.OwnerUID >= 0 {
+		return f, errors.New("use either -owner or -owner-uid")
+	}
+	if o.GroupName != "" && o.GroupGID >= 0 {
+		return f, errors.New("use either -group or -group-gid")
+	}
+	f.UID, f.GID = o.OwnerUID, o.GroupGID
+	if o.OwnerName != "" {
+		u, err := user.Lookup(o.OwnerName)
+		if err != nil {
+			return f, fmt.Errorf("-owner: %v", err)
+		}
+		if f.UID, err = strconv.Atoi(u.Uid); err != nil {
+			return f, fmt.Errorf("-owner: %s has no numeric UID", o.OwnerName)
+		}
+	}
+	if o.GroupName != "" {
+		g, err := user.LookupGroup(o.GroupName)
+		if err != nil {
+			return f, fmt.Errorf("-group: %v", err)
+		}
+		if f.GID, err = strconv.Atoi(g.Gid); err != nil {
+			return f, fmt.Errorf("-group: %s has no numeric GID", o.GroupName)
+		}
+	}
+	return f, nil
+}
+
+// ownerSelects reports whether a file passes the owner filter; files whose
+// owner can't be told are left out.
+func (o Options) ownerSelects(fe fileEntry) bool {
+	if !o.Owners.active() {
+		return true
+	}
+	if fe.Info == nil {
+		return false
+	}
+	id, ok := fileOwnerIDs(fe.Info)
+	return ok && (o.Owners.UID < 0 || id.UID == o.Owners.UID) && (o.Owners.GID < 0 || id.GID == o.Owners.GID)
+}
+
+// selectOwners applies the owner filter, to project folders too.
+func (o Options) selectOwners(files []fileEntry) ([]fileEntry, int) {
+	if !o.Owners.active() {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if o.ownerSelects(fe) {
+			kept = append(kept, fe)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
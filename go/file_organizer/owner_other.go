@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// ownersSupported is false: -owner and -group are refused.
+const ownersSupported = false
+
+// fileOwner isn't supported here (Windows owners need the security API);
+// files are placed without an owner folder.
+func fileOwner(info os.FileInfo) string {
+	return ""
+}
+
+type fileOwnerID struct {
+	UID, GID int
+}
+
+func fileOwnerIDs(info os.FileInfo) (fileOwnerID, bool) {
+	return fileOwnerID{}, false
+}
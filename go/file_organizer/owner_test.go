@@ -0,0 +1,127 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type chownCall struct {
+	path     string
+	uid, gid int
+}
+
+// fakeOwner swaps the chown and geteuid hooks; calls records the chowns.
+func fakeOwner(t *testing.T, euid int, fail error) *[]chownCall {
+	t.Helper()
+	var calls []chownCall
+	chown = func(path string, uid, gid int) error {
+		calls = append(calls, chownCall{path, uid, gid})
+		return fail
+	}
+	geteuid = func() int { return euid }
+	ownerWarned = false
+	t.Cleanup(func() {
+		chown, geteuid, ownerWarned = os.Lchown, os.Geteuid, false
+	})
+	return &calls
+}
+
+func ownedFile(t *testing.T) (string, fileOwnerID) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := fileOwnerIDs(info)
+	if !ok {
+		t.Skip("no owner ids on this platform")
+	}
+	return path, id
+}
+
+func TestCopyKeepsOwner(t *testing.T) {
+	calls := fakeOwner(t, 0, nil)
+	src, id := ownedFile(t)
+	dest := filepath.Join(filepath.Dir(src), "dest")
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := writeAtomic(dest, in, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 1 {
+		t.Fatalf("chown called %d times, want once", len(*calls))
+	}
+	c := (*calls)[0]
+	if c.uid != id.UID || c.gid != id.GID || !isLeftoverTemp(filepath.Base(c.path)) {
+		t.Errorf("chown(%s, %d, %d), want the temporary copy and %d:%d", c.path, c.uid, c.gid, id.UID, id.GID)
+	}
+}
+
+func TestPlaceLinkKeepsOwner(t *testing.T) {
+	calls := fakeOwner(t, 0, nil)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "link")
+	if err := os.Symlink("target", src); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := fileOwnerIDs(info)
+	dest := filepath.Join(dir, "placed")
+	if _, err := placeLink(src, dest, "target", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 1 || (*calls)[0] != (chownCall{dest, id.UID, id.GID}) {
+		t.Errorf("chown calls %v, want the placed link and %d:%d", *calls, id.UID, id.GID)
+	}
+}
+
+func TestOwnerFailureWarnsOnce(t *testing.T) {
+	calls := fakeOwner(t, 0, errors.New("operation not permitted"))
+	src, _ := ownedFile(t)
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := capture(t, &os.Stderr, func() {
+		applyOwner(src, info)
+		applyOwner(src, info)
+	})
+	if len(*calls) != 2 {
+		t.Errorf("chown called %d times, want 2", len(*calls))
+	}
+	if n := strings.Count(out, "WARN: cannot keep file owners"); n != 1 {
+		t.Errorf("warned %d times, want once:\n%s", n, out)
+	}
+}
+
+func TestOwnerSkippedWhenNotRoot(t *testing.T) {
+	calls := fakeOwner(t, 1000, nil)
+	src, _ := ownedFile(t)
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyOwner(src, info)
+	if len(*calls) != 0 {
+		t.Errorf("chown called as a regular user: %v", *calls)
+	}
+}
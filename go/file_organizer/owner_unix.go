@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+const ownersSupported = true
+
+var ownerNames = make(map[uint32]string)
+
+// fileOwner returns the user name owning a file, or its numeric UID when
+// the account can't be looked up.
+func fileOwner(info os.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	if name, ok := ownerNames[st.Uid]; ok {
+		return name
+	}
+	id := strconv.FormatUint(uint64(st.Uid), 10)
+	name := id
+	if u, err := user.LookupId(id); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	name = sanitizeComponent(name)
+	ownerNames[st.Uid] = name
+	return name
+}
+
+type fileOwnerID struct {
+	UID, GID int
+}
+
+func fileOwnerIDs(info os.FileInfo) (fileOwnerID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileOwnerID{}, false
+	}
+	return fileOwnerID{UID: int(st.Uid), GID: int(st.Gid)}, true
+}
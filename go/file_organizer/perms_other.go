@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// applyPerms gives a copy the permission bits of the source, setuid,
+// setgid and sticky included. Where those are refused (setgid outside
+// the group, sticky files on BSD) the plain bits are still applied.
+func applyPerms(f *os.File, src os.FileInfo) error {
+	mode := src.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	err := f.Chmod(mode)
+	if err != nil && mode != mode.Perm() {
+		err = f.Chmod(mode.Perm())
+	}
+	return err
+}
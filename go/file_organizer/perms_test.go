@@ -0,0 +1,99 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// forceCopyFallback makes renames fail as across filesystems for the test.
+func forceCopyFallback(t *testing.T) {
+	t.Helper()
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { rename = os.Rename })
+}
+
+func TestMoveFallbackKeepsPerms(t *testing.T) {
+	forceCopyFallback(t)
+	for _, mode := range []os.FileMode{0755, 0600, 0640} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		dest := filepath.Join(dir, "dest")
+		if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(src, mode); err != nil {
+			t.Fatal(err)
+		}
+		copied, err := relocate(context.Background(), src, dest)
+		if err != nil || !copied {
+			t.Fatalf("relocate = %v, %v; want a copy", copied, err)
+		}
+		info, err := os.Stat(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != mode {
+			t.Errorf("mode %v moved as %v", mode, got)
+		}
+		if _, err := os.Lstat(src); !os.IsNotExist(err) {
+			t.Errorf("source left after the move: %v", err)
+		}
+	}
+}
+
+func TestMoveVerifiedFallbackKeepsPerms(t *testing.T) {
+	forceCopyFallback(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moveVerified(context.Background(), src, dest); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0750 {
+		t.Errorf("moved as %v, want 0750", got)
+	}
+}
+
+func TestStageCopyFollowsUmask(t *testing.T) {
+	umask := syscall.Umask(0022)
+	t.Cleanup(func() { syscall.Umask(umask) })
+	preservePerms = false
+	t.Cleanup(func() { preservePerms = true })
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	staged, _, err := stageCopy(context.Background(), src, dir, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0644 {
+		t.Errorf("staged copy is %v, want 0644 from the umask", got)
+	}
+	if !isLeftoverTemp(filepath.Base(staged)) {
+		t.Errorf("%s is not recognised as a temporary file", staged)
+	}
+}
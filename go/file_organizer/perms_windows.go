@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+// applyPerms does nothing: Windows has no permission bits to carry over,
+// only the read-only attribute, which would block later replacements.
+func applyPerms(f *os.File, src os.FileInfo) error {
+	return nil
+}
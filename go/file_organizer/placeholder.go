@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// placeholderCategory takes empty files and online-only cloud files under
+// -placeholders category.
+const placeholderCategory = "placeholders"
+
+var placeholderModes = map[string]bool{"skip": true, "category": true, "move": true}
+
+// placeholderKind tells "cloud" for online-only files of OneDrive, iCloud
+// and the like, "empty" for zero-byte files and "" for anything else. Only
+// the attributes from the scan are looked at; reading an online-only file
+// would download it.
+func placeholderKind(info os.FileInfo) string {
+	if info == nil || info.IsDir() {
+		return ""
+	}
+	if cloudPlaceholder(info) {
+		return "cloud"
+	}
+	if info.Mode().IsRegular() && info.Size() == 0 {
+		return "empty"
+	}
+	return ""
+}
+
+// selectPlaceholders marks empty and online-only files. Under -placeholders
+// skip they are dropped, and so are online-only files in copy mode, since
+// copying would download them; the counts are by kind.
+func (o Options) selectPlaceholders(files []fileEntry) ([]fileEntry, map[string]int) {
+	left := make(map[string]int)
+	if o.Placeholders == "move" {
+		return files, left
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if fe.Marker == "" {
+			fe.Placeholder = placeholderKind(fe.Info)
+		}
+		if fe.Placeholder != "" && (o.Placeholders == "skip" || (fe.Placeholder == "cloud" && o.Mode == "copy")) {
+			left[fe.Placeholder]++
+			if o.Verbose || o.DryRun {
+				fmt.Printf("PLACEHOLDER: %s (%s), left in place\n", fe.Path, fe.Placeholder)
+			}
+			continue
+		}
+		kept = append(kept, fe)
+	}
+	return kept, left
+}
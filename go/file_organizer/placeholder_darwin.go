@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const sfDataless = 0x40000000 // SF_DATALESS, set by File Provider on evicted files
+
+func cloudPlaceholder(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Flags&sfDataless != 0
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os"
+
+func cloudPlaceholder(info os.FileInfo) bool {
+	return false
+}
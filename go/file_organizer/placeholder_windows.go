@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fileAttributeOffline            = 0x1000
+	fileAttributeRecallOnOpen       = 0x40000
+	fileAttributeRecallOnDataAccess = 0x400000
+)
+
+// cloudPlaceholder checks the attributes cloud sync providers set on files
+// whose data is not on the disk.
+func cloudPlaceholder(info os.FileInfo) bool {
+	a, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && a.FileAttributes&(fileAttributeOffline|fileAttributeRecallOnOpen|fileAttributeRecallOnDataAccess) != 0
+}
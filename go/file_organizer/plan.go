@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const miscCategory = "misc"
+
+// planCategories categorizes every file before anything is placed, so
+// per-category counts are known up front. Project entries and files whose
+// relative path can't be built get a zero match.
+func (o Options) planCategories(files []fileEntry) ([]match, map[string]int) {
+	plan := make([]match, len(files))
+	hinted := make([]bool, len(files)) // a sidecar chose the category; never folded
+	counts := make(map[string]int)
+	for i, f := range files {
+		if f.Marker != "" {
+			continue
+		}
+		rel, err := filepath.Rel(f.Root, f.Path)
+		if err != nil {
+			continue
+		}
+		if f.Sidecar != "" {
+			plan[i], hinted[i] = sidecarMatch(f.Sidecar)
+		}
+		switch {
+		case hinted[i]:
+			// the sidecar decided
+		case f.Placeholder != "":
+			plan[i] = match{Category: placeholderCategory, Via: f.Placeholder + " placeholder"}
+		case f.Link != "", f.Special != "":
+			// by name only; links and FIFOs are not read through
+			plan[i] = o.Categorizer.categorize("", rel)
+		default:
+			plan[i] = o.Categorizer.categorize(f.Path, rel)
+		}
+		counts[topCategory(plan[i].Category)]++
+	}
+
+	folded := make(map[string]int)
+	if o.MinCategory <= 1 {
+		return plan, folded
+	}
+	keep := make(map[string]bool)
+	for cat, n := range counts {
+		if n >= o.MinCategory || cat == miscCategory {
+			keep[cat] = true
+			continue
+		}
+		// an existing, non-empty category folder always takes new files
+		_, dir := o.categoryDir(cat)
+		keep[cat] = existingEntries(dir) > 0
+	}
+	for i := range plan {
+		cat := topCategory(plan[i].Category)
+		if plan[i].Category == "" || keep[cat] || hinted[i] {
+			continue
+		}
+		folded[cat]++
+		plan[i].Via = joinNotes(plan[i].Via, fmt.Sprintf("%s has only %d file(s), folded into %s", cat, counts[cat], miscCategory))
+		plan[i].Category = miscCategory
+	}
+	return plan, folded
+}
+
+func topCategory(cat string) string {
+	top, _, _ := strings.Cut(cat, string(filepath.Separator))
+	return top
+}
+
+func joinNotes(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "; " + b
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// preflight checks during -dry-run that the folders a real run would write
+// to can be written: an existing folder itself, otherwise the closest
+// existing parent it would be created in. With -probe-writes a file is
+// created and removed there; otherwise permissions are checked the way
+// access(2) does, where the platform has it. Each folder is reported once.
+type preflight struct {
+	probe   bool
+	checked map[string]error
+	failed  int // folders that can't be written
+	ops     int // operations that would fail because of them
+}
+
+func newPreflight(probe bool) *preflight {
+	return &preflight{probe: probe, checked: make(map[string]error)}
+}
+
+// available reports whether anything is checked at all.
+func (p *preflight) available() bool {
+	return p.probe || accessSupported
+}
+
+// check reports the first of dirs that a real run couldn't write to.
+func (p *preflight) check(dirs ...string) error {
+	if !p.available() {
+		return nil
+	}
+	for _, dir := range dirs {
+		err, seen := p.checked[dir]
+		if !seen {
+			err = p.writable(dir)
+			p.checked[dir] = err
+			if err != nil {
+				p.failed++
+				fmt.Printf("PREFLIGHT FAILED: %s: %v\n", dir, err)
+			} else {
+				fmt.Println("PREFLIGHT OK:", dir)
+			}
+		}
+		if err != nil {
+			p.ops++
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *preflight) writable(dir string) error {
+	at := dir
+	for {
+		info, err := os.Stat(at)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a folder", at)
+			}
+			break
+		}
+		if filepath.Dir(at) == at {
+			return err
+		}
+		at = filepath.Dir(at)
+	}
+	how := "write to"
+	if at != dir {
+		how = "create folders in"
+	}
+	if p.probe {
+		f, err := createTemp(filepath.Join(at, "probe"))
+		if err != nil {
+			return fmt.Errorf("cannot %s %s: %v", how, at, err)
+		}
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			return fmt.Errorf("cannot remove files in %s: %v", at, err)
+		}
+		return nil
+	}
+	if err := canWrite(at); err != nil {
+		return fmt.Errorf("cannot %s %s: %v", how, at, err)
+	}
+	return nil
+}
+
+func (p *preflight) summary() {
+	if !p.available() {
+		fmt.Println("Permission preflight: not available on this platform without -probe-writes")
+		return
+	}
+	fmt.Printf("Permission preflight: %d folder(s) checked, %d not writable; %d operation(s) would fail\n", len(p.checked), p.failed, p.ops)
+}
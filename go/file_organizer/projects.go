@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultProjectMarkers = ".git,go.mod,package.json,Cargo.toml"
+
+// errProjectInPlace means a project already sits where it would be moved.
+var errProjectInPlace = errors.New("project already in place")
+
+func parseProjectMarkers(s string) ([]string, error) {
+	var out []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if strings.ContainsAny(m, `/\`) || m == "." || m == ".." {
+			return nil, fmt.Errorf("invalid -project-markers entry %q: must be a plain file or folder name", m)
+		}
+		out = append(out, m)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("invalid -project-markers: empty list")
+	}
+	return out, nil
+}
+
+// projectMarker returns the first marker present in dir, or "".
+func projectMarker(dir string, markers []string) string {
+	for _, m := range markers {
+		if _, err := os.Lstat(filepath.Join(dir, m)); err == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+// placeProject moves or copies a whole project directory into
+// projects/, keeping its folder name.
+func (o Options) placeProject(f fileEntry, rel string) (string, error) {
+	root, dir := o.categoryDir("projects")
+	if o.KeepStructure {
+		dir = filepath.Join(dir, filepath.Dir(rel))
+	}
+	dest := filepath.Join(dir, filepath.Base(rel))
+	if sameFile(f.Path, dest) {
+		return dest, errProjectInPlace
+	}
+	if isWithin(o.Dest, f.Path) || isWithin(root, f.Path) {
+		return "", fmt.Errorf("project %s contains the destination, leaving it in place", f.Path)
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("project destination %s already exists", dest)
+	}
+
+	if o.Verbose || o.DryRun {
+		fmt.Printf("%s project: %s -> %s [marker: %s]\n", strings.ToUpper(o.Mode), f.Path, dest, f.Marker)
+	}
+	if err := ensureDir(dir, o.DryRun, o.Verbose); err != nil {
+		return "", err
+	}
+	if o.DryRun {
+		return dest, nil
+	}
+	if o.Mode == "move" {
+		return dest, moveDir(f.Path, dest)
+	}
+	return dest, copyDir(f.Path, dest)
+}
+
+// moveDir renames a directory, falling back to copy and delete across
+// devices.
+func moveDir(src, dest string) error {
+	err := os.Rename(src, dest)
+	if err == nil {
+		return nil
+	}
+	if !crossDevice(err) {
+		return err
+	}
+	if err := copyDir(src, dest); err != nil {
+		_ = os.RemoveAll(dest)
+		return err
+	}
+	if err := syncBeforeRemove(dest); err != nil {
+		return fmt.Errorf("%s copied, source kept: cannot sync folder: %v", dest, err)
+	}
+	return os.RemoveAll(src)
+}
+
+// copyDir copies a tree, recreating symlinks rather than following them.
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(context.Background(), path, target)
+		}
+		fmt.Fprintln(os.Stderr, "WARN: skipping special file", path)
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// errQuit stops the run when q is answered at a conflict prompt.
+var errQuit = fmt.Errorf("%w: stopped at the prompt", errConflict)
+
+// conflictPrompter asks on the terminal how to resolve each conflict with an
+// existing file, until an answer for all remaining ones is given.
+type conflictPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	all string // policy chosen for every remaining conflict
+}
+
+func newConflictPrompter() (*conflictPrompter, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, errors.New("-interactive-conflicts needs a terminal on stdin")
+	}
+	return &conflictPrompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}, nil
+}
+
+// ask returns the policy to apply: skip, overwrite or rename.
+func (p *conflictPrompter) ask(dest string, existing os.FileInfo, srcTime time.Time, tolerance time.Duration) (string, error) {
+	if p.all != "" {
+		return p.all, nil
+	}
+	age := "same age"
+	switch {
+	case existing.ModTime().After(srcTime.Add(tolerance)):
+		age = "newer"
+	case srcTime.After(existing.ModTime().Add(tolerance)):
+		age = "older"
+	}
+	for {
+		fmt.Fprintf(p.out, "%s exists (%s, %s). [s]kip / [o]verwrite / [r]ename / [a]ll-skip / [O]verwrite all / [R]ename all / [q]uit? ",
+			dest, formatBytes(existing.Size()), age)
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", errQuit
+		}
+		switch strings.TrimSpace(line) {
+		case "s":
+			return "skip", nil
+		case "o":
+			return "overwrite", nil
+		case "r":
+			return "rename", nil
+		case "a":
+			p.all = "skip"
+		case "O":
+			p.all = "overwrite"
+		case "R":
+			p.all = "rename"
+		case "q":
+			return "", errQuit
+		default:
+			continue
+		}
+		return p.all, nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRenameTemplate = "{name}_{n}{ext}"
+
+var renameTokens = []string{"{name}", "{ext}", "{n}", "{date}", "{hash8}"}
+
+// renamer picks free names for -on-conflict rename. Each destination
+// folder is listed once and then tracked in memory, together with the
+// names handed out during the run.
+type renamer struct {
+	pattern string
+	retry   string // pattern used once the first candidate is taken
+
+	mu    sync.Mutex
+	names map[string]map[string]bool // dir -> destKeys present or planned
+}
+
+func newRenamer(pattern string) (*renamer, error) {
+	rest := pattern
+	for _, tok := range renameTokens {
+		rest = strings.ReplaceAll(rest, tok, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return nil, fmt.Errorf("invalid -rename-template %q: unknown token (use {name}, {ext}, {n}, {date}, {hash8})", pattern)
+	}
+	if strings.ContainsAny(rest, `/\`) {
+		return nil, fmt.Errorf("invalid -rename-template %q: must be a file name, not a path", pattern)
+	}
+	if !strings.Contains(pattern, "{name}") && !strings.Contains(pattern, "{hash8}") {
+		return nil, fmt.Errorf("invalid -rename-template %q: needs {name} or {hash8}", pattern)
+	}
+	r := &renamer{pattern: pattern, retry: pattern, names: make(map[string]map[string]bool)}
+	// without {n} a counter is added before the extension when needed
+	if !strings.Contains(pattern, "{n}") {
+		if strings.Contains(pattern, "{ext}") {
+			r.retry = strings.Replace(pattern, "{ext}", "_{n}{ext}", 1)
+		} else {
+			r.retry = pattern + "_{n}"
+		}
+	}
+	return r, nil
+}
+
+func (r *renamer) listing(o Options, dir string) map[string]bool {
+	if names, ok := r.names[dir]; ok {
+		return names
+	}
+	names := make(map[string]bool)
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		names[o.destKey(filepath.Join(dir, e.Name()))] = true
+	}
+	r.names[dir] = names
+	return names
+}
+
+// next returns a free path next to dest for the file at src. Compound
+// extensions stay intact: report.tar.gz -> report_1.tar.gz.
+func (r *renamer) next(o Options, dest, src string, srcTime time.Time, placed map[string]string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Dir(dest)
+	stem, ext := o.Categorizer.splitExt(filepath.Base(dest))
+	repl := []string{"{name}", stem, "{ext}", ext, "{date}", "unknown"}
+	if !srcTime.IsZero() {
+		repl[5] = srcTime.Format("20060102")
+	}
+	if strings.Contains(r.pattern, "{hash8}") {
+		h, err := contentHash(src)
+		if err != nil {
+			return "", fmt.Errorf("cannot hash %s for -rename-template: %v", src, err)
+		}
+		repl = append(repl, "{hash8}", h)
+	}
+
+	names := r.listing(o, dir)
+	pattern := r.pattern
+	n := 1
+	if !strings.Contains(pattern, "{n}") {
+		n = 0
+	}
+	for ; ; n++ {
+		if n > 0 {
+			pattern = r.retry
+		}
+		name := strings.NewReplacer(append(repl, "{n}", strconv.Itoa(n))...).Replace(pattern)
+		p := filepath.Join(dir, name)
+		key := o.destKey(p)
+		if _, ok := placed[key]; ok || names[key] || key == o.destKey(dest) {
+			continue
+		}
+		names[key] = true
+		return p, nil
+	}
+}
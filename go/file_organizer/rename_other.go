@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports whether a rename failed only because src and dest
+// are on different filesystems, the one case a copy can stand in for.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
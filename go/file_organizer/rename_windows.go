@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+const errorNotSameDevice = syscall.Errno(17) // ERROR_NOT_SAME_DEVICE
+
+// crossDevice reports whether a rename failed only because src and dest
+// are on different volumes, the one case a copy can stand in for.
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
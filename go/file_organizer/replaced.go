@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// stateDir holds the tool's own files inside -dest; scans never enter it.
+const stateDir = ".organizer"
+
+// runIDFormat names the per-run folders of the replaced store; retention
+// reads the time back from the name.
+const runIDFormat = "20060102T150405"
+
+func replacedRoot(dest string) string {
+	return filepath.Join(dest, stateDir, "replaced")
+}
+
+// replacedPath is where an overwritten destination file is kept:
+// dest/.organizer/replaced/<run-id>/<category>/<name>. A name already used
+// in this run gets a numeric suffix.
+func (o Options) replacedPath(root, category, destPath string) string {
+	rel, err := filepath.Rel(root, destPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		rel = filepath.Base(destPath)
+	}
+	if root != o.Dest {
+		// -dest-for roots don't carry the category name themselves
+		rel = filepath.Join(topCategory(category), rel)
+	}
+	return o.unusedPath(filepath.Join(replacedRoot(o.Dest), o.RunID, rel))
+}
+
+// unusedPath returns p, or p with a numeric suffix if that is taken.
+func (o Options) unusedPath(p string) string {
+	stem, ext := o.Categorizer.splitExt(filepath.Base(p))
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(p); err != nil {
+			return p
+		}
+		p = filepath.Join(filepath.Dir(p), stem+"_"+strconv.Itoa(n)+ext)
+	}
+}
+
+// keepReplaced moves the file about to be overwritten into the replaced
+// store and returns the manifest entry for it.
+func (o Options) keepReplaced(root, category, destPath string) (manifestEntry, error) {
+	e := manifestEntry{Action: "replace", Src: destPath, Dest: o.replacedPath(root, category, destPath)}
+	if info, err := os.Lstat(destPath); err == nil {
+		e.Size = info.Size()
+	}
+	if o.DryRun {
+		fmt.Printf("DRY-RUN: keep replaced %s -> %s\n", destPath, e.Dest)
+		return e, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Dest), 0755); err != nil {
+		return e, err
+	}
+	if err := moveFile(destPath, e.Dest); err != nil {
+		return e, fmt.Errorf("cannot keep replaced %s: %v", destPath, err)
+	}
+	if o.Verbose {
+		fmt.Println("KEEP replaced:", destPath, "->", e.Dest)
+	}
+	return e, nil
+}
+
+// purgeReplaced removes run folders of the replaced store older than the
+// retention period.
+func (o Options) purgeReplaced(now time.Time) (int, error) {
+	entries, err := os.ReadDir(replacedRoot(o.Dest))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.AddDate(0, 0, -o.ReplacedRetention)
+	purged := 0
+	for _, e := range entries {
+		t, err := time.ParseInLocation(runIDFormat, e.Name(), time.Local)
+		if !e.IsDir() || err != nil || !t.Before(cutoff) {
+			continue
+		}
+		dir := filepath.Join(replacedRoot(o.Dest), e.Name())
+		if o.DryRun {
+			fmt.Println("DRY-RUN: purge replaced", dir)
+		} else if err := os.RemoveAll(dir); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// storeUsage totals the bytes held in the replaced store.
+func storeUsage(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ruleEntry struct {
+	Type        string    `json:"type"` // "extension", "glob", "regex", "filename", "subcategory", "screenshot", "region" or "junk"; inferred when empty
+	Name        string    `json:"name"`
+	Extension   string    `json:"extension"`
+	Pattern     string    `json:"pattern"`
+	Filename    string    `json:"filename"`
+	Match       string    `json:"match"` // "name" or "path"
+	Category    string    `json:"category"`
+	Subcategory string    `json:"subcategory"`
+	BBox        []float64 `json:"bbox"` // min_lat, min_lon, max_lat, max_lon
+}
+
+type ruleSet struct {
+	Ext           map[string]string
+	Patterns      []patternRule
+	Filenames     map[string]string
+	Subcategories map[string]map[string]string
+	Screenshots   []patternRule
+	Regions       []geoRegion
+	Junk          []string
+
+	extLine  map[string]int
+	nameLine map[string]int
+}
+
+func loadRules(path string) (*ruleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, rulesSyntaxError(path, data, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("%s:1: rules file must contain a JSON array of rule entries", path)
+	}
+
+	rules := &ruleSet{
+		Ext:           make(map[string]string),
+		Filenames:     make(map[string]string),
+		Subcategories: make(map[string]map[string]string),
+		extLine:       make(map[string]int),
+		nameLine:      make(map[string]int),
+	}
+
+	for i := 1; dec.More(); i++ {
+		line := lineAt(data, dec.InputOffset())
+
+		var e ruleEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s:%d: entry %d: %s", path, line, i, describeJSONError(data, err))
+		}
+		if err := rules.add(e, line); err != nil {
+			return nil, fmt.Errorf("%s:%d: entry %d: %v", path, line, i, err)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, rulesSyntaxError(path, data, err)
+	}
+
+	return rules, nil
+}
+
+func (rs *ruleSet) add(e ruleEntry, line int) error {
+	typ := strings.ToLower(e.Type)
+	if typ == "" {
+		switch {
+		case e.Pattern != "":
+			typ = "glob"
+		case e.Filename != "":
+			typ = "filename"
+		default:
+			typ = "extension"
+		}
+	}
+
+	switch typ {
+	case "extension":
+		return rs.addExtension(e, line)
+	case "glob", "regex":
+		if e.Extension != "" {
+			return errors.New("use either \"extension\" or \"pattern\", not both")
+		}
+		r, err := patternEntry(typ, e)
+		if err != nil {
+			return err
+		}
+		rs.Patterns = append(rs.Patterns, r)
+		return nil
+	case "filename":
+		return rs.addFilename(e, line)
+	case "subcategory":
+		return rs.addSubcategory(e)
+	case "screenshot":
+		if e.Category != "" && e.Category != "screenshots" {
+			return errors.New("screenshot patterns always use the screenshots category")
+		}
+		r, err := newRegexRule(e.Name, e.Pattern, "screenshots", false)
+		if err != nil {
+			return err
+		}
+		rs.Screenshots = append(rs.Screenshots, r)
+		return nil
+	case "region":
+		return rs.addRegion(e)
+	case "junk":
+		p := strings.TrimSpace(e.Pattern)
+		if p == "" {
+			p = strings.TrimSpace(e.Filename)
+		}
+		if p == "" || strings.ContainsAny(p, `/\`) {
+			return errors.New("junk needs a \"pattern\" or \"filename\" matching base names")
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid junk pattern %q: %v", p, err)
+		}
+		rs.Junk = append(rs.Junk, p)
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q (use \"extension\", \"glob\", \"regex\", \"filename\", \"subcategory\", \"screenshot\", \"region\" or \"junk\")", e.Type)
+	}
+}
+
+func (rs *ruleSet) addExtension(e ruleEntry, line int) error {
+	ext := strings.ToLower(strings.TrimSpace(e.Extension))
+	if ext == "" {
+		return errors.New("missing \"extension\" or \"pattern\"")
+	}
+	if !strings.HasPrefix(ext, ".") || ext == "." {
+		return fmt.Errorf("extension %q must start with a dot (e.g. \".%s\")", e.Extension, strings.TrimLeft(ext, "."))
+	}
+	if prev, ok := rs.extLine[ext]; ok {
+		return fmt.Errorf("duplicate extension %q (first defined on line %d)", ext, prev)
+	}
+
+	category, err := cleanCategory(e.Category)
+	if err != nil {
+		return err
+	}
+
+	rs.extLine[ext] = line
+	rs.Ext[ext] = category
+	return nil
+}
+
+func (rs *ruleSet) addFilename(e ruleEntry, line int) error {
+	name := strings.TrimSpace(e.Filename)
+	if name == "" {
+		return errors.New("missing \"filename\"")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("filename %q must be a base name, not a path", e.Filename)
+	}
+	if prev, ok := rs.nameLine[name]; ok {
+		return fmt.Errorf("duplicate filename %q (first defined on line %d)", name, prev)
+	}
+
+	category, err := cleanCategory(e.Category)
+	if err != nil {
+		return err
+	}
+
+	rs.nameLine[name] = line
+	rs.Filenames[name] = category
+	return nil
+}
+
+func patternEntry(typ string, e ruleEntry) (patternRule, error) {
+	usePath := typ == "glob" && strings.Contains(e.Pattern, "/")
+	switch strings.ToLower(e.Match) {
+	case "":
+	case "name":
+		usePath = false
+	case "path":
+		usePath = true
+	default:
+		return patternRule{}, fmt.Errorf("match %q must be \"name\" or \"path\"", e.Match)
+	}
+	if typ == "regex" {
+		return newRegexRule(e.Name, e.Pattern, e.Category, usePath)
+	}
+	return newGlobRule(e.Name, e.Pattern, e.Category, usePath)
+}
+
+func (rs *ruleSet) addSubcategory(e ruleEntry) error {
+	ext := strings.ToLower(strings.TrimSpace(e.Extension))
+	if !strings.HasPrefix(ext, ".") || ext == "." {
+		return fmt.Errorf("extension %q must start with a dot", e.Extension)
+	}
+	category, err := cleanCategory(e.Category)
+	if err != nil {
+		return err
+	}
+	sub, err := cleanCategory(e.Subcategory)
+	if err != nil {
+		return fmt.Errorf("subcategory: %v", err)
+	}
+
+	table := rs.Subcategories[category]
+	if table == nil {
+		table = make(map[string]string)
+		rs.Subcategories[category] = table
+	}
+	if prev, ok := table[ext]; ok {
+		return fmt.Errorf("duplicate subcategory for %s in %s (already %q)", ext, category, prev)
+	}
+	table[ext] = sub
+	return nil
+}
+
+func (rs *ruleSet) addRegion(e ruleEntry) error {
+	name := sanitizeComponent(e.Name)
+	if name == "" {
+		return errors.New("region needs a \"name\"")
+	}
+	if len(e.BBox) != 4 {
+		return fmt.Errorf("region %q: bbox must be [min_lat, min_lon, max_lat, max_lon]", e.Name)
+	}
+	r := geoRegion{Name: name, MinLat: e.BBox[0], MinLon: e.BBox[1], MaxLat: e.BBox[2], MaxLon: e.BBox[3]}
+	if r.MinLat < -90 || r.MaxLat > 90 || r.MinLat > r.MaxLat {
+		return fmt.Errorf("region %q: latitudes must satisfy -90 <= min_lat <= max_lat <= 90", e.Name)
+	}
+	if r.MinLon < -180 || r.MinLon > 180 || r.MaxLon < -180 || r.MaxLon > 180 {
+		return fmt.Errorf("region %q: longitudes must be within -180..180", e.Name)
+	}
+	rs.Regions = append(rs.Regions, r)
+	return nil
+}
+
+func cleanCategory(s string) (string, error) {
+	c := strings.TrimSpace(s)
+	if c == "" {
+		return "", errors.New("empty category name")
+	}
+	if filepath.IsAbs(c) || strings.HasPrefix(c, "/") || strings.HasPrefix(c, `\`) {
+		return "", fmt.Errorf("category %q must be a relative folder name", s)
+	}
+	for _, part := range strings.FieldsFunc(c, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == "." || part == ".." {
+			return "", fmt.Errorf("category %q must not contain %q", s, part)
+		}
+	}
+	return filepath.Clean(filepath.FromSlash(c)), nil
+}
+
+func rulesSyntaxError(path string, data []byte, err error) error {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return fmt.Errorf("%s:%d: %v", path, lineAt(data, se.Offset), err)
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+func describeJSONError(data []byte, err error) string {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) && te.Field != "" {
+		return fmt.Sprintf("field %q must be a %s", te.Field, te.Type)
+	}
+	return err.Error()
+}
+
+// lineAt returns the 1-based line of the first token at or after offset.
+func lineAt(data []byte, offset int64) int {
+	n := int(offset)
+	if n > len(data) {
+		n = len(data)
+	}
+	for n < len(data) && strings.IndexByte(" \t\r\n,", data[n]) >= 0 {
+		n++
+	}
+	return bytes.Count(data[:n], []byte("\n")) + 1
+}
+
+func printRules(c *categorizer) {
+	if len(c.patterns) > 0 {
+		fmt.Println("Pattern rules (first match wins):")
+		for i, r := range c.patterns {
+			subject := "name"
+			if r.Path {
+				subject = "path"
+			}
+			label := ""
+			if r.Name != r.Pattern {
+				label = " [" + r.Name + "]"
+			}
+			fmt.Printf("  %d. %s %s %s -> %s%s\n", i+1, r.kind(), subject, r.Pattern, r.Category, label)
+		}
+	}
+
+	if len(c.nameSource) > 0 {
+		names := make([]string, 0, len(c.nameSource))
+		for name := range c.nameSource {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println("Filename rules:")
+		for _, name := range names {
+			fmt.Printf("  %s -> %s (%s)\n", name, c.names[name], c.nameSource[name])
+		}
+	}
+
+	if len(c.source) == 0 {
+		return
+	}
+	exts := make([]string, 0, len(c.source))
+	for ext := range c.source {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	fmt.Println("Extension rules:")
+	for _, ext := range exts {
+		builtin, ok := c.builtin[ext]
+		if ok && builtin != c.ext[ext] {
+			fmt.Printf("  %s -> %s (%s, overrides %s)\n", ext, c.ext[ext], c.source[ext], builtin)
+			continue
+		}
+		fmt.Printf("  %s -> %s (%s)\n", ext, c.ext[ext], c.source[ext])
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// sampleFiles keeps n files picked at random with the given seed, in their
+// scan order, so the same seed over the same files picks the same sample.
+func sampleFiles(files []fileEntry, n int, seed int64) []fileEntry {
+	if n >= len(files) {
+		return files
+	}
+	idx := rand.New(rand.NewSource(seed)).Perm(len(files))[:n]
+	sort.Ints(idx)
+	out := make([]fileEntry, n)
+	for i, j := range idx {
+		out[i] = files[j]
+	}
+	return out
+}
+
+// printSample reports the category distribution of a -sample run and
+// scales it to all the files the filters let through.
+func printSample(files []fileEntry, plan []match, population int, seed int64) {
+	counts := make(map[string]int)
+	for i, f := range files {
+		cat := topCategory(plan[i].Category)
+		if f.Marker != "" {
+			cat = "projects"
+		}
+		counts[cat]++
+	}
+	fmt.Printf("Sample: %d of %d files (-seed %d)\n", len(files), population, seed)
+	cats := make([]string, 0, len(counts))
+	for cat := range counts {
+		cats = append(cats, cat)
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		if counts[cats[i]] != counts[cats[j]] {
+			return counts[cats[i]] > counts[cats[j]]
+		}
+		return cats[i] < cats[j]
+	})
+	for _, cat := range cats {
+		share := float64(counts[cat]) / float64(len(files))
+		fmt.Printf("  %s: %d (%.1f%%, about %.0f of all)\n", cat, counts[cat], 100*share, share*float64(population))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxComponentLen bounds folder names built from metadata (tags, EXIF),
+// which can be arbitrarily long.
+const maxComponentLen = 80
+
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeComponent turns an arbitrary string into a single path component
+// that is valid on Linux, macOS and Windows. It returns "" when nothing
+// usable is left.
+func sanitizeComponent(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, s)
+
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimLeft(s, ". ")
+	if utf8.RuneCountInString(s) > maxComponentLen {
+		s = string([]rune(s)[:maxComponentLen])
+	}
+	s = strings.TrimRight(s, ". ")
+
+	stem, _, _ := strings.Cut(s, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimSpace(stem))] {
+		s = "_" + s
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// categoryScope is -only-categories or -skip-categories. A name selects
+// the category and its subfolders (code also covers code/go).
+type categoryScope struct {
+	names []string
+	only  bool
+}
+
+func parseCategoryScope(o Options) (*categoryScope, error) {
+	if o.OnlyCategories != "" && o.SkipCategories != "" {
+		return nil, fmt.Errorf("-only-categories and -skip-categories can't be combined")
+	}
+	list, flagName := o.OnlyCategories, "only-categories"
+	if list == "" {
+		list, flagName = o.SkipCategories, "skip-categories"
+	}
+	if list == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool)
+	var names []string
+	for _, cat := range o.knownCategories() {
+		if cat != stateDir {
+			known[cat] = true
+			names = append(names, cat)
+		}
+	}
+	s := &categoryScope{only: o.OnlyCategories != ""}
+	for _, name := range strings.Split(list, ",") {
+		name = filepath.FromSlash(strings.Trim(strings.TrimSpace(name), "/"))
+		if name == "" {
+			continue
+		}
+		if !known[topCategory(name)] {
+			return nil, fmt.Errorf("-%s: unknown category %q (known: %s)", flagName, name, strings.Join(names, ", "))
+		}
+		s.names = append(s.names, name)
+	}
+	return s, nil
+}
+
+// includes reports whether files of category cat are organized.
+func (s *categoryScope) includes(cat string) bool {
+	if s == nil {
+		return true
+	}
+	for _, name := range s.names {
+		if cat == name || strings.HasPrefix(cat, name+string(filepath.Separator)) {
+			return s.only
+		}
+	}
+	return !s.only
+}
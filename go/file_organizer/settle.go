@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// settleRecheckDelay is how long -settle-recheck waits between the two stats.
+const settleRecheckDelay = time.Second
+
+// settled reports whether a file was last modified at least -settle ago.
+func (o Options) settled(info os.FileInfo, now time.Time) bool {
+	return o.Settle <= 0 || now.Sub(info.ModTime()) >= o.Settle
+}
+
+// selectSettled drops files that may still be written to: modified within
+// -settle of now or, with -settle-recheck, changed in size or mtime across
+// one pause for the whole batch. Only stats are taken, nothing is read.
+func (o Options) selectSettled(files []fileEntry, now time.Time) ([]fileEntry, int) {
+	if o.Settle <= 0 && !o.SettleRecheck {
+		return files, 0
+	}
+	kept := files[:0]
+	for _, fe := range files {
+		if fe.Marker == "" && fe.Info != nil && !o.settled(fe.Info, now) {
+			if o.Verbose {
+				fmt.Printf("NOT SETTLED: %s (modified %s ago)\n", fe.Path, now.Sub(fe.Info.ModTime()).Round(time.Second))
+			}
+			continue
+		}
+		kept = append(kept, fe)
+	}
+	if o.SettleRecheck && len(kept) > 0 {
+		time.Sleep(settleRecheckDelay)
+		still := kept[:0]
+		for _, fe := range kept {
+			if fe.Marker == "" && fe.Info != nil && fe.Info.Mode().IsRegular() {
+				info, err := os.Lstat(fe.Path)
+				if err == nil && (info.Size() != fe.Info.Size() || !info.ModTime().Equal(fe.Info.ModTime())) {
+					if o.Verbose {
+						fmt.Printf("NOT SETTLED: %s (still changing)\n", fe.Path)
+					}
+					continue
+				}
+			}
+			still = append(still, fe)
+		}
+		kept = still
+	}
+	return kept, len(files) - len(kept)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// foldLatin maps accented Latin letters to their base letter so "Élan" and
+// "elan" share a shard.
+var foldLatin = map[rune]rune{}
+
+func init() {
+	for base, accented := range map[rune]string{
+		'a': "àáâãäåāăąǎ",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏőǒ",
+		'r': "ŕŗř",
+		's': "śŝşšſ",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűųǔ",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	} {
+		for _, r := range accented {
+			foldLatin[r] = base
+		}
+	}
+}
+
+type shardSpec struct {
+	Mode   string
+	Levels []int // hex digits per folder level in hash mode
+	Algo   string
+}
+
+var hashAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"sha512": sha512.New,
+	"md5":    md5.New,
+}
+
+// parseShard parses -shard: "first-letter", or "hash:2/2" for nested
+// folders named after the leading hex digits of the content hash.
+func parseShard(s, algo string) (*shardSpec, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, nil
+	case s == "first-letter":
+		return &shardSpec{Mode: "first-letter"}, nil
+	case s == "hash" || strings.HasPrefix(s, "hash:"):
+	default:
+		return nil, errors.New("invalid -shard (use first-letter or hash:2/2)")
+	}
+	if _, ok := hashAlgos[algo]; !ok {
+		return nil, fmt.Errorf("invalid -hash-algo %q (use sha256, sha1, sha512 or md5)", algo)
+	}
+	spec := &shardSpec{Mode: "hash", Algo: algo}
+	levels := "2/2"
+	if _, rest, ok := strings.Cut(s, ":"); ok {
+		levels = rest
+	}
+	for _, l := range strings.Split(levels, "/") {
+		n, err := strconv.Atoi(strings.TrimSpace(l))
+		if err != nil || n < 1 || n > 8 {
+			return nil, fmt.Errorf("invalid -shard %q: levels are 1-8 hex digits, e.g. hash:2/2", s)
+		}
+		spec.Levels = append(spec.Levels, n)
+	}
+	if len(spec.Levels) > 4 {
+		return nil, fmt.Errorf("invalid -shard %q: at most 4 levels", s)
+	}
+	return spec, nil
+}
+
+// hashLabel formats a digest for the manifest as "algo:hex".
+func (s *shardSpec) hashLabel(sum string) string {
+	if s == nil || sum == "" {
+		return ""
+	}
+	return s.Algo + ":" + sum
+}
+
+// hashDirs splits a hex digest into the configured prefix folders.
+func (s *shardSpec) hashDirs(sum string) string {
+	var dirs []string
+	for _, n := range s.Levels {
+		dirs = append(dirs, sum[:n])
+		sum = sum[n:]
+	}
+	return strings.Join(dirs, string(os.PathSeparator))
+}
+
+// shard picks the shard folder for src. In hash mode the file has to be
+// read; when copying for real it is copied into dir (a temporary name) at
+// the same time and the staged path is returned for a rename into place.
+func (o Options) shard(ctx context.Context, src, dir, name string) (shard, sum, staged string, err error) {
+	if o.Shard.Mode != "hash" {
+		return firstLetterShard(name), "", "", nil
+	}
+	if o.Mode == "copy" && !o.DryRun {
+		if err := ensureDir(dir, false, o.Verbose); err != nil {
+			return "", "", "", err
+		}
+		staged, sum, err = stageCopy(ctx, src, dir, o.Shard.Algo)
+	} else {
+		sum, err = hashFile(src, o.Shard.Algo)
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("cannot hash %s: %w", src, err)
+	}
+	return o.Shard.hashDirs(sum), sum, staged, nil
+}
+
+func hashFile(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := hashAlgos[algo]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stageCopy copies src to a temporary file in dir while hashing it.
+func stageCopy(ctx context.Context, src, dir, algo string) (string, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", "", err
+	}
+	defer in.Close()
+
+	out, err := createTemp(filepath.Join(dir, filepath.Base(src)))
+	if err != nil {
+		return "", "", err
+	}
+	h := hashAlgos[algo]()
+	_, err = io.Copy(io.MultiWriter(out, h), cancelable(ctx, in))
+	if err == nil {
+		err = keepMetadata(out, in, src)
+	}
+	if err == nil && syncData() {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		keepPathMetadata(out.Name(), in, src)
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", "", err
+	}
+	return out.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// firstLetterShard buckets by the first rune of the name, ignoring leading
+// dots: letters fold to lower case without diacritics, digits share 0-9
+// and everything else goes to _other.
+func firstLetterShard(name string) string {
+	r, _ := utf8.DecodeRuneInString(strings.TrimLeft(name, "."))
+	switch {
+	case r == utf8.RuneError:
+		return "_other"
+	case unicode.IsDigit(r):
+		return "0-9"
+	case unicode.IsLetter(r):
+		r = unicode.ToLower(r)
+		if base, ok := foldLatin[r]; ok {
+			r = base
+		}
+		if d := sanitizeComponent(string(r)); d != "" {
+			return d
+		}
+	}
+	return "_other"
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxShebangFile skips large extensionless files; scripts are small and
+	// anything bigger is almost certainly a binary or data file.
+	maxShebangFile = 1 << 20
+	shebangLen     = 256
+)
+
+// shebangExts maps interpreters to the extension whose subcategory
+// (-split-code) a script should share.
+var shebangExts = map[string]string{
+	"sh":      ".sh",
+	"bash":    ".sh",
+	"zsh":     ".sh",
+	"dash":    ".sh",
+	"ksh":     ".sh",
+	"python":  ".py",
+	"python2": ".py",
+	"python3": ".py",
+	"node":    ".js",
+	"deno":    ".ts",
+	"ruby":    ".rb",
+	"php":     ".php",
+}
+
+// shebangInterpreter returns the interpreter named by a "#!" first line, or
+// "" if the file doesn't start with one. The interpreter path is only
+// parsed, never resolved.
+func shebangInterpreter(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxShebangFile {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	buf := make([]byte, shebangLen)
+	n, _ := io.ReadFull(f, buf)
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte("#!")) || bytes.IndexByte(buf, 0) >= 0 {
+		return ""
+	}
+	line, _, _ := bytes.Cut(buf[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := filepath.Base(fields[0])
+	if interp == "env" {
+		interp = ""
+		for _, f := range fields[1:] {
+			// skip env options such as -S
+			if !strings.HasPrefix(f, "-") {
+				interp = f
+				break
+			}
+		}
+	}
+	return interp
+}
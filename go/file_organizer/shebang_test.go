@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		name, content string
+		interp        string
+		category      string // with -split-code
+	}{
+		{"cli", "#!/usr/bin/env python3\nprint('hi')\n", "python3", "code/python"},
+		{"deploy", "#!/bin/sh\nset -e\n", "sh", "code/shell"},
+		{"tool", "#!/usr/bin/env -S node --no-warnings\n", "node", "code/javascript"},
+		{"runner", "#!/opt/bin/custom-interp\n", "custom-interp", "code"},
+		{"notes", "# heading\nplain text\n", "", "no_extension"},
+		{"blob", "#!\x00\x01\x02binary", "", "no_extension"},
+		{"hashbin", "#\x7fELF\x00\x00\x00\x00", "", "no_extension"},
+		{"bare", "#!\n", "", "no_extension"},
+		{"empty", "", "", "no_extension"},
+	}
+	dir := t.TempDir()
+	c := newCategorizer()
+	c.split["code"] = true
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if got := shebangInterpreter(path); got != tt.interp {
+			t.Errorf("%s: interpreter %q, want %q", tt.name, got, tt.interp)
+		}
+		if m := c.categorize(path, tt.name); m.Category != filepath.FromSlash(tt.category) {
+			t.Errorf("%s: category %s, want %s", tt.name, m.Category, tt.category)
+		}
+	}
+}
+
+func TestShebangSkipsLargeMissingAndLinked(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big")
+	content := "#!/bin/sh\n" + strings.Repeat("x", maxShebangFile)
+	if err := os.WriteFile(big, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := shebangInterpreter(big); got != "" {
+		t.Errorf("file over maxShebangFile read as %q", got)
+	}
+	if got := shebangInterpreter(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("missing file read as %q", got)
+	}
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(script, link); err == nil {
+		if got := shebangInterpreter(link); got != "" {
+			t.Errorf("symlink read through as %q", got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarSuffix names the metadata file another tool can put next to a
+// data file: photo.jpg.organizer.json.
+const sidecarSuffix = ".organizer.json"
+
+// sidecarHint is what a sidecar may say; other fields are left to the
+// tool that wrote it.
+type sidecarHint struct {
+	Category string `json:"category"` // may have subfolders: "portfolio/2024"
+}
+
+// attachSidecars pairs each sidecar with the data file next to it and
+// takes it off the list, so it is filtered, placed and reported with its
+// data file. A sidecar without one stays an ordinary file.
+func attachSidecars(files []fileEntry) ([]fileEntry, int) {
+	index := make(map[string]int, len(files))
+	for i, f := range files {
+		index[f.Path] = i
+	}
+	out := files[:0:0]
+	paired := make(map[string]bool)
+	for _, f := range files {
+		data := strings.TrimSuffix(f.Path, sidecarSuffix)
+		if data == f.Path || f.Marker != "" {
+			continue
+		}
+		if i, ok := index[data]; ok && files[i].Marker == "" {
+			files[i].Sidecar = f.Path
+			paired[f.Path] = true
+		}
+	}
+	for _, f := range files {
+		if !paired[f.Path] {
+			out = append(out, f)
+		}
+	}
+	return out, len(paired)
+}
+
+// sidecarMatch reads the category a sidecar asks for. A sidecar that
+// can't be used is reported and the normal rules apply.
+func sidecarMatch(path string) (match, bool) {
+	hint, err := loadSidecar(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: ignoring sidecar", path+":", err)
+		return match{}, false
+	}
+	return match{Category: hint.Category, Via: "sidecar " + filepath.Base(path)}, true
+}
+
+func loadSidecar(path string) (sidecarHint, error) {
+	var hint sidecarHint
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return hint, err
+	}
+	if err := json.Unmarshal(b, &hint); err != nil {
+		return hint, err
+	}
+	cat := filepath.Clean(filepath.FromSlash(strings.TrimSpace(hint.Category)))
+	switch {
+	case hint.Category == "":
+		return hint, errors.New(`no "category"`)
+	case !filepath.IsLocal(cat):
+		return hint, fmt.Errorf("category %q is not a relative folder", hint.Category)
+	case topCategory(cat) == stateDir:
+		return hint, fmt.Errorf("category %q is reserved", hint.Category)
+	}
+	hint.Category = cat
+	return hint, nil
+}
+
+// carrySidecar moves or copies a sidecar next to where its data file went,
+// as dest plus the suffix, so the pair stays together through renames.
+func (o Options) carrySidecar(ctx context.Context, src, dest string, pending bool, deferred *deferredDeletes, mf *manifest) {
+	dest += sidecarSuffix
+	info, err := os.Lstat(src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: sidecar", src, "not carried:", err)
+		return
+	}
+	action := o.Mode
+	switch {
+	case o.Mode == "move" && !pending:
+		_, err = relocate(ctx, src, dest)
+	default:
+		action = "copy"
+		err = copyFile(ctx, src, dest)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: sidecar", src, "not carried:", err)
+		return
+	}
+	if o.Verbose {
+		fmt.Printf("SIDECAR: %s -> %s\n", src, dest)
+	}
+	if pending {
+		deferred.add(manifestEntry{Action: "delete-source", Src: src, Dest: dest, Size: info.Size()})
+	}
+	if err := mf.record(manifestEntry{Action: action, Src: src, Dest: dest, Size: info.Size(), DeleteSource: pending}); err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: cannot write manifest:", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultSizeBuckets is used by the {size} layout token when -size-buckets
+// isn't given.
+const defaultSizeBuckets = "small=10MB,medium=500MB,large="
+
+type sizeBucket struct {
+	Name string
+	Max  int64 // exclusive upper bound; 0 for the open-ended last bucket
+}
+
+type sizeBuckets []sizeBucket
+
+// parseSizeBuckets parses "small=10MB,medium=500MB,large=". Bounds must
+// increase; only the last bucket may leave its bound empty.
+func parseSizeBuckets(s string) (sizeBuckets, error) {
+	var out sizeBuckets
+	seen := make(map[string]bool)
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		name, limit, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = sanitizeComponent(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid -size-buckets %q: expected NAME=SIZE entries", s)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid -size-buckets %q: duplicate bucket %q", s, name)
+		}
+		seen[name] = true
+
+		b := sizeBucket{Name: name}
+		if limit = strings.TrimSpace(limit); limit == "" {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("invalid -size-buckets %q: only the last bucket can be open-ended", s)
+			}
+		} else {
+			n, err := parseSize(limit)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -size-buckets %q: %v", s, err)
+			}
+			if n <= 0 || (len(out) > 0 && n <= out[len(out)-1].Max) {
+				return nil, fmt.Errorf("invalid -size-buckets %q: sizes must be positive and increasing", s)
+			}
+			b.Max = n
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"K":   1 << 10,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TIB": 1 << 40,
+}
+
+// parseSize reads sizes like "500MB", "1.5GiB" or "4096". KB/MB/GB are
+// decimal; K/KiB, M/MiB, ... are binary.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("bad size %q (use e.g. 10MB, 1.5GiB)", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q (use e.g. 10MB, 1.5GiB)", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// bucket returns the name of the first bucket n fits in, or "" if it is
+// larger than every bounded bucket and there is no open-ended one.
+func (bs sizeBuckets) bucket(n int64) string {
+	for _, b := range bs {
+		if b.Max == 0 || n < b.Max {
+			return b.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// transliterations covers letters that have no decomposition to ASCII.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l", 'þ': "th", 'ı': "i",
+}
+
+// slugName turns a file name into lowercase ASCII words for -sanitize-names:
+// "Invoice (final) [v2]   copy.PDF" -> "invoice_final_v2_copy.pdf". Accents
+// are dropped, anything else outside [a-z0-9.-] separates words. A name
+// with no usable characters is kept as is.
+func (o Options) slugName(name string) string {
+	stem, ext := o.Categorizer.splitExt(name)
+	dot := ""
+	if isDotfile(name) {
+		dot, stem = ".", stem[1:]
+	}
+	slug := slugify(stem)
+	if slug == "" {
+		return name
+	}
+	return dot + slug + strings.ToLower(ext)
+}
+
+func slugify(s string) string {
+	var b strings.Builder
+	sep := "" // pending separator run
+	flush := func() {
+		if sep == "" {
+			return
+		}
+		if b.Len() > 0 {
+			// "a - b" becomes "a-b": a dot or dash wins over spaces.
+			if i := strings.IndexAny(sep, ".-"); i >= 0 {
+				b.WriteByte(sep[i])
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		sep = ""
+	}
+	for _, r := range decomposeNFD(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			flush()
+			b.WriteRune(r)
+		case r == '.' || r == '-':
+			sep += string(r)
+		default:
+			if t, ok := transliterations[r]; ok {
+				flush()
+				b.WriteString(t)
+			} else {
+				sep += "_"
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen matches what http.DetectContentType looks at; reading more
+// would only slow down large directories.
+const sniffLen = 512
+
+var extraSignatures = []struct {
+	Offset int
+	Magic  []byte
+	MIME   string
+}{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("PK\x05\x06"), "application/zip"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftypmif1"), "image/heif"},
+	{4, []byte("ftypqt"), "video/quicktime"},
+	{4, []byte("ftypM4A"), "audio/mp4"},
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("Rar!\x1a\x07"), "application/x-rar-compressed"},
+	{0, []byte("\x1f\x8b"), "application/gzip"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+}
+
+func sniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return sniffContent(buf[:n]), nil
+}
+
+func sniffContent(b []byte) string {
+	for _, s := range extraSignatures {
+		if len(b) >= s.Offset+len(s.Magic) && bytes.Equal(b[s.Offset:s.Offset+len(s.Magic)], s.Magic) {
+			return s.MIME
+		}
+	}
+	mime := http.DetectContentType(b)
+	if i := strings.Index(mime, ";"); i >= 0 {
+		mime = mime[:i]
+	}
+	return mime
+}
+
+// categoryByMIME maps a sniffed content type onto the built-in categories.
+// It returns "" when the type says nothing useful (e.g. octet-stream).
+func categoryByMIME(mime string) string {
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return "images"
+	case strings.HasPrefix(mime, "video/"):
+		return "videos"
+	case strings.HasPrefix(mime, "audio/"), mime == "application/ogg":
+		return "audio"
+	case mime == "text/html", mime == "text/xml", mime == "application/json", mime == "application/javascript":
+		return "code"
+	case mime == "application/pdf", mime == "application/postscript", mime == "text/plain", mime == "application/rtf":
+		return "documents"
+	case mime == "application/zip", mime == "application/gzip", mime == "application/x-gzip",
+		mime == "application/x-7z-compressed", mime == "application/x-rar-compressed", mime == "application/x-tar":
+		return "archives"
+	case mime == "application/vnd.sqlite3":
+		return "databases"
+	case strings.HasPrefix(mime, "font/"):
+		return "fonts"
+	default:
+		return ""
+	}
+}
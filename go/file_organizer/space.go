@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// spaceNeed is what a run will write to one destination filesystem.
+type spaceNeed struct {
+	Root  string // first destination root on it, for the message
+	dir   string // its closest existing folder, for statfs
+	Bytes int64
+}
+
+// checkSpace adds up the sizes headed for each destination filesystem and
+// fails when one has less free space. Moves that stay on a filesystem are
+// renames and need nothing (unless -deferred-delete copies them first).
+// Only the batch -max-files takes is counted, capped at -max-bytes.
+func (o Options) checkSpace(files []fileEntry, plan []match) error {
+	needs := make(map[string]*spaceNeed)
+	var order []string
+	type rootFS struct{ fs, dir string }
+	roots := make(map[string]rootFS)
+	for i, f := range files {
+		if o.MaxFiles > 0 && i >= o.MaxFiles {
+			break
+		}
+		if f.Info == nil || f.Marker != "" || plan[i].Category == "" {
+			continue
+		}
+		root, _ := o.categoryDir(plan[i].Category)
+		r, ok := roots[root]
+		if !ok {
+			r.fs, r.dir = existingDevice(root)
+			roots[root] = r
+		}
+		fs := r.fs
+		if fs == "" {
+			continue
+		}
+		if o.Mode == "move" && !o.DeferredDelete {
+			if src, ok := deviceOf(f.Path, f.Info); ok && src == fs {
+				continue
+			}
+		}
+		n := needs[fs]
+		if n == nil {
+			n = &spaceNeed{Root: root, dir: r.dir}
+			needs[fs] = n
+			order = append(order, fs)
+		}
+		n.Bytes += f.Info.Size()
+	}
+
+	var short []string
+	for _, fs := range order {
+		n := needs[fs]
+		if o.MaxBytes > 0 {
+			n.Bytes = min(n.Bytes, o.MaxBytes)
+		}
+		free, err := freeBytes(n.dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARN: cannot check free space on %s: %v\n", n.Root, err)
+			continue
+		}
+		if n.Bytes > free {
+			short = append(short, fmt.Sprintf("need %s, have %s on %s", formatBytes(n.Bytes), formatBytes(free), n.Root))
+		}
+	}
+	if len(short) > 0 {
+		return fmt.Errorf("not enough free space: %s (-ignore-space-check to run anyway)", strings.Join(short, "; "))
+	}
+	return nil
+}
+
+// existingDevice identifies the filesystem dir is (or will be) on, from
+// its closest existing folder, which it returns too.
+func existingDevice(dir string) (string, string) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if info, err := os.Stat(d); err == nil {
+			fs, _ := deviceOf(d, info)
+			return fs, d
+		}
+		if filepath.Dir(d) == d {
+			return "", ""
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func freeBytes(dir string) (int64, error) {
+	return 0, errors.New("not supported on this platform")
+}
+
+func deviceOf(path string, info os.FileInfo) (string, bool) {
+	return "", false
+}
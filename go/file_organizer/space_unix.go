@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+func freeBytes(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
+
+func deviceOf(path string, info os.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(st.Dev), 10), true
+}
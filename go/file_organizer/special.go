@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// specialFileModes are the -special-files values.
+var specialFileModes = map[string]bool{"skip": true, "rename": true}
+
+// specialKind names a file that reading would block on or that has no
+// content to copy: FIFOs, sockets, devices and other irregular files such
+// as Solaris doors. It is "" for regular files, folders and symlinks.
+func specialKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	case mode&fs.ModeDevice != 0:
+		return "block device"
+	case mode&fs.ModeIrregular != 0:
+		return "irregular file"
+	}
+	return ""
+}
+
+// renamesSpecial reports whether special files are organized: only by
+// -special-files rename in -mode move, as they can be renamed but never
+// copied.
+func (o Options) renamesSpecial() bool {
+	return o.SpecialFiles == "rename" && o.Mode == "move" && !o.DeferredDelete
+}
+
+// skipSpecial counts and, with -verbose, lists a special file the scan
+// leaves out. One reached through -follow-symlinks is always left out:
+// moving it would mean copying.
+func (o Options) skipSpecial(path, kind string, followed bool, counts *scanCounts) bool {
+	if kind == "" || (o.renamesSpecial() && !followed) {
+		return false
+	}
+	counts.Special++
+	if o.Verbose {
+		fmt.Printf("SPECIAL FILE: %s (%s), skipped\n", path, kind)
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesFoundCountsEverythingLeftOut(t *testing.T) {
+	for _, extra := range [][]string{nil, {"-sample", "1"}} {
+		src := t.TempDir()
+		for name, content := range map[string]string{
+			"a.txt":     "a",
+			"b.jpg":     "b",
+			"c.log":     "excluded",
+			"d.txt":     "this one is too large",
+			".DS_Store": "junk",
+			"empty.bin": "",
+		} {
+			if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		args := append([]string{"-src", src, "-dest", filepath.Join(t.TempDir(), "out"), "-dry-run", "-verbose",
+			"-exclude", "*.log", "-max-size", "10", "-placeholders", "skip"}, extra...)
+		out, err := organize(t, args...)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		if !strings.Contains(out, "Files found: 6\n") {
+			t.Errorf("%v: want all 6 files found:\n%s", extra, out)
+		}
+	}
+}
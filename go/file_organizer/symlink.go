@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// symlinkTargets are the -symlink-targets values.
+var symlinkTargets = map[string]bool{"adjust": true, "keep": true}
+
+// isSymlink reports whether info, from Lstat, describes a symlink.
+func isSymlink(info os.FileInfo) bool {
+	return info != nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// linkEntry collects a symlink that is placed as a link rather than
+// followed. It is only read with Readlink, so broken links are collected
+// too.
+func linkEntry(root, path string, d fs.DirEntry) (fileEntry, bool) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: cannot read symlink", path+":", err)
+		return fileEntry{}, false
+	}
+	e := newFileEntry(root, path, d)
+	e.Link = target
+	return e, true
+}
+
+// skipJunction reports, with a warning, a Windows junction or other
+// reparse point that is neither a file nor a symlink.
+func skipJunction(path string, d fs.DirEntry) bool {
+	if !isJunction(d) {
+		return false
+	}
+	fmt.Fprintln(os.Stderr, "WARN: skipping", path+": junctions are not organized (a symlink would be placed as one)")
+	return true
+}
+
+// linkTarget is what a symlink moved from src to dest should point to.
+// With adjust, a relative target is rewritten to reach the same place
+// from dest's folder; absolute targets never change.
+func linkTarget(src, dest, target string, adjust bool) string {
+	if !adjust || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return target
+	}
+	at := filepath.Join(filepath.Dir(resolvedPath(src)), target)
+	rel, err := filepath.Rel(filepath.Dir(resolvedPath(dest)), at)
+	if err != nil {
+		return at
+	}
+	return rel
+}
+
+// placeLink puts the symlink src at dest, pointing at target, and with
+// move removes src. A link whose target stays the same is renamed where
+// possible; otherwise it is created under a temporary name and renamed
+// over dest. The link is never read through. It reports whether a new
+// link had to be made.
+func placeLink(src, dest, target string, move bool) (bool, error) {
+	if move && target == readTarget(src) {
+		err := os.Rename(src, longPath(dest))
+		if err == nil {
+			return false, nil
+		}
+		if !crossDevice(err) {
+			return false, explainLength(dest, err)
+		}
+	}
+	if err := symlinkAtomic(target, dest); err != nil {
+		return true, err
+	}
+	if info, err := os.Lstat(src); err == nil && preserveOwner {
+		applyOwner(longPath(dest), info)
+	}
+	if !move {
+		return true, nil
+	}
+	return true, finishMove(src, dest)
+}
+
+func readTarget(path string) string {
+	t, _ := os.Readlink(path)
+	return t
+}
+
+// symlinkAtomic creates a symlink at dest, replacing whatever is there in
+// one step.
+func symlinkAtomic(target, dest string) error {
+	for try := 0; ; try++ {
+		tmp, err := tempPath(dest)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(target, longPath(tmp))
+		if os.IsExist(err) && try < 10 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot create symlink %s: %v%s", dest, explainLength(tmp, err), symlinkHint)
+		}
+		if err := os.Rename(tmp, longPath(dest)); err != nil {
+			removePartial(tmp)
+			return explainLength(dest, err)
+		}
+		return nil
+	}
+}
+
+// linkHash stands in for a content hash of a symlink, which is never read
+// through: it hashes where the link points.
+func linkHash(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(target))
+	return hex.EncodeToString(sum[:])[:hashLen], nil
+}
+
+// followLink resolves a symlink for -follow-symlinks.
+func followLink(path string) (string, os.FileInfo, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", nil, err
+	}
+	return target, info, nil
+}
+
+// dirIdentity names a folder for -follow-symlinks cycle detection.
+func dirIdentity(path string, d os.DirEntry) string {
+	info, err := d.Info()
+	if err != nil {
+		return resolvedPath(path)
+	}
+	return fileIdentity(path, info)
+}
+
+// dropLinkedTwice keeps each file once when symlinks lead to files the
+// scan also found directly or through another link, so a target is never
+// organized twice.
+func dropLinkedTwice(files []fileEntry, counts *scanCounts) []fileEntry {
+	linked := false
+	for _, f := range files {
+		linked = linked || f.Target != ""
+	}
+	if !linked {
+		return files
+	}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if f.Target == "" && f.Info != nil {
+			seen[fileIdentity(f.Path, f.Info)] = true
+		}
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if f.Target != "" {
+			id := fileIdentity(f.Target, f.Info)
+			if seen[id] {
+				counts.LinkedTwice++
+				continue
+			}
+			seen[id] = true
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// fileIdentity is the device and inode of a file, or its resolved path
+// where those aren't available.
+func fileIdentity(path string, info os.FileInfo) string {
+	if key, ok := fileID(path, info); ok {
+		return fmt.Sprintf("%d:%d", key.Dev, key.Ino)
+	}
+	return resolvedPath(path)
+}
+
+// moveLinked moves the target of a followed symlink to dest and removes
+// the link.
+// It reports whether the target had to be copied and, under -verify, the
+// digest of the copy.
+func moveLinked(ctx context.Context, link, target, dest string, verify bool) (bool, string, error) {
+	var copied bool
+	var verified string
+	var err error
+	if verify {
+		verified, err = moveVerified(ctx, target, dest)
+		copied = verified != ""
+	} else {
+		copied, err = relocate(ctx, target, dest)
+	}
+	if err != nil {
+		return copied, "", err
+	}
+	return copied, verified, os.Remove(link)
+}
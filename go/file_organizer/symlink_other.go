@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+const symlinkHint = ""
+
+func isJunction(d fs.DirEntry) bool {
+	return false
+}
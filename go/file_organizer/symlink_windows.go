@@ -0,0 +1,11 @@
+package main
+
+import "io/fs"
+
+const symlinkHint = " (creating symlinks needs Developer Mode or administrator rights)"
+
+// isJunction reports whether d is a junction or another reparse point that
+// isn't a symlink; Go reports those as irregular.
+func isJunction(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeIrregular != 0
+}
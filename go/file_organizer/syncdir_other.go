@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// syncDir fsyncs a folder so the entries renamed into it survive a crash.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxTagFrame caps how much of a single tag field is loaded; anything
+// bigger is cover art or junk we don't need.
+const maxTagFrame = 64 << 10
+
+type audioTags struct {
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+	Year        string
+}
+
+func (t audioTags) empty() bool {
+	return t.Artist == "" && t.AlbumArtist == "" && t.Album == "" && t.Title == ""
+}
+
+func readAudioTags(path string) (audioTags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return audioTags{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return audioTags{}, errors.New("file too short")
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		t, err := readID3v2(f)
+		if err == nil && !t.empty() {
+			return t, nil
+		}
+		return readID3v1(f)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return readFLACTags(f)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return readOggTags(f)
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		return readMP4Tags(f)
+	default:
+		return readID3v1(f)
+	}
+}
+
+func readID3v2(r io.ReadSeeker) (audioTags, error) {
+	var t audioTags
+
+	hdr := make([]byte, 10)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return t, err
+	}
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return t, err
+	}
+	major := hdr[3]
+	if major < 2 || major > 4 {
+		return t, fmt.Errorf("unsupported ID3v2.%d", major)
+	}
+	end := 10 + int64(synchsafe(hdr[6:10]))
+	pos := int64(10)
+
+	if hdr[5]&0x40 != 0 && major >= 3 {
+		ext := make([]byte, 4)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return t, err
+		}
+		if major == 4 {
+			pos += int64(synchsafe(ext))
+		} else {
+			pos += 4 + int64(binary.BigEndian.Uint32(ext))
+		}
+	}
+
+	idLen, hdrLen := 4, 10
+	if major == 2 {
+		idLen, hdrLen = 3, 6
+	}
+
+	fh := make([]byte, hdrLen)
+	for pos+int64(hdrLen) <= end {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return t, err
+		}
+		if _, err := io.ReadFull(r, fh); err != nil {
+			return t, err
+		}
+		if fh[0] == 0 {
+			break // padding
+		}
+
+		id := string(fh[:idLen])
+		var size int64
+		var flags uint16
+		switch major {
+		case 2:
+			size = int64(fh[3])<<16 | int64(fh[4])<<8 | int64(fh[5])
+		case 3:
+			size = int64(binary.BigEndian.Uint32(fh[4:8]))
+			flags = binary.BigEndian.Uint16(fh[8:10])
+		default:
+			size = int64(synchsafe(fh[4:8]))
+			flags = binary.BigEndian.Uint16(fh[8:10])
+		}
+		pos += int64(hdrLen)
+		next := pos + size
+		if size <= 0 || next > end {
+			break
+		}
+
+		field := id3Field(id)
+		skip := (major == 3 && flags&0x00c0 != 0) || (major == 4 && flags&0x000c != 0)
+		if field != nil && !skip && size <= maxTagFrame {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return t, err
+			}
+			if major == 4 && flags&0x0001 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+			field(&t, decodeID3Text(data))
+		}
+		pos = next
+	}
+	return t, nil
+}
+
+func id3Field(id string) func(*audioTags, string) {
+	switch id {
+	case "TPE1", "TP1":
+		return func(t *audioTags, v string) { t.Artist = v }
+	case "TPE2", "TP2":
+		return func(t *audioTags, v string) { t.AlbumArtist = v }
+	case "TALB", "TAL":
+		return func(t *audioTags, v string) { t.Album = v }
+	case "TIT2", "TT2":
+		return func(t *audioTags, v string) { t.Title = v }
+	case "TDRC", "TYER", "TYE":
+		return func(t *audioTags, v string) { t.Year = v }
+	}
+	return nil
+}
+
+func synchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func decodeID3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, data := b[0], b[1:]
+
+	var s string
+	switch enc {
+	case 1, 2:
+		s = decodeUTF16(data, enc == 2)
+	case 3:
+		s = string(data)
+	default:
+		s = latin1(data)
+	}
+	// ID3v2.4 separates multiple values with NUL; keep the first.
+	s, _, _ = strings.Cut(s, "\x00")
+	return strings.TrimSpace(s)
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			bigEndian, b = false, b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			bigEndian, b = true, b[2:]
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		if bigEndian {
+			u = append(u, binary.BigEndian.Uint16(b[i:]))
+		} else {
+			u = append(u, binary.LittleEndian.Uint16(b[i:]))
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func readID3v1(r io.ReadSeeker) (audioTags, error) {
+	var t audioTags
+	if _, err := r.Seek(-128, io.SeekEnd); err != nil {
+		return t, errors.New("no tags found")
+	}
+	b := make([]byte, 128)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return t, err
+	}
+	if !bytes.HasPrefix(b, []byte("TAG")) {
+		return t, errors.New("no tags found")
+	}
+	field := func(b []byte) string {
+		return strings.TrimSpace(strings.TrimRight(latin1(b), "\x00 "))
+	}
+	t.Title = field(b[3:33])
+	t.Artist = field(b[33:63])
+	t.Album = field(b[63:93])
+	t.Year = field(b[93:97])
+	return t, nil
+}
+
+func readFLACTags(r io.ReadSeeker) (audioTags, error) {
+	pos := int64(4)
+	hdr := make([]byte, 4)
+	for {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return audioTags{}, err
+		}
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return audioTags{}, err
+		}
+		last := hdr[0]&0x80 != 0
+		typ := hdr[0] & 0x7f
+		size := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		pos += 4
+
+		if typ == 4 {
+			if size > 1<<20 {
+				return audioTags{}, errors.New("vorbis comment block too large")
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return audioTags{}, err
+			}
+			return parseVorbisComments(data)
+		}
+		if last {
+			return audioTags{}, errors.New("no vorbis comments")
+		}
+		pos += size
+	}
+}
+
+// readOggTags reassembles the first few Ogg packets and parses the Vorbis
+// or Opus comment header.
+func readOggTags(r io.ReadSeeker) (audioTags, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return audioTags{}, err
+	}
+	br := io.LimitReader(r, 1<<20)
+
+	var packet []byte
+	hdr := make([]byte, 27)
+	for packets := 0; packets < 3; {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return audioTags{}, errors.New("no comment header")
+		}
+		if !bytes.HasPrefix(hdr, []byte("OggS")) {
+			return audioTags{}, errors.New("corrupt ogg page")
+		}
+		segs := make([]byte, hdr[26])
+		if _, err := io.ReadFull(br, segs); err != nil {
+			return audioTags{}, err
+		}
+		for _, n := range segs {
+			seg := make([]byte, n)
+			if _, err := io.ReadFull(br, seg); err != nil {
+				return audioTags{}, err
+			}
+			packet = append(packet, seg...)
+			if n == 255 {
+				continue
+			}
+			switch {
+			case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+				return parseVorbisComments(packet[7:])
+			case bytes.HasPrefix(packet, []byte("OpusTags")):
+				return parseVorbisComments(packet[8:])
+			}
+			packet = packet[:0]
+			packets++
+		}
+	}
+	return audioTags{}, errors.New("no comment header")
+}
+
+func parseVorbisComments(b []byte) (audioTags, error) {
+	var t audioTags
+	errShort := errors.New("truncated vorbis comments")
+
+	if len(b) < 4 {
+		return t, errShort
+	}
+	vendor := int(binary.LittleEndian.Uint32(b))
+	if vendor > len(b)-8 {
+		return t, errShort
+	}
+	b = b[4+vendor:]
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+
+	for i := 0; i < count; i++ {
+		if len(b) < 4 {
+			return t, errShort
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return t, errShort
+		}
+		key, value, ok := strings.Cut(string(b[4:4+n]), "=")
+		b = b[4+n:]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(key) {
+		case "ARTIST":
+			if t.Artist == "" {
+				t.Artist = value
+			}
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			t.AlbumArtist = value
+		case "ALBUM":
+			t.Album = value
+		case "TITLE":
+			t.Title = value
+		case "DATE", "YEAR":
+			t.Year = value
+		}
+	}
+	return t, nil
+}
+
+func readMP4Tags(r io.ReadSeeker) (audioTags, error) {
+	var t audioTags
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return t, err
+	}
+
+	start := int64(0)
+	for _, name := range []string{"moov", "udta", "meta", "ilst"} {
+		s, e, err := findBox(r, start, end, name)
+		if err != nil {
+			return t, err
+		}
+		if name == "meta" {
+			// iTunes "meta" is a full box with 4 bytes of version/flags;
+			// QuickTime-style ones start straight with their children.
+			probe := make([]byte, 8)
+			if _, err := io.ReadFull(r, probe); err != nil {
+				return t, err
+			}
+			if !bytes.Equal(probe[4:8], []byte("hdlr")) {
+				s += 4
+			}
+		}
+		start, end = s, e
+	}
+
+	for pos := start; pos+8 <= end; {
+		size, typ, hdrLen, err := readBoxHeader(r, pos, end)
+		if err != nil {
+			return t, err
+		}
+		var field func(*audioTags, string)
+		switch typ {
+		case "\xa9ART":
+			field = func(t *audioTags, v string) { t.Artist = v }
+		case "aART":
+			field = func(t *audioTags, v string) { t.AlbumArtist = v }
+		case "\xa9alb":
+			field = func(t *audioTags, v string) { t.Album = v }
+		case "\xa9nam":
+			field = func(t *audioTags, v string) { t.Title = v }
+		case "\xa9day":
+			field = func(t *audioTags, v string) { t.Year = v }
+		}
+		if field != nil && size-hdrLen <= maxTagFrame {
+			data := make([]byte, size-hdrLen)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return t, err
+			}
+			// item -> "data" box: size, type, 4 bytes type indicator, 4 bytes locale, value
+			if len(data) >= 16 && string(data[4:8]) == "data" {
+				n := int(binary.BigEndian.Uint32(data))
+				if n >= 16 && n <= len(data) {
+					field(&t, strings.TrimSpace(string(data[16:n])))
+				}
+			}
+		}
+		pos += size
+	}
+	return t, nil
+}
+
+// readBoxHeader reads the ISO-BMFF box header at pos and leaves r positioned
+// at the start of the box content.
+func readBoxHeader(r io.ReadSeeker, pos, end int64) (int64, string, int64, error) {
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return 0, "", 0, err
+	}
+	h := make([]byte, 8)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, "", 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(h))
+	typ := string(h[4:8])
+	hdrLen := int64(8)
+	switch size {
+	case 0:
+		size = end - pos
+	case 1:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(ext))
+		hdrLen = 16
+	}
+	if size < hdrLen || pos+size > end {
+		return 0, "", 0, fmt.Errorf("corrupt %q box", typ)
+	}
+	return size, typ, hdrLen, nil
+}
+
+// findBox scans sibling boxes in [start, end) for name and returns the
+// bounds of its content, leaving r at the content start.
+func findBox(r io.ReadSeeker, start, end int64, name string) (int64, int64, error) {
+	for pos := start; pos+8 <= end; {
+		size, typ, hdrLen, err := readBoxHeader(r, pos, end)
+		if err != nil {
+			return 0, 0, err
+		}
+		if typ == name {
+			return pos + hdrLen, pos + size, nil
+		}
+		pos += size
+	}
+	return 0, 0, fmt.Errorf("no %q box", name)
+}
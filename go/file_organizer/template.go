@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var layoutTokens = map[string]bool{
+	"category": true,
+	"year":     true,
+	"month":    true,
+	"day":      true,
+	"ext":      true,
+	"name":     true,
+	"size":     true,
+	"hash":     true,
+	"owner":    true,
+}
+
+// hashLen is the number of hex digits {hash} keeps; enough to tell files
+// apart inside one folder without producing unwieldy names.
+const hashLen = 8
+
+type layoutPart struct {
+	Literal string
+	Token   string
+}
+
+type layoutTemplate struct {
+	Source string
+	Parts  []layoutPart
+	uses   map[string]bool
+	sizes  sizeBuckets
+}
+
+// parseLayoutTemplate parses a -layout value such as
+// "{category}/{year}-{month}/{name}". Without a {name} token the original
+// file name is appended.
+func parseLayoutTemplate(s string) (*layoutTemplate, error) {
+	t := &layoutTemplate{Source: s, uses: make(map[string]bool)}
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("invalid -layout: empty template")
+	}
+	if filepath.IsAbs(s) || strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid -layout %q: must be relative to -dest", s)
+	}
+	for _, comp := range strings.Split(filepath.ToSlash(s), "/") {
+		if comp == ".." || comp == "." {
+			return nil, fmt.Errorf("invalid -layout %q: %q is not allowed as a folder", s, comp)
+		}
+	}
+
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.ContainsRune(rest, '}') {
+				return nil, fmt.Errorf("invalid -layout %q: unmatched }", s)
+			}
+			t.Parts = append(t.Parts, layoutPart{Literal: rest})
+			break
+		}
+		if open > 0 {
+			if strings.ContainsRune(rest[:open], '}') {
+				return nil, fmt.Errorf("invalid -layout %q: unmatched }", s)
+			}
+			t.Parts = append(t.Parts, layoutPart{Literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid -layout %q: unclosed {", s)
+		}
+		tok := rest[open+1 : open+end]
+		if !layoutTokens[tok] {
+			return nil, fmt.Errorf("invalid -layout %q: unknown token {%s} (use category, year, month, day, ext, name, size, hash, owner)", s, tok)
+		}
+		t.Parts = append(t.Parts, layoutPart{Token: tok})
+		t.uses[tok] = true
+		rest = rest[open+end+1:]
+	}
+	if !t.uses["name"] {
+		t.Parts = append(t.Parts, layoutPart{Literal: "/"}, layoutPart{Token: "name"})
+		t.uses["name"] = true
+	}
+	return t, nil
+}
+
+func (t *layoutTemplate) usesDate() bool {
+	return t.uses["year"] || t.uses["month"] || t.uses["day"]
+}
+
+// resolve renders the template for one file, relative to the destination
+// root. Every value is sanitized, and the result is rejected if it would
+// leave the root anyway.
+func (t *layoutTemplate) resolve(path, name, ext string, m match, info os.FileInfo, when time.Time) (string, error) {
+	var hash string
+	if t.uses["hash"] {
+		hashed := contentHash
+		if isSymlink(info) {
+			hashed = linkHash
+		} else if kind := specialKind(info.Mode()); kind != "" {
+			return "", fmt.Errorf("cannot hash %s: %s", path, kind)
+		}
+		h, err := hashed(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot hash %s: %w", path, err)
+		}
+		hash = h
+	}
+
+	var b strings.Builder
+	for _, p := range t.Parts {
+		if p.Token == "" {
+			b.WriteString(p.Literal)
+			continue
+		}
+		var v string
+		switch p.Token {
+		case "category":
+			// categories may already be nested (code/go, other/xcf)
+			b.WriteString(filepath.ToSlash(m.Category))
+			continue
+		case "year":
+			v = when.Format("2006")
+		case "month":
+			v = when.Format("01")
+		case "day":
+			v = when.Format("02")
+		case "ext":
+			if v = extFolder(ext); v == "" {
+				v = "no_extension"
+			}
+		case "name":
+			// the real name is kept as is (dotfiles included); the check
+			// below still catches "..".
+			b.WriteString(name)
+			continue
+		case "size":
+			v = t.sizes.bucket(info.Size())
+		case "hash":
+			v = hash
+		case "owner":
+			v = fileOwner(info)
+		}
+		b.WriteString(strings.ReplaceAll(sanitizeComponent(v), "/", "_"))
+	}
+
+	var comps []string
+	for _, c := range strings.Split(b.String(), "/") {
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("layout %q resolves outside -dest for %s", t.Source, path)
+		}
+		comps = append(comps, c)
+	}
+	if len(comps) == 0 {
+		return "", fmt.Errorf("layout %q resolves to an empty path for %s", t.Source, path)
+	}
+	return filepath.Join(comps...), nil
+}
+
+func contentHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:hashLen], nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLayoutTemplateErrors(t *testing.T) {
+	tests := []struct {
+		layout, want string
+	}{
+		{"", "empty template"},
+		{"  ", "empty template"},
+		{"/abs/{name}", "relative to -dest"},
+		{"{category}/../{name}", `".." is not allowed`},
+		{"./{name}", `"." is not allowed`},
+		{"{year", "unclosed {"},
+		{"{category}/{year-{month}", "unknown token {year-{month}"},
+		{"{category}/x{", "unclosed {"},
+		{"year}/{name}", "unmatched }"},
+		{"{year}}/{name}", "unmatched }"},
+		{"{year}/month}", "unmatched }"},
+		{"{category}/{colour}", "unknown token {colour}"},
+		{"{}", "unknown token {}"},
+	}
+	for _, tt := range tests {
+		_, err := parseLayoutTemplate(tt.layout)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseLayoutTemplate(%q) = %v, want an error with %q", tt.layout, err, tt.want)
+		}
+	}
+}
+
+func TestLayoutTemplateResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Report.PDF")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := contentHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	m := match{Category: filepath.Join("code", "go")}
+
+	tests := []struct {
+		layout, name, want string
+	}{
+		{"{category}/{year}/{ext}/{name}", "Report.PDF", "code/go/2024/pdf/Report.PDF"},
+		// tokens next to literal text
+		{"{year}-{month}x/{name}", "Report.PDF", "2024-03x/Report.PDF"},
+		{"y{year}m{month}d{day}/{name}", "Report.PDF", "y2024m03d07/Report.PDF"},
+		{"{year}{month}{day}", "Report.PDF", "20240307/Report.PDF"},
+		{"by-{ext}/{hash}-{name}", "Report.PDF", "by-pdf/" + hash + "-Report.PDF"},
+		{"{category}_files/{name}.bak", "Report.PDF", "code/go_files/Report.PDF.bak"},
+		{"archive/{year}", "Report.PDF", "archive/2024/Report.PDF"},
+		// empty components collapse, the name is kept as is
+		{"{category}//{name}", ".hidden", "code/go/.hidden"},
+	}
+	for _, tt := range tests {
+		l, err := parseLayoutTemplate(tt.layout)
+		if err != nil {
+			t.Errorf("parseLayoutTemplate(%q): %v", tt.layout, err)
+			continue
+		}
+		_, ext := newCategorizer().splitExt(tt.name)
+		got, err := l.resolve(path, tt.name, ext, m, info, when)
+		if err != nil {
+			t.Errorf("%q: %v", tt.layout, err)
+			continue
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("%q resolves %s to %s, want %s", tt.layout, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutTemplateStaysInDest(t *testing.T) {
+	info, err := os.Lstat(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := parseLayoutTemplate("{category}/{name}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"..", "../../etc"} {
+		if got, err := l.resolve("src", name, "", match{Category: "other"}, info, time.Now()); err == nil {
+			t.Errorf("name %q resolved to %s, want an error", name, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+var normalizeForms = map[string]bool{"nfc": true, "nfd": true, "none": true}
+
+var composePairs, decomposePairs = buildCompositions()
+
+func buildCompositions() (map[[2]rune]rune, map[rune][2]rune) {
+	comp := make(map[[2]rune]rune)
+	decomp := make(map[rune][2]rune)
+	for mark, pairs := range compositions {
+		rs := []rune(pairs)
+		for i := 0; i+1 < len(rs); i += 2 {
+			comp[[2]rune{rs[i], mark}] = rs[i+1]
+			decomp[rs[i+1]] = [2]rune{rs[i], mark}
+		}
+	}
+	return comp, decomp
+}
+
+// Hangul syllables are composed arithmetically (Unicode 3.12).
+const (
+	hangulBase  = 0xac00
+	hangulL     = 0x1100
+	hangulV     = 0x1161
+	hangulT     = 0x11a7
+	hangulVN    = 21
+	hangulTN    = 28
+	hangulCount = 19 * hangulVN * hangulTN
+)
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// composeNFC turns decomposed letters (as macOS stores names) into their
+// precomposed form. Marks are composed with the letter right before them,
+// which covers names in canonical order; it is not a full NFC.
+func composeNFC(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if n := len(out); n > 0 {
+			if c, ok := composePair(out[n-1], r); ok {
+				out[n-1] = c
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+func composePair(a, b rune) (rune, bool) {
+	switch {
+	case a >= hangulL && a < hangulL+19 && b >= hangulV && b < hangulV+hangulVN:
+		return hangulBase + ((a-hangulL)*hangulVN+b-hangulV)*hangulTN, true
+	case a >= hangulBase && a < hangulBase+hangulCount && (a-hangulBase)%hangulTN == 0 &&
+		b > hangulT && b < hangulT+hangulTN:
+		return a + b - hangulT, true
+	}
+	c, ok := composePairs[[2]rune{a, b}]
+	return c, ok
+}
+
+// decomposeNFD is the inverse of composeNFC.
+func decomposeNFD(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	var out []rune
+	var split func(r rune)
+	split = func(r rune) {
+		if r >= hangulBase && r < hangulBase+hangulCount {
+			i := r - hangulBase
+			out = append(out, hangulL+i/(hangulVN*hangulTN), hangulV+i%(hangulVN*hangulTN)/hangulTN)
+			if t := i % hangulTN; t != 0 {
+				out = append(out, hangulT+t)
+			}
+			return
+		}
+		if d, ok := decomposePairs[r]; ok {
+			split(d[0])
+			out = append(out, d[1])
+			return
+		}
+		out = append(out, r)
+	}
+	for _, r := range s {
+		split(r)
+	}
+	return string(out)
+}
+
+func (o Options) normalizeName(s string) string {
+	switch o.NormalizeNames {
+	case "nfc":
+		return composeNFC(s)
+	case "nfd":
+		return decomposeNFD(s)
+	}
+	return s
+}
+
+// normalizePath rewrites the components of path below root in the
+// -normalize-names form. Where that name doesn't exist but another spelling
+// of it does (an NFD folder or file from macOS where an NFC one is headed),
+// the existing entry is used instead, so it is seen as the destination;
+// existing then names the first such entry.
+func (o Options) normalizePath(root, path string) (normalized, existing string) {
+	if o.NormalizeNames == "none" || isASCII(path) {
+		return path, ""
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path, ""
+	}
+	dir, probe := root, true
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		name := o.normalizeName(part)
+		if probe {
+			if _, err := os.Lstat(filepath.Join(dir, name)); err != nil {
+				probe = false
+				if found := spellingIn(dir, name); found != "" {
+					name, probe = found, true
+					if existing == "" {
+						existing = filepath.Join(dir, found)
+					}
+				}
+			}
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return dir, existing
+}
+
+// spellingIn finds an entry of dir that only differs from name in its
+// Unicode normalization.
+func spellingIn(dir, name string) string {
+	if isASCII(name) {
+		return ""
+	}
+	want := composeNFC(name)
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != name && composeNFC(e.Name()) == want {
+			return e.Name()
+		}
+	}
+	return ""
+}
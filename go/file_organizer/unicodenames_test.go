@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizationRoundTrip(t *testing.T) {
+	tests := []struct {
+		nfc, nfd string
+	}{
+		{"Caf\u00e9.txt", "Cafe\u0301.txt"},
+		{"\u00c5ngstr\u00f6m", "A\u030angstro\u0308m"},
+		{"Vi\u1ec7t Nam", "Vie\u0323\u0302t Nam"},                        // two marks on one letter
+		{"\ud55c\uae00.hwp", "\u1112\u1161\u11ab\u1100\u1173\u11af.hwp"}, // Hangul with final consonants
+		{"\uc544\uc774", "\u110b\u1161\u110b\u1175"},                     // Hangul without
+		{"\u0439\u043e\u0434", "\u0438\u0306\u043e\u0434"},
+		{"plain.txt", "plain.txt"},
+	}
+	for _, tt := range tests {
+		if got := composeNFC(tt.nfd); got != tt.nfc {
+			t.Errorf("composeNFC(%+q) = %+q, want %+q", tt.nfd, got, tt.nfc)
+		}
+		if got := decomposeNFD(tt.nfc); got != tt.nfd {
+			t.Errorf("decomposeNFD(%+q) = %+q, want %+q", tt.nfc, got, tt.nfd)
+		}
+		if got := composeNFC(decomposeNFD(tt.nfc)); got != tt.nfc {
+			t.Errorf("%+q does not survive NFD and back: %+q", tt.nfc, got)
+		}
+		if got := composeNFC(tt.nfc); got != tt.nfc {
+			t.Errorf("composeNFC changed the composed %+q to %+q", tt.nfc, got)
+		}
+	}
+}
+
+func TestNormalizePathFindsOtherSpelling(t *testing.T) {
+	root := t.TempDir()
+	nfd := "Re\u0301sume\u0301s"
+	if err := os.Mkdir(filepath.Join(root, nfd), 0755); err != nil {
+		t.Fatal(err)
+	}
+	o := Options{NormalizeNames: "nfc"}
+	got, existing := o.normalizePath(root, filepath.Join(root, "R\u00e9sum\u00e9s", "Caf\u00e9.txt"))
+	if want := filepath.Join(root, nfd, "Caf\u00e9.txt"); got != want || existing != filepath.Join(root, nfd) {
+		t.Errorf("normalizePath = %+q, %+q; want the existing NFD folder", got, existing)
+	}
+	got, existing = o.normalizePath(root, filepath.Join(root, "Cafe\u0301.txt"))
+	if got != filepath.Join(root, "Caf\u00e9.txt") || existing != "" {
+		t.Errorf("normalizePath = %+q, %+q; want the NFC name", got, existing)
+	}
+}
+
+func TestDecomposedNamesCollide(t *testing.T) {
+	for _, tt := range []struct{ incoming, present string }{
+		{"Cafe\u0301.txt", "Caf\u00e9.txt"},
+		{"Caf\u00e9.txt", "Cafe\u0301.txt"},
+		{"\u1112\u1161\u11ab\u1100\u1173\u11af.txt", "\ud55c\uae00.txt"},
+	} {
+		src, dest := t.TempDir(), t.TempDir()
+		if err := os.WriteFile(filepath.Join(src, tt.incoming), []byte("new"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		docs := filepath.Join(dest, "documents")
+		if err := os.Mkdir(docs, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(docs, tt.present), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := organize(t, "-src", src, "-dest", dest, "-on-conflict", "skip")
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		if !strings.Contains(out, "Skipped: 1\n") {
+			t.Errorf("%+q onto %+q: not a conflict:\n%s", tt.incoming, tt.present, out)
+		}
+		entries, _ := os.ReadDir(docs)
+		if len(entries) != 1 || entries[0].Name() != tt.present {
+			t.Errorf("%+q onto %+q: documents holds %v", tt.incoming, tt.present, entries)
+		}
+	}
+}
+
+func TestDecomposedNameIsComposed(t *testing.T) {
+	for form, want := range map[string]string{"nfc": "Caf\u00e9.txt", "nfd": "Cafe\u0301.txt", "none": "Cafe\u0301.txt"} {
+		src, dest := t.TempDir(), t.TempDir()
+		if err := os.WriteFile(filepath.Join(src, "Cafe\u0301.txt"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := organize(t, "-src", src, "-dest", dest, "-normalize-names", form); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "documents", want)); err != nil {
+			t.Errorf("-normalize-names %s: %v", form, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceGoneBeforeMove(t *testing.T) {
+	for _, extra := range [][]string{nil, {"-verify"}} {
+		src, dest := t.TempDir(), t.TempDir()
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// a.txt is deleted after the scan, just before it is moved
+		gone := filepath.Join(src, "a.txt")
+		rename = func(oldpath, newpath string) error {
+			if oldpath == gone {
+				os.Remove(oldpath)
+			}
+			return os.Rename(oldpath, newpath)
+		}
+		t.Cleanup(func() { rename = os.Rename })
+
+		args := append([]string{"-src", src, "-dest", dest, "-mode", "move"}, extra...)
+		out, err := organize(t, args...)
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", extra, err, out)
+		}
+		for _, want := range []string{
+			"Succeeded: 1\n",
+			"Skipped: 1\n",
+			"Failed: 0\n",
+			"Disappeared since the scan, skipped: 1\n",
+			"DISAPPEARED: " + gone,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: output lacks %q:\n%s", extra, want, out)
+			}
+		}
+	}
+}
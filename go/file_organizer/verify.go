@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errVerify marks a copy whose re-read content differs from the source.
+var errVerify = errors.New("verification failed")
+
+// copyVerified copies src to dest for -verify: the source is hashed while
+// it is copied, then dest is read back and compared. A copy that doesn't
+// match is removed. It returns the label recorded in the manifest.
+func copyVerified(ctx context.Context, src, dest string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	h := sha256.New()
+	if err := writeAtomic(dest, in, func(out io.Writer) error {
+		if n, err := io.Copy(io.MultiWriter(out, h), cancelable(ctx, in)); err != nil {
+			return copyError(src, dest, n, err)
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return verifyCopy(dest, "sha256", hex.EncodeToString(h.Sum(nil)))
+}
+
+// verifyCopy reads dest back and compares it with the digest taken from
+// the source; on a mismatch dest is removed.
+func verifyCopy(dest, algo, want string) (string, error) {
+	got, err := hashFile(dest, algo)
+	if err != nil {
+		removePartial(dest)
+		return "", fmt.Errorf("%w: cannot read back %s: %v", errVerify, dest, err)
+	}
+	if got != want {
+		removePartial(dest)
+		return "", fmt.Errorf("%w: %s has %s %s, the source %s; the copy was removed", errVerify, dest, algo, got, want)
+	}
+	return algo + ":" + want, nil
+}
+
+// moveVerified is moveFile under -verify: a rename needs no check, and
+// the copy fallback removes the source only once the copy was verified.
+func moveVerified(ctx context.Context, src, dest string) (string, error) {
+	err := rename(src, longPath(dest))
+	if err == nil {
+		return "", nil
+	}
+	if !crossDevice(err) {
+		return "", explainLength(dest, err)
+	}
+	verified, err := copyVerified(ctx, src, dest)
+	if err != nil {
+		return "", err
+	}
+	if err := finishMove(src, dest); err != nil {
+		return "", err
+	}
+	return verified, nil
+}
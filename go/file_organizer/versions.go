@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// versionStore records which files the rename policy produced for each
+// destination, oldest first, in dest/.organizer/versions.json. Only files
+// listed there are ever pruned, so look-alike user files are safe.
+type versionStore struct {
+	path     string
+	Lineage  map[string][]string `json:"lineage"`
+	modified bool
+}
+
+func loadVersions(dest string) (*versionStore, error) {
+	v := &versionStore{path: filepath.Join(dest, stateDir, "versions.json"), Lineage: make(map[string][]string)}
+	b, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("%s: %v", v.path, err)
+	}
+	if v.Lineage == nil {
+		v.Lineage = make(map[string][]string)
+	}
+	return v, nil
+}
+
+func (v *versionStore) save() error {
+	if v == nil || !v.modified {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(v.path, append(b, '\n'), 0644)
+}
+
+// add records a renamed version of dest and returns the versions beyond
+// keep, oldest first, which are dropped from the lineage.
+func (v *versionStore) add(dest, version string, keep int) []string {
+	var live []string
+	for _, p := range v.Lineage[dest] {
+		if _, err := os.Lstat(p); err == nil && p != version {
+			live = append(live, p)
+		}
+	}
+	live = append(live, version)
+	var pruned []string
+	if len(live) > keep {
+		pruned, live = live[:len(live)-keep], live[len(live)-keep:]
+	}
+	v.Lineage[dest] = live
+	v.modified = true
+	return pruned
+}
+
+// pruneVersion deletes an old version, or moves it to
+// dest/.organizer/trash/<run-id>/ with -prune-to-trash.
+func (o Options) pruneVersion(path string) error {
+	if o.DryRun {
+		fmt.Println("DRY-RUN: prune old version", path)
+		return nil
+	}
+	if o.Verbose {
+		fmt.Println("PRUNE old version:", path)
+	}
+	if !o.PruneToTrash {
+		return os.Remove(path)
+	}
+	rel, err := filepath.Rel(o.Dest, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		rel = filepath.Base(path)
+	}
+	trash := o.unusedPath(filepath.Join(o.Dest, stateDir, "trash", o.RunID, rel))
+	if err := os.MkdirAll(filepath.Dir(trash), 0755); err != nil {
+		return err
+	}
+	return moveFile(path, trash)
+}
+
+// trackVersion records a renamed placement and prunes versions beyond
+// -keep-versions.
+func (o Options) trackVersion(dest, version string) {
+	if o.Versions == nil {
+		return
+	}
+	for _, p := range o.Versions.add(dest, version, o.KeepVersions) {
+		if err := o.pruneVersion(p); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: cannot prune", p, ":", err)
+		}
+	}
+}
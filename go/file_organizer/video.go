@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxProbeBytes bounds how much of a video is read to find its tracks, so
+// probing never turns into reading the whole file. Matroska puts its track
+// list ahead of the clusters, so a much smaller head is enough there.
+const (
+	maxProbeBytes    = 4 << 20
+	maxMatroskaBytes = 1 << 20
+)
+
+type mediaTrack struct {
+	Video  bool
+	Audio  bool
+	Width  int
+	Height int
+}
+
+// probeTracks lists the tracks of an MP4/MOV or Matroska/WebM file from its
+// headers alone.
+func probeTracks(path string) ([]mediaTrack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, errors.New("file too short")
+	}
+	switch {
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		return mp4Tracks(f)
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		data, err := readBlock(f, 0, maxMatroskaBytes)
+		if err != nil {
+			return nil, err
+		}
+		return matroskaTracks(data)
+	default:
+		return nil, errors.New("unsupported container")
+	}
+}
+
+func mp4Tracks(f *os.File) ([]mediaTrack, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, err := findBox(f, 0, end, "moov")
+	if err != nil {
+		return nil, err
+	}
+	if stop-start > maxProbeBytes {
+		return nil, errors.New("moov box too large to probe")
+	}
+	moov, err := readBlock(f, start, stop-start)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []mediaTrack
+	for _, trak := range childBoxes(moov, "trak") {
+		var t mediaTrack
+		if hdlr := childBox(childBox(trak, "mdia"), "hdlr"); len(hdlr) >= 12 {
+			switch string(hdlr[8:12]) {
+			case "vide":
+				t.Video = true
+			case "soun":
+				t.Audio = true
+			}
+		}
+		// tkhd ends with width and height as 16.16 fixed point.
+		if tkhd := childBox(trak, "tkhd"); len(tkhd) >= 84 {
+			t.Width = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+			t.Height = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("no tracks")
+	}
+	return tracks, nil
+}
+
+func childBoxes(b []byte, name string) [][]byte {
+	var out [][]byte
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			break
+		}
+		if string(b[4:8]) == name {
+			out = append(out, b[8:size])
+		}
+		b = b[size:]
+	}
+	return out
+}
+
+const (
+	ebmlSegment     = 0x18538067
+	ebmlTracks      = 0x1654ae6b
+	ebmlCluster     = 0x1f43b675
+	ebmlTrackEntry  = 0xae
+	ebmlTrackType   = 0x83
+	ebmlVideo       = 0xe0
+	ebmlPixelWidth  = 0xb0
+	ebmlPixelHeight = 0xba
+)
+
+var errEBML = errors.New("corrupt EBML data")
+
+// ebmlElement reads one element header, returning its ID, the data size
+// (-1 when unknown) and the header length.
+func ebmlElement(b []byte) (uint32, int64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, 0, errEBML
+	}
+	idLen := vintLen(b[0])
+	if idLen == 0 || idLen > 4 || len(b) < idLen {
+		return 0, 0, 0, errEBML
+	}
+	var id uint32
+	for _, c := range b[:idLen] {
+		id = id<<8 | uint32(c)
+	}
+
+	rest := b[idLen:]
+	if len(rest) == 0 {
+		return 0, 0, 0, errEBML
+	}
+	sizeLen := vintLen(rest[0])
+	if sizeLen == 0 || len(rest) < sizeLen {
+		return 0, 0, 0, errEBML
+	}
+	size := int64(rest[0] & (0xff >> sizeLen))
+	allOnes := size == int64(0xff>>sizeLen)
+	for _, c := range rest[1:sizeLen] {
+		size = size<<8 | int64(c)
+		allOnes = allOnes && c == 0xff
+	}
+	if allOnes {
+		size = -1
+	}
+	return id, size, idLen + sizeLen, nil
+}
+
+func vintLen(first byte) int {
+	for i := 0; i < 8; i++ {
+		if first&(0x80>>i) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ebmlChildren walks the direct children of an element's data, calling fn
+// for each; fn returns false to stop.
+func ebmlChildren(b []byte, fn func(id uint32, data []byte) bool) error {
+	for len(b) > 0 {
+		id, size, hdr, err := ebmlElement(b)
+		if err != nil {
+			return err
+		}
+		if size < 0 || int64(hdr)+size > int64(len(b)) {
+			// unknown or truncated size: hand over what we have
+			size = int64(len(b) - hdr)
+		}
+		if !fn(id, b[hdr:int64(hdr)+size]) {
+			return nil
+		}
+		b = b[int64(hdr)+size:]
+	}
+	return nil
+}
+
+func ebmlUint(b []byte) int {
+	var v int
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func matroskaTracks(data []byte) ([]mediaTrack, error) {
+	var segment []byte
+	if err := ebmlChildren(data, func(id uint32, d []byte) bool {
+		if id == ebmlSegment {
+			segment = d
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if segment == nil {
+		return nil, errors.New("no segment")
+	}
+
+	var tracks []mediaTrack
+	var found bool
+	err := ebmlChildren(segment, func(id uint32, d []byte) bool {
+		switch id {
+		case ebmlCluster:
+			return false
+		case ebmlTracks:
+			found = true
+			_ = ebmlChildren(d, func(id uint32, d []byte) bool {
+				if id == ebmlTrackEntry {
+					tracks = append(tracks, matroskaTrack(d))
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+	if err != nil && !found {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("no track list before media data")
+	}
+	return tracks, nil
+}
+
+func matroskaTrack(d []byte) mediaTrack {
+	var t mediaTrack
+	_ = ebmlChildren(d, func(id uint32, d []byte) bool {
+		switch id {
+		case ebmlTrackType:
+			switch ebmlUint(d) {
+			case 1:
+				t.Video = true
+			case 2:
+				t.Audio = true
+			}
+		case ebmlVideo:
+			_ = ebmlChildren(d, func(id uint32, d []byte) bool {
+				switch id {
+				case ebmlPixelWidth:
+					t.Width = ebmlUint(d)
+				case ebmlPixelHeight:
+					t.Height = ebmlUint(d)
+				}
+				return true
+			})
+		}
+		return true
+	})
+	return t
+}
+
+// matroskaExts are the Matroska extensions whose category depends on whether
+// the container actually holds video.
+var matroskaExts = map[string]bool{".webm": true, ".mkv": true, ".mka": true}
+
+// containerCategory refines videos/audio for Matroska files by their track
+// list; parse failures keep the extension-based category.
+func containerCategory(path, cat string) (string, string) {
+	tracks, err := probeTracks(path)
+	if err != nil {
+		return cat, ""
+	}
+	var video, audio bool
+	for _, t := range tracks {
+		video = video || t.Video
+		audio = audio || t.Audio
+	}
+	switch {
+	case video && cat != "videos":
+		return "videos", "video track detected"
+	case !video && audio && cat != "audio":
+		return "audio", "audio-only container detected"
+	}
+	return cat, ""
+}
+
+type resolutionBucket struct {
+	Name      string
+	MinHeight int
+}
+
+// parseVideoBuckets parses "4k=2160,1080p=1080,sd=0"; a video goes to the
+// first bucket (largest first) whose minimum its shorter side reaches.
+func parseVideoBuckets(s string) ([]resolutionBucket, error) {
+	var out []resolutionBucket
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		name, min, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = sanitizeComponent(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid -video-buckets %q: expected NAME=MIN_HEIGHT entries", s)
+		}
+		h, err := strconv.Atoi(strings.TrimSpace(min))
+		if err != nil || h < 0 {
+			return nil, fmt.Errorf("invalid -video-buckets %q: bad height %q", s, min)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid -video-buckets %q: duplicate bucket %q", s, name)
+		}
+		seen[name] = true
+		out = append(out, resolutionBucket{Name: name, MinHeight: h})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].MinHeight > out[j].MinHeight })
+	return out, nil
+}
+
+func (o Options) videoDir(path string) (string, string, error) {
+	tracks, err := probeTracks(path)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot read video resolution of %s: %v", path, err)
+	}
+	for _, t := range tracks {
+		if !t.Video || t.Width == 0 || t.Height == 0 {
+			continue
+		}
+		short := min(t.Width, t.Height)
+		for _, b := range o.VideoBuckets {
+			if short >= b.MinHeight {
+				return b.Name, fmt.Sprintf("%dx%d", t.Width, t.Height), nil
+			}
+		}
+		return "", fmt.Sprintf("%dx%d, below every bucket", t.Width, t.Height), nil
+	}
+	return "", "", fmt.Errorf("cannot read video resolution of %s: no video track", path)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// windowsNames decides, per destination root, whether destination names
+// must be valid on Windows: always with -windows-safe, otherwise when the
+// root sits on a Windows filesystem (NTFS, FAT, exFAT).
+type windowsNames struct {
+	force bool
+
+	mu    sync.Mutex
+	roots map[string]bool
+}
+
+func newWindowsNames(force bool) *windowsNames {
+	return &windowsNames{force: force, roots: make(map[string]bool)}
+}
+
+func (w *windowsNames) needed(root string) bool {
+	if w.force {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	safe, ok := w.roots[root]
+	if !ok {
+		dir := root
+		for {
+			if _, err := os.Stat(dir); err == nil {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+		safe = windowsFS(dir)
+		w.roots[root] = safe
+	}
+	return safe
+}
+
+// windowsSafePath sanitizes every component of path below root. Unlike
+// sanitizeComponent it keeps the name otherwise intact, so the result is
+// the same on every run and only differs where Windows would refuse it.
+func (o Options) windowsSafePath(root, path string) string {
+	if o.WinNames == nil || !o.WinNames.needed(root) {
+		return path
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, p := range parts {
+		parts[i] = windowsSafeName(p)
+	}
+	return filepath.Join(root, filepath.Join(parts...))
+}
+
+// windowsSafeName replaces characters NTFS rejects, trims trailing dots
+// and spaces and escapes device names: "what?.pdf" -> "what_.pdf",
+// "con.txt" -> "_con.txt".
+func windowsSafeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	stem, _, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,23 @@
+package main
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2).
+const (
+	msdosMagic = 0x4d44
+	ntfsMagic  = 0x5346544e
+	ntfs3Magic = 0x7366746e
+	exfatMagic = 0x2011bab0
+)
+
+func windowsFS(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+	switch int64(st.Type) {
+	case msdosMagic, ntfsMagic, ntfs3Magic, exfatMagic:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !windows
+
+package main
+
+func windowsFS(dir string) bool {
+	return false
+}
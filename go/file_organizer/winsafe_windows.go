@@ -0,0 +1,5 @@
+package main
+
+func windowsFS(dir string) bool {
+	return true
+}
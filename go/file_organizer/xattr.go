@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// xattrStats counts what copyXattrs did, for the -verbose summary.
+var xattrStats struct {
+	Files, Copied, Rejected int
+}
+
+// splitXattrNames splits a listxattr buffer of NUL-terminated names.
+func splitXattrNames(buf []byte) []string {
+	var names []string
+	for _, name := range strings.Split(string(buf), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// copyXattrs copies the extended attributes of src that keepXattr
+// accepts onto path, a copy of src that will become dest. An attribute
+// the destination refuses is reported and skipped; the copy still counts.
+func copyXattrs(src, path, dest string) {
+	names, err := listXattrs(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARN: %s: cannot list extended attributes: %v\n", src, err)
+		return
+	}
+	copied := 0
+	for _, name := range names {
+		if !keepXattr(name) {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err == nil {
+			err = setXattr(path, name, value)
+		}
+		if err != nil {
+			xattrStats.Rejected++
+			fmt.Fprintf(os.Stderr, "WARN: %s: extended attribute %s not copied: %v\n", dest, name, err)
+			continue
+		}
+		copied++
+	}
+	if copied > 0 {
+		xattrStats.Files++
+		xattrStats.Copied += copied
+	}
+}
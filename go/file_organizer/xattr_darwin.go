@@ -0,0 +1,82 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// keepXattr copies everything: Finder tags, quarantine flags and
+// WhereFroms are all ordinary attributes on macOS.
+func keepXattr(name string) bool {
+	return true
+}
+
+// the syscall package has no xattr wrappers on darwin; see originURLs.
+
+func listXattrs(path string) ([]string, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	n, _, errno := syscall.Syscall6(syscall.SYS_LISTXATTR, uintptr(unsafe.Pointer(p)), 0, 0, xattrNoFollow, 0, 0)
+	if errno == syscall.ENOTSUP {
+		return nil, nil
+	}
+	if errno != 0 || n == 0 {
+		return nil, errnoErr(errno)
+	}
+	buf := make([]byte, n)
+	n, _, errno = syscall.Syscall6(syscall.SYS_LISTXATTR, uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), xattrNoFollow, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return splitXattrNames(buf[:n]), nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	n, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)), 0, 0, 0, xattrNoFollow)
+	if errno != 0 || n == 0 {
+		return nil, errnoErr(errno)
+	}
+	buf := make([]byte, n)
+	n, _, errno = syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, xattrNoFollow)
+	if errno != 0 {
+		return nil, errno
+	}
+	return buf[:n], nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	a, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var v unsafe.Pointer
+	if len(value) > 0 {
+		v = unsafe.Pointer(&value[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)),
+		uintptr(v), uintptr(len(value)), 0, xattrNoFollow)
+	return errnoErr(errno)
+}
+
+func errnoErr(errno syscall.Errno) error {
+	if errno == 0 {
+		return nil
+	}
+	return errno
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+// keepXattr limits copies to the user namespace; security.* and trusted.*
+// need privileges and belong to the destination's policy.
+func keepXattr(name string) bool {
+	return strings.HasPrefix(name, "user.")
+}
+
+func listXattrs(path string) ([]string, error) {
+	n, err := syscall.Listxattr(path, nil)
+	if err != nil || n == 0 {
+		if err == syscall.ENOTSUP {
+			err = nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if n, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+	return splitXattrNames(buf[:n]), nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	n, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if n, err = syscall.Getxattr(path, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
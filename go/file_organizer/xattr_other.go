@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package main
+
+func keepXattr(name string) bool {
+	return false
+}
+
+func listXattrs(path string) ([]string, error) {
+	return nil, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return nil
+}